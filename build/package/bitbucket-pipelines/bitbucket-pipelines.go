@@ -4,6 +4,7 @@ import (
 	"flag"
 	"os"
 
+	"github.com/launchdarkly/ld-find-code-refs/internal/ci"
 	"github.com/launchdarkly/ld-find-code-refs/internal/log"
 	o "github.com/launchdarkly/ld-find-code-refs/internal/options"
 	"github.com/launchdarkly/ld-find-code-refs/pkg/coderefs"
@@ -18,13 +19,15 @@ func main() {
 	}
 
 	log.Info.Printf("setting Bitbucket Pipelines env vars")
-	options := map[string]string{
-		"repoType":         "bitbucket",
-		"repoName":         os.Getenv("BITBUCKET_REPO_SLUG"),
-		"dir":              os.Getenv("BITBUCKET_CLONE_DIR"),
-		"repoUrl":          os.Getenv("BITBUCKET_GIT_HTTP_ORIGIN"),
-		"updateSequenceId": os.Getenv("BITBUCKET_BUILD_NUMBER"),
+	build, err := ci.BitbucketPipelines.Build(os.Getenv)
+	if err != nil {
+		log.Error.Fatalf("%s", err)
+	}
+	err = build.Validate()
+	if err != nil {
+		log.Error.Fatalf("%s", err)
 	}
+	options := build.Options()
 	ldOptions, err := o.GetLDOptionsFromEnv()
 	if err != nil {
 		log.Error.Fatalf("Error setting options %s", err)
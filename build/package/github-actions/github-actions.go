@@ -1,15 +1,10 @@
 package main
 
 import (
-	"encoding/json"
 	"flag"
-	"fmt"
-	"io/ioutil"
 	"os"
-	"regexp"
-	"strconv"
-	"strings"
 
+	"github.com/launchdarkly/ld-find-code-refs/internal/ci"
 	"github.com/launchdarkly/ld-find-code-refs/internal/log"
 	o "github.com/launchdarkly/ld-find-code-refs/internal/options"
 	"github.com/launchdarkly/ld-find-code-refs/pkg/coderefs"
@@ -24,28 +19,15 @@ func main() {
 	}
 
 	log.Info.Printf("Setting GitHub action env vars")
-	ghRepo := strings.Split(os.Getenv("GITHUB_REPOSITORY"), "/")
-	if len(ghRepo) < 2 {
-		log.Error.Fatalf("unable to validate GitHub repository name: %s", ghRepo)
-	}
-	ghBranch, err := parseBranch(os.Getenv("GITHUB_REF"))
+	build, err := ci.GitHubActions.Build(os.Getenv)
 	if err != nil {
-		log.Error.Fatalf("error parsing GITHUB_REF: %s", err)
+		log.Error.Fatalf("%s", err)
 	}
-	event, err := parseEvent(os.Getenv("GITHUB_EVENT_PATH"))
+	err = build.Validate()
 	if err != nil {
-		log.Error.Fatalf("error parsing GitHub event payload at %s: %s", os.Getenv("GITHUB_EVENT_PATH"), err)
-	}
-
-	options := map[string]string{
-		"branch":           ghBranch,
-		"repoType":         "github",
-		"repoName":         ghRepo[1],
-		"dir":              os.Getenv("GITHUB_WORKSPACE"),
-		"updateSequenceId": strconv.FormatInt(event.Repo.PushedAt*1000, 10), // seconds to milliseconds
-		"defaultBranch":    event.Repo.DefaultBranch,
-		"repoUrl":          event.Repo.Url,
+		log.Error.Fatalf("%s", err)
 	}
+	options := build.Options()
 	ldOptions, err := o.GetLDOptionsFromEnv()
 	if err != nil {
 		log.Error.Fatalf("Error setting options: %s", err)
@@ -67,48 +49,3 @@ func main() {
 	log.Info.Printf("starting repo parsing program with options:\n %+v\n", options)
 	coderefs.Scan()
 }
-
-type Event struct {
-	Repo   `json:"repository"`
-	Sender `json:"sender"`
-}
-
-type Repo struct {
-	Url           string `json:"html_url"`
-	DefaultBranch string `json:"default_branch"`
-	PushedAt      int64  `json:"pushed_at"`
-}
-
-type Sender struct {
-	Username string `json:"login"`
-}
-
-func parseEvent(path string) (*Event, error) {
-	/* #nosec */
-	eventJsonFile, err := os.Open(path)
-	if err != nil {
-		return nil, err
-	}
-
-	eventJsonBytes, err := ioutil.ReadAll(eventJsonFile)
-	if err != nil {
-		return nil, err
-	}
-	var evt Event
-	err = json.Unmarshal(eventJsonBytes, &evt)
-	if err != nil {
-		return nil, err
-	}
-	return &evt, err
-}
-
-func parseBranch(ref string) (string, error) {
-	re := regexp.MustCompile(`^refs/heads/(.+)$`)
-	results := re.FindStringSubmatch(ref)
-
-	if results == nil {
-		return "", fmt.Errorf("expected branch name starting with refs/heads/, got: %s", ref)
-	}
-
-	return results[1], nil
-}
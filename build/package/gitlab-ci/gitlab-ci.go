@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ci"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	o "github.com/launchdarkly/ld-find-code-refs/internal/options"
+	"github.com/launchdarkly/ld-find-code-refs/pkg/coderefs"
+)
+
+func main() {
+	debug, err := o.GetDebugOptionFromEnv()
+	// init logging before checking error because we need to log the error if there is one
+	log.Init(debug)
+	if err != nil {
+		log.Error.Fatalf("error parsing debug option: %s", err)
+	}
+
+	log.Info.Printf("setting GitLab CI env vars")
+	build, err := ci.GitLabCI.Build(os.Getenv)
+	if err != nil {
+		log.Error.Fatalf("%s", err)
+	}
+	err = build.Validate()
+	if err != nil {
+		log.Error.Fatalf("%s", err)
+	}
+	options := build.Options()
+	ldOptions, err := o.GetLDOptionsFromEnv()
+	if err != nil {
+		log.Error.Fatalf("Error setting options: %s", err)
+	}
+	for k, v := range ldOptions {
+		options[k] = v
+	}
+
+	o.Populate()
+	for k, v := range options {
+		err := flag.Set(k, v)
+		if err != nil {
+			log.Error.Fatalf("could not set option %s: %s", k, err)
+		}
+	}
+	// Don't log ld access token
+	optionsForLog := map[string]string{}
+	for k, v := range options {
+		optionsForLog[k] = v
+	}
+	optionsForLog["accessToken"] = ""
+	log.Info.Printf("starting repo parsing program with options:\n %+v\n", optionsForLog)
+	coderefs.Scan()
+}
@@ -9,6 +9,19 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "batch" {
+		batch(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "explain-ignore" {
+		explainIgnore(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "check" {
+		check(os.Args[2:])
+		return
+	}
+
 	err, cb := o.Init()
 	if err != nil {
 		log.Init(false)
@@ -16,6 +29,56 @@ func main() {
 		cb()
 		os.Exit(1)
 	}
-	log.Init(o.Debug.Value())
+	initLogging()
+	if err := o.DetectionError(); err != nil {
+		log.Warning.Printf("could not read options from the CI provider environment, only the options provided are used: %s", err)
+	} else if build := o.DetectedBuild(); build != nil {
+		log.Info.Printf("read options not provided from the %s environment", build.Provider)
+	}
 	coderefs.Scan()
 }
+
+func batch(args []string) {
+	err, cb := o.InitBatch(args)
+	if err != nil {
+		log.Init(false)
+		log.Error.Printf("could not validate command line options: %s", err)
+		cb()
+		os.Exit(1)
+	}
+	initLogging()
+	coderefs.Batch()
+}
+
+func explainIgnore(args []string) {
+	err, cb := o.InitExplainIgnore(args)
+	if err != nil {
+		log.Init(false)
+		log.Error.Printf("could not validate command line options: %s", err)
+		cb()
+		os.Exit(1)
+	}
+	initLogging()
+	coderefs.ExplainIgnore()
+}
+
+func check(args []string) {
+	err, cb := o.InitCheck(args)
+	if err != nil {
+		log.Init(false)
+		log.Error.Printf("could not validate command line options: %s", err)
+		cb()
+		os.Exit(1)
+	}
+	initLogging()
+	coderefs.Check()
+}
+
+func initLogging() {
+	err := log.Configure(o.LogFormat.Value(), o.LogLevelValue())
+	if err != nil {
+		log.Init(false)
+		log.Error.Printf("could not validate command line options: %s", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,125 @@
+package branchlist
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+)
+
+// ReadFile reads a list of branch names, one per line. Blank lines and lines starting with `#` are ignored.
+func ReadFile(path string) (map[string]bool, error) {
+	/* #nosec */
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ret := map[string]bool{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name := strings.TrimSpace(scanner.Text())
+		if name == "" || strings.HasPrefix(name, "#") {
+			continue
+		}
+		ret[strings.TrimPrefix(name, "refs/heads/")] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	log.Debug.Printf("found %d branches in %s", len(ret), path)
+	return ret, nil
+}
+
+// pageSize is the number of branches requested per page, the maximum allowed by GitHub and GitLab
+const pageSize = 100
+
+// ApiClient lists branches from a git host API endpoint returning a JSON array of objects with a `name` field, with
+// `page` and `per_page` pagination, such as GitHub's `/repos/{owner}/{repo}/branches` or GitLab's
+// `/projects/{id}/repository/branches`.
+type ApiClient struct {
+	url        string
+	token      string
+	httpClient *http.Client
+}
+
+func NewApiClient(endpoint, token string, httpClient *http.Client) (*ApiClient, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("branch API url must be an absolute url, e.g. https://api.github.com/repos/owner/repo/branches")
+	}
+	return &ApiClient{url: endpoint, token: token, httpClient: httpClient}, nil
+}
+
+// Branches requests every page of branches
+func (c *ApiClient) Branches(ctx context.Context) (map[string]bool, error) {
+	ret := map[string]bool{}
+	for page := 1; ; page++ {
+		names, err := c.page(ctx, page)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			ret[name] = true
+		}
+		if len(names) < pageSize {
+			break
+		}
+	}
+	log.Debug.Printf("found %d branches from the branch API", len(ret))
+	return ret, nil
+}
+
+func (c *ApiClient) page(ctx context.Context, page int) ([]string, error) {
+	u, err := url.Parse(c.url)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("per_page", strconv.Itoa(pageSize))
+	q.Set("page", strconv.Itoa(page))
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	res, err := c.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("branch API responded with status %d", res.StatusCode)
+	}
+
+	var branches []struct {
+		Name string `json:"name"`
+	}
+	err = json.Unmarshal(body, &branches)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse branch API response: %s", err)
+	}
+	names := make([]string, 0, len(branches))
+	for _, b := range branches {
+		names = append(names, b.Name)
+	}
+	return names, nil
+}
@@ -0,0 +1,84 @@
+package branchlist
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+)
+
+func TestMain(m *testing.M) {
+	log.Init(true)
+	os.Exit(m.Run())
+}
+
+func TestReadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "branchlist")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "branches.txt")
+	require.NoError(t, ioutil.WriteFile(path, []byte("# mirrored branches\nmain\n\n  feature/a  \nrefs/heads/release/1.0\n"), 0644))
+	branches, err := ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, map[string]bool{"main": true, "feature/a": true, "release/1.0": true}, branches)
+
+	_, err = ReadFile(filepath.Join(dir, "missing.txt"))
+	require.Error(t, err)
+}
+
+// branchServer is a stand-in for a git host API, serving count branches in pages
+func branchServer(t *testing.T, count int, token string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if token != "" && req.Header.Get("Authorization") != "Bearer "+token {
+			res.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		page, _ := strconv.Atoi(req.URL.Query().Get("page"))
+		perPage, _ := strconv.Atoi(req.URL.Query().Get("per_page"))
+		branches := []map[string]string{}
+		for i := (page - 1) * perPage; i < page*perPage && i < count; i++ {
+			branches = append(branches, map[string]string{"name": fmt.Sprintf("branch-%d", i)})
+		}
+		require.NoError(t, json.NewEncoder(res).Encode(branches))
+	}))
+}
+
+func TestApiClient(t *testing.T) {
+	t.Run("requests every page", func(t *testing.T) {
+		server := branchServer(t, 250, "secret")
+		defer server.Close()
+
+		client, err := NewApiClient(server.URL+"/repos/owner/repo/branches", "secret", server.Client())
+		require.NoError(t, err)
+		branches, err := client.Branches(context.Background())
+		require.NoError(t, err)
+		require.Len(t, branches, 250)
+		require.True(t, branches["branch-249"])
+	})
+
+	t.Run("fails on error responses", func(t *testing.T) {
+		server := branchServer(t, 1, "secret")
+		defer server.Close()
+
+		client, err := NewApiClient(server.URL, "wrong", server.Client())
+		require.NoError(t, err)
+		_, err = client.Branches(context.Background())
+		require.EqualError(t, err, "branch API responded with status 401")
+	})
+
+	t.Run("requires an absolute url", func(t *testing.T) {
+		_, err := NewApiClient("/repos/owner/repo/branches", "", http.DefaultClient)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,203 @@
+package ci
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Env reads an environment variable, like os.Getenv
+type Env func(key string) string
+
+// Build describes the checkout being built by a CI provider. Fields the provider doesn't supply are left empty.
+type Build struct {
+	Provider string
+	RepoType string
+	RepoName string
+	RepoUrl  string
+	Dir      string
+	// Only one of Branch and Tag is set. Tag is set for builds triggered by pushing a tag.
+	Branch        string
+	Tag           string
+	DefaultBranch string
+	// UpdateSequenceId increases with each build of the repository, or is 0 if the provider doesn't supply one
+	UpdateSequenceId  int64
+	CommitUrlTemplate string
+	HunkUrlTemplate   string
+	// BaseBranch is the branch a pull or merge request will be merged into. It is only set for pull request builds.
+	BaseBranch string
+	// CommentUrl is the API endpoint for comments on the pull or merge request, if the provider supports them
+	CommentUrl string
+	// StepSummaryFile is the path of a Markdown file displayed on the summary page of the build
+	StepSummaryFile string
+}
+
+// Options returns the scanner options supplied by the build, keyed by option name
+func (b Build) Options() map[string]string {
+	ret := map[string]string{}
+	set := func(name, value string) {
+		if value != "" {
+			ret[name] = value
+		}
+	}
+	set("repoType", b.RepoType)
+	set("repoName", b.RepoName)
+	set("repoUrl", b.RepoUrl)
+	set("dir", b.Dir)
+	set("branch", b.Branch)
+	set("tag", b.Tag)
+	set("defaultBranch", b.DefaultBranch)
+	set("commitUrlTemplate", b.CommitUrlTemplate)
+	set("hunkUrlTemplate", b.HunkUrlTemplate)
+	set("baseBranch", b.BaseBranch)
+	set("prCommentUrl", b.CommentUrl)
+	set("githubStepSummaryFile", b.StepSummaryFile)
+	if b.UpdateSequenceId > 0 {
+		ret["updateSequenceId"] = strconv.FormatInt(b.UpdateSequenceId, 10)
+	}
+	return ret
+}
+
+// Validate returns an error if the build doesn't supply the options required to scan it without other configuration
+func (b Build) Validate() error {
+	switch {
+	case b.RepoName == "":
+		return fmt.Errorf("%s did not provide the repository name", b.Provider)
+	case b.Dir == "":
+		return fmt.Errorf("%s did not provide the checkout directory", b.Provider)
+	case b.Branch == "" && b.Tag == "":
+		return fmt.Errorf("%s did not provide the branch or tag being built", b.Provider)
+	}
+	return nil
+}
+
+// Provider reads builds from the environment of a CI provider
+type Provider struct {
+	Name string
+	// detect reports whether the environment is a build run by the provider
+	detect func(env Env) bool
+	build  func(env Env) (Build, error)
+}
+
+// Build reads the build from env, which must be the environment of a build run by the provider
+func (p Provider) Build(env Env) (Build, error) {
+	b, err := p.build(env)
+	if err != nil {
+		return b, fmt.Errorf("could not read %s environment: %s", p.Name, err)
+	}
+	b.Provider = p.Name
+	return b, nil
+}
+
+// Providers lists the supported CI providers, in the order they are detected
+var Providers = []Provider{
+	GitHubActions,
+	BitbucketPipelines,
+	GitLabCI,
+	CircleCI,
+	Jenkins,
+	AzurePipelines,
+	Buildkite,
+	TeamCity,
+	Travis,
+}
+
+// Detect returns the build run by the first provider detected in env, or nil if env isn't the environment of a
+// supported CI provider
+func Detect(env Env) (*Build, error) {
+	for _, p := range Providers {
+		if p.detect(env) {
+			b, err := p.Build(env)
+			if err != nil {
+				return nil, err
+			}
+			return &b, nil
+		}
+	}
+	return nil, nil
+}
+
+var (
+	branchRefRegex = regexp.MustCompile(`^refs/heads/(.+)$`)
+	tagRefRegex    = regexp.MustCompile(`^refs/tags/(.+)$`)
+)
+
+// parseRef returns the branch or tag name of a ref of the form refs/heads/<branch> or refs/tags/<tag>
+func parseRef(ref string) (branch, tag string, err error) {
+	if results := tagRefRegex.FindStringSubmatch(ref); results != nil {
+		return "", results[1], nil
+	}
+	if results := branchRefRegex.FindStringSubmatch(ref); results != nil {
+		return results[1], "", nil
+	}
+	return "", "", fmt.Errorf("expected branch name starting with refs/heads/ or tag name starting with refs/tags/, got: %s", ref)
+}
+
+// sequenceId parses a build number, returning 0 if it is not a positive integer
+func sequenceId(buildNumber string) int64 {
+	id, err := strconv.ParseInt(buildNumber, 10, 64)
+	if err != nil || id < 0 {
+		return 0
+	}
+	return id
+}
+
+var scpLikeUrlRegex = regexp.MustCompile(`^(?:[^@/]+@)?([^:/]+):(.+)$`)
+
+// webUrl returns the web URL of a repository from the URL it was cloned from. SSH and SCP-like URLs are converted to
+// https, and credentials are removed. An empty string is returned if the URL can't be parsed.
+func webUrl(cloneUrl string) string {
+	if cloneUrl == "" {
+		return ""
+	}
+	if !strings.Contains(cloneUrl, "://") {
+		results := scpLikeUrlRegex.FindStringSubmatch(cloneUrl)
+		if results == nil {
+			return ""
+		}
+		cloneUrl = "https://" + results[1] + "/" + strings.TrimPrefix(results[2], "/")
+	}
+	u, err := url.Parse(cloneUrl)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		// the port of an SSH URL isn't the port of the web server
+		u.Scheme = "https"
+		u.Host = u.Hostname()
+	}
+	u.User = nil
+	u.Path = strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), ".git")
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String()
+}
+
+// repoName returns the last path segment of a repository URL
+func repoName(repoUrl string) string {
+	u, err := url.Parse(repoUrl)
+	if err != nil || strings.Trim(u.Path, "/") == "" {
+		return ""
+	}
+	return path.Base(u.Path)
+}
+
+// repoType returns the repo type of a repository hosted on a known service provider, or custom
+func repoType(repoUrl string) string {
+	u, err := url.Parse(repoUrl)
+	if err != nil {
+		return "custom"
+	}
+	switch strings.ToLower(u.Hostname()) {
+	case "github.com":
+		return "github"
+	case "bitbucket.org":
+		return "bitbucket"
+	case "gitlab.com":
+		return "gitlab"
+	}
+	return "custom"
+}
@@ -0,0 +1,337 @@
+package ci
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+	"time"
+)
+
+// GitHubActions reads builds from the environment of a GitHub Actions workflow. The default branch and update sequence
+// id are read from the payload of the event that triggered the workflow.
+var GitHubActions = Provider{
+	Name:   "GitHub Actions",
+	detect: func(env Env) bool { return env("GITHUB_ACTIONS") == "true" },
+	build: func(env Env) (Build, error) {
+		b := Build{
+			RepoType:        "github",
+			Dir:             env("GITHUB_WORKSPACE"),
+			StepSummaryFile: env("GITHUB_STEP_SUMMARY"),
+		}
+		if repo := env("GITHUB_REPOSITORY"); repo != "" {
+			parts := strings.Split(repo, "/")
+			if len(parts) != 2 || parts[1] == "" {
+				return b, fmt.Errorf("unable to validate GitHub repository name: %s", repo)
+			}
+			b.RepoName = parts[1]
+			serverUrl := env("GITHUB_SERVER_URL")
+			if serverUrl == "" {
+				serverUrl = "https://github.com"
+			}
+			b.RepoUrl = strings.TrimSuffix(serverUrl, "/") + "/" + repo
+		}
+
+		// pull request workflows run on a merge ref, so the source branch is used instead
+		if headRef := env("GITHUB_HEAD_REF"); headRef != "" {
+			b.Branch = headRef
+		} else if ref := env("GITHUB_REF"); ref != "" {
+			var err error
+			b.Branch, b.Tag, err = parseRef(ref)
+			if err != nil {
+				return b, fmt.Errorf("error parsing GITHUB_REF: %s", err)
+			}
+		}
+
+		if eventPath := env("GITHUB_EVENT_PATH"); eventPath != "" {
+			event, err := readGitHubEvent(eventPath)
+			if err != nil {
+				return b, fmt.Errorf("error parsing GitHub event payload at %s: %s", eventPath, err)
+			}
+			repo := event.Repo
+			if repo.Url != "" {
+				b.RepoUrl = repo.Url
+			}
+			b.DefaultBranch = repo.DefaultBranch
+			if !repo.pushedAt.IsZero() {
+				b.UpdateSequenceId = repo.pushedAt.UnixNano() / int64(time.Millisecond)
+			}
+			if pr := event.PullRequest; pr != nil {
+				b.BaseBranch = pr.Base.Ref
+				apiUrl := env("GITHUB_API_URL")
+				if apiUrl == "" {
+					apiUrl = "https://api.github.com"
+				}
+				if repoName := env("GITHUB_REPOSITORY"); repoName != "" && pr.Number > 0 {
+					b.CommentUrl = fmt.Sprintf("%s/repos/%s/issues/%d/comments", strings.TrimSuffix(apiUrl, "/"), repoName, pr.Number)
+				}
+			}
+		}
+		return b, nil
+	},
+}
+
+type gitHubEventRepo struct {
+	Url           string `json:"html_url"`
+	DefaultBranch string `json:"default_branch"`
+	// PushedAt is a unix timestamp in push events, and an RFC 3339 timestamp in other events
+	PushedAt json.RawMessage `json:"pushed_at"`
+	pushedAt time.Time
+}
+
+// gitHubEvent is the payload of the event that triggered a workflow
+type gitHubEvent struct {
+	Repo gitHubEventRepo `json:"repository"`
+	// PullRequest is only included in pull request events
+	PullRequest *struct {
+		Number int `json:"number"`
+		Base   struct {
+			Ref string `json:"ref"`
+		} `json:"base"`
+	} `json:"pull_request"`
+}
+
+func readGitHubEvent(path string) (gitHubEvent, error) {
+	var event gitHubEvent
+	/* #nosec */
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return event, err
+	}
+	err = json.Unmarshal(data, &event)
+	if err != nil {
+		return event, err
+	}
+
+	pushedAt := event.Repo.PushedAt
+	if len(pushedAt) == 0 || string(pushedAt) == "null" {
+		return event, nil
+	}
+	var seconds int64
+	if err := json.Unmarshal(pushedAt, &seconds); err == nil {
+		event.Repo.pushedAt = time.Unix(seconds, 0)
+		return event, nil
+	}
+	var timestamp time.Time
+	if err := json.Unmarshal(pushedAt, &timestamp); err != nil {
+		return event, fmt.Errorf("invalid repository.pushed_at: %s", pushedAt)
+	}
+	event.Repo.pushedAt = timestamp
+	return event, nil
+}
+
+// BitbucketPipelines reads builds from the environment of a Bitbucket Pipelines step
+var BitbucketPipelines = Provider{
+	Name:   "Bitbucket Pipelines",
+	detect: func(env Env) bool { return env("BITBUCKET_BUILD_NUMBER") != "" },
+	build: func(env Env) (Build, error) {
+		return Build{
+			RepoType:         "bitbucket",
+			RepoName:         env("BITBUCKET_REPO_SLUG"),
+			RepoUrl:          env("BITBUCKET_GIT_HTTP_ORIGIN"),
+			Dir:              env("BITBUCKET_CLONE_DIR"),
+			Branch:           env("BITBUCKET_BRANCH"),
+			Tag:              env("BITBUCKET_TAG"),
+			UpdateSequenceId: sequenceId(env("BITBUCKET_BUILD_NUMBER")),
+			BaseBranch:       env("BITBUCKET_PR_DESTINATION_BRANCH"),
+		}, nil
+	},
+}
+
+// GitLabCI reads builds from the environment of a GitLab CI job. GitLab checks out the commit being built with a
+// detached HEAD, so the branch is always provided.
+var GitLabCI = Provider{
+	Name:   "GitLab CI",
+	detect: func(env Env) bool { return env("GITLAB_CI") == "true" },
+	build: func(env Env) (Build, error) {
+		b := Build{
+			RepoType:         "gitlab",
+			RepoName:         env("CI_PROJECT_NAME"),
+			Dir:              env("CI_PROJECT_DIR"),
+			DefaultBranch:    env("CI_DEFAULT_BRANCH"),
+			UpdateSequenceId: sequenceId(env("CI_PIPELINE_IID")),
+		}
+		if repoUrl := strings.TrimSuffix(env("CI_PROJECT_URL"), "/"); repoUrl != "" {
+			b.RepoUrl = repoUrl
+			b.CommitUrlTemplate = repoUrl + "/-/commit/${sha}"
+			b.HunkUrlTemplate = repoUrl + "/-/blob/${sha}/${filePath}#L${lineNumber}"
+		}
+
+		switch {
+		case env("CI_COMMIT_TAG") != "":
+			b.Tag = env("CI_COMMIT_TAG")
+		case env("CI_MERGE_REQUEST_SOURCE_BRANCH_NAME") != "":
+			// merge request pipelines record references for the source branch of the merge request
+			b.Branch = env("CI_MERGE_REQUEST_SOURCE_BRANCH_NAME")
+			b.BaseBranch = env("CI_MERGE_REQUEST_TARGET_BRANCH_NAME")
+			apiUrl, projectId, iid := env("CI_API_V4_URL"), env("CI_PROJECT_ID"), env("CI_MERGE_REQUEST_IID")
+			if apiUrl != "" && projectId != "" && iid != "" {
+				b.CommentUrl = fmt.Sprintf("%s/projects/%s/merge_requests/%s/notes", strings.TrimSuffix(apiUrl, "/"), projectId, iid)
+			}
+		default:
+			b.Branch = env("CI_COMMIT_REF_NAME")
+		}
+		return b, nil
+	},
+}
+
+// CircleCI reads builds from the environment of a CircleCI job
+var CircleCI = Provider{
+	Name:   "CircleCI",
+	detect: func(env Env) bool { return env("CIRCLECI") == "true" },
+	build: func(env Env) (Build, error) {
+		repoUrl := webUrl(env("CIRCLE_REPOSITORY_URL"))
+		dir := env("CIRCLE_WORKING_DIRECTORY")
+		// the working directory defaults to ~/project
+		if strings.HasPrefix(dir, "~/") && env("HOME") != "" {
+			dir = path.Join(env("HOME"), dir[2:])
+		}
+		return Build{
+			RepoType:         repoType(repoUrl),
+			RepoName:         env("CIRCLE_PROJECT_REPONAME"),
+			RepoUrl:          repoUrl,
+			Dir:              dir,
+			Branch:           env("CIRCLE_BRANCH"),
+			Tag:              env("CIRCLE_TAG"),
+			UpdateSequenceId: sequenceId(env("CIRCLE_BUILD_NUM")),
+		}, nil
+	},
+}
+
+// Jenkins reads builds from the environment of a Jenkins job using the Git plugin, or of a multibranch pipeline.
+// Jenkins checks out the commit being built with a detached HEAD.
+var Jenkins = Provider{
+	Name:   "Jenkins",
+	detect: func(env Env) bool { return env("JENKINS_URL") != "" },
+	build: func(env Env) (Build, error) {
+		repoUrl := webUrl(env("GIT_URL"))
+		b := Build{
+			RepoType:         repoType(repoUrl),
+			RepoName:         repoName(repoUrl),
+			RepoUrl:          repoUrl,
+			Dir:              env("WORKSPACE"),
+			UpdateSequenceId: sequenceId(env("BUILD_NUMBER")),
+		}
+		switch {
+		case env("TAG_NAME") != "":
+			b.Tag = env("TAG_NAME")
+		case env("CHANGE_BRANCH") != "":
+			// multibranch pipelines for pull requests name the branch after the pull request, e.g. PR-1
+			b.Branch = env("CHANGE_BRANCH")
+			b.BaseBranch = env("CHANGE_TARGET")
+		case env("BRANCH_NAME") != "":
+			b.Branch = env("BRANCH_NAME")
+		default:
+			// the Git plugin names the remote tracking branch, e.g. origin/main
+			b.Branch = strings.TrimPrefix(strings.TrimPrefix(env("GIT_BRANCH"), "refs/remotes/"), "origin/")
+		}
+		return b, nil
+	},
+}
+
+// AzurePipelines reads builds from the environment of an Azure Pipelines job
+var AzurePipelines = Provider{
+	Name:   "Azure Pipelines",
+	detect: func(env Env) bool { return strings.EqualFold(env("TF_BUILD"), "true") },
+	build: func(env Env) (Build, error) {
+		b := Build{
+			RepoUrl:          webUrl(env("BUILD_REPOSITORY_URI")),
+			Dir:              env("BUILD_SOURCESDIRECTORY"),
+			UpdateSequenceId: sequenceId(env("BUILD_BUILDID")),
+		}
+		switch env("BUILD_REPOSITORY_PROVIDER") {
+		case "GitHub", "GitHubEnterprise":
+			b.RepoType = "github"
+		case "Bitbucket":
+			b.RepoType = "bitbucket"
+		default:
+			b.RepoType = "custom"
+		}
+		// GitHub repositories are named after their owner, e.g. launchdarkly/ld-find-code-refs
+		if name := env("BUILD_REPOSITORY_NAME"); name != "" {
+			b.RepoName = path.Base(name)
+		}
+
+		// pull request builds run on a merge ref, so the source branch is used instead
+		if source := env("SYSTEM_PULLREQUEST_SOURCEBRANCH"); source != "" {
+			b.Branch = strings.TrimPrefix(source, "refs/heads/")
+			b.BaseBranch = strings.TrimPrefix(env("SYSTEM_PULLREQUEST_TARGETBRANCH"), "refs/heads/")
+		} else if ref := env("BUILD_SOURCEBRANCH"); ref != "" {
+			var err error
+			b.Branch, b.Tag, err = parseRef(ref)
+			if err != nil {
+				return b, fmt.Errorf("error parsing BUILD_SOURCEBRANCH: %s", err)
+			}
+		}
+		return b, nil
+	},
+}
+
+// Buildkite reads builds from the environment of a Buildkite job
+var Buildkite = Provider{
+	Name:   "Buildkite",
+	detect: func(env Env) bool { return env("BUILDKITE") == "true" },
+	build: func(env Env) (Build, error) {
+		repoUrl := webUrl(env("BUILDKITE_REPO"))
+		b := Build{
+			RepoType:         repoType(repoUrl),
+			RepoName:         repoName(repoUrl),
+			RepoUrl:          repoUrl,
+			Dir:              env("BUILDKITE_BUILD_CHECKOUT_PATH"),
+			DefaultBranch:    env("BUILDKITE_PIPELINE_DEFAULT_BRANCH"),
+			UpdateSequenceId: sequenceId(env("BUILDKITE_BUILD_NUMBER")),
+		}
+		if tag := env("BUILDKITE_TAG"); tag != "" {
+			b.Tag = tag
+		} else {
+			b.Branch = env("BUILDKITE_BRANCH")
+		}
+		// BUILDKITE_PULL_REQUEST is the pull request number, or false
+		if pr := env("BUILDKITE_PULL_REQUEST"); pr != "" && pr != "false" {
+			b.BaseBranch = env("BUILDKITE_PULL_REQUEST_BASE_BRANCH")
+		}
+		return b, nil
+	},
+}
+
+// TeamCity reads builds from the environment of a TeamCity build. TeamCity only provides the commit and build number
+// as environment variables, and the commit is read from the checkout, so the other options must be provided.
+var TeamCity = Provider{
+	Name:   "TeamCity",
+	detect: func(env Env) bool { return env("TEAMCITY_VERSION") != "" },
+	build: func(env Env) (Build, error) {
+		return Build{
+			// build numbers may be customized, in which case they are not used
+			UpdateSequenceId: sequenceId(env("BUILD_NUMBER")),
+		}, nil
+	},
+}
+
+// Travis reads builds from the environment of a Travis CI job. Repositories are assumed to be hosted on GitHub.
+var Travis = Provider{
+	Name:   "Travis CI",
+	detect: func(env Env) bool { return env("TRAVIS") == "true" },
+	build: func(env Env) (Build, error) {
+		b := Build{
+			RepoType:         "github",
+			Dir:              env("TRAVIS_BUILD_DIR"),
+			UpdateSequenceId: sequenceId(env("TRAVIS_BUILD_NUMBER")),
+		}
+		if slug := env("TRAVIS_REPO_SLUG"); slug != "" {
+			b.RepoName = path.Base(slug)
+			b.RepoUrl = "https://github.com/" + slug
+		}
+		switch {
+		case env("TRAVIS_TAG") != "":
+			b.Tag = env("TRAVIS_TAG")
+		case env("TRAVIS_PULL_REQUEST_BRANCH") != "":
+			// TRAVIS_BRANCH is the target branch of pull request builds
+			b.Branch = env("TRAVIS_PULL_REQUEST_BRANCH")
+			b.BaseBranch = env("TRAVIS_BRANCH")
+		default:
+			b.Branch = env("TRAVIS_BRANCH")
+		}
+		return b, nil
+	},
+}
@@ -0,0 +1,358 @@
+package ci
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type providerSpec struct {
+	name        string
+	env         map[string]string
+	expected    Build
+	expectError bool
+}
+
+// testProvider reads a build from each spec's environment, merged over base
+func testProvider(t *testing.T, p Provider, base map[string]string, specs []providerSpec) {
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{}
+			for k, v := range base {
+				env[k] = v
+			}
+			for k, v := range tt.env {
+				env[k] = v
+			}
+			require.True(t, p.detect(envOf(env)))
+			build, err := p.Build(envOf(env))
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			tt.expected.Provider = p.Name
+			assert.Equal(t, tt.expected, build)
+		})
+	}
+}
+
+func TestGitHubActions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "github-event")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	writeEvent := func(name, payload string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, ioutil.WriteFile(path, []byte(payload), 0644))
+		return path
+	}
+	pushEvent := writeEvent("push.json", `{"repository": {"html_url": "https://github.com/launchdarkly/ld-find-code-refs", "default_branch": "main", "pushed_at": 1589000000}}`)
+	pullRequestEvent := writeEvent("pull_request.json", `{"repository": {"html_url": "https://github.com/launchdarkly/ld-find-code-refs", "default_branch": "main", "pushed_at": "2020-05-09T04:53:20Z"}, "pull_request": {"number": 12, "base": {"ref": "main"}}}`)
+	invalidEvent := writeEvent("invalid.json", `{"repository": {"pushed_at": true}}`)
+
+	base := map[string]string{
+		"GITHUB_ACTIONS":    "true",
+		"GITHUB_REPOSITORY": "launchdarkly/ld-find-code-refs",
+		"GITHUB_WORKSPACE":  "/github/workspace",
+		"GITHUB_SHA":        "4b2c3fd",
+		"GITHUB_REF":        "refs/heads/feature/a",
+	}
+	expected := func(b Build) Build {
+		b.RepoType = "github"
+		b.RepoName = "ld-find-code-refs"
+		b.RepoUrl = "https://github.com/launchdarkly/ld-find-code-refs"
+		b.Dir = "/github/workspace"
+		return b
+	}
+	testProvider(t, GitHubActions, base, []providerSpec{
+		{
+			name:     "push",
+			env:      map[string]string{"GITHUB_EVENT_PATH": pushEvent, "GITHUB_STEP_SUMMARY": "/home/runner/work/_temp/step_summary"},
+			expected: expected(Build{Branch: "feature/a", DefaultBranch: "main", UpdateSequenceId: 1589000000000, StepSummaryFile: "/home/runner/work/_temp/step_summary"}),
+		},
+		{
+			name: "pull request",
+			env: map[string]string{
+				"GITHUB_EVENT_PATH": pullRequestEvent,
+				"GITHUB_REF":        "refs/pull/1/merge",
+				"GITHUB_HEAD_REF":   "feature/b",
+			},
+			expected: expected(Build{
+				Branch:           "feature/b",
+				DefaultBranch:    "main",
+				UpdateSequenceId: 1589000000000,
+				BaseBranch:       "main",
+				CommentUrl:       "https://api.github.com/repos/launchdarkly/ld-find-code-refs/issues/12/comments",
+			}),
+		},
+		{
+			name:     "tag",
+			env:      map[string]string{"GITHUB_REF": "refs/tags/v1.2.0"},
+			expected: expected(Build{Tag: "v1.2.0"}),
+		},
+		{
+			name:     "GitHub Enterprise",
+			env:      map[string]string{"GITHUB_SERVER_URL": "https://github.example.com"},
+			expected: Build{RepoType: "github", RepoName: "ld-find-code-refs", RepoUrl: "https://github.example.com/launchdarkly/ld-find-code-refs", Dir: "/github/workspace", Branch: "feature/a"},
+		},
+		{name: "invalid repository", env: map[string]string{"GITHUB_REPOSITORY": "ld-find-code-refs"}, expectError: true},
+		{name: "invalid ref", env: map[string]string{"GITHUB_REF": "notaref"}, expectError: true},
+		{name: "missing event", env: map[string]string{"GITHUB_EVENT_PATH": filepath.Join(dir, "missing.json")}, expectError: true},
+		{name: "invalid event", env: map[string]string{"GITHUB_EVENT_PATH": invalidEvent}, expectError: true},
+	})
+}
+
+func TestBitbucketPipelines(t *testing.T) {
+	base := map[string]string{
+		"BITBUCKET_BUILD_NUMBER":    "7",
+		"BITBUCKET_REPO_SLUG":       "repo",
+		"BITBUCKET_GIT_HTTP_ORIGIN": "http://bitbucket.org/launchdarkly/repo",
+		"BITBUCKET_CLONE_DIR":       "/opt/atlassian/pipelines/agent/build",
+		"BITBUCKET_COMMIT":          "4b2c3fd",
+	}
+	expected := func(b Build) Build {
+		b.RepoType = "bitbucket"
+		b.RepoName = "repo"
+		b.RepoUrl = "http://bitbucket.org/launchdarkly/repo"
+		b.Dir = "/opt/atlassian/pipelines/agent/build"
+		b.UpdateSequenceId = 7
+		return b
+	}
+	testProvider(t, BitbucketPipelines, base, []providerSpec{
+		{name: "branch", env: map[string]string{"BITBUCKET_BRANCH": "feature/a"}, expected: expected(Build{Branch: "feature/a"})},
+		{name: "tag", env: map[string]string{"BITBUCKET_TAG": "v1.2.0"}, expected: expected(Build{Tag: "v1.2.0"})},
+		{
+			name:     "pull request",
+			env:      map[string]string{"BITBUCKET_BRANCH": "feature/b", "BITBUCKET_PR_DESTINATION_BRANCH": "main"},
+			expected: expected(Build{Branch: "feature/b", BaseBranch: "main"}),
+		},
+	})
+}
+
+func TestGitLabCI(t *testing.T) {
+	base := map[string]string{
+		"GITLAB_CI":          "true",
+		"CI_PROJECT_NAME":    "my-project",
+		"CI_PROJECT_DIR":     "/builds/my-group/my-project",
+		"CI_PROJECT_URL":     "https://gitlab.com/my-group/my-project",
+		"CI_DEFAULT_BRANCH":  "main",
+		"CI_PIPELINE_IID":    "42",
+		"CI_COMMIT_SHA":      "4b2c3fd",
+		"CI_COMMIT_REF_NAME": "feature/a",
+	}
+	expected := func(b Build) Build {
+		b.RepoType = "gitlab"
+		b.RepoName = "my-project"
+		b.Dir = "/builds/my-group/my-project"
+		b.RepoUrl = "https://gitlab.com/my-group/my-project"
+		b.CommitUrlTemplate = "https://gitlab.com/my-group/my-project/-/commit/${sha}"
+		b.HunkUrlTemplate = "https://gitlab.com/my-group/my-project/-/blob/${sha}/${filePath}#L${lineNumber}"
+		b.DefaultBranch = "main"
+		b.UpdateSequenceId = 42
+		return b
+	}
+	testProvider(t, GitLabCI, base, []providerSpec{
+		{name: "branch pipeline", expected: expected(Build{Branch: "feature/a"})},
+		{
+			name: "merge request pipeline",
+			env: map[string]string{
+				"CI_COMMIT_REF_NAME":                  "refs/merge-requests/7/head",
+				"CI_MERGE_REQUEST_SOURCE_BRANCH_NAME": "feature/b",
+				"CI_MERGE_REQUEST_TARGET_BRANCH_NAME": "main",
+				"CI_MERGE_REQUEST_IID":                "7",
+				"CI_PROJECT_ID":                       "1234",
+				"CI_API_V4_URL":                       "https://gitlab.com/api/v4",
+			},
+			expected: expected(Build{Branch: "feature/b", BaseBranch: "main", CommentUrl: "https://gitlab.com/api/v4/projects/1234/merge_requests/7/notes"}),
+		},
+		{
+			name:     "tag pipeline",
+			env:      map[string]string{"CI_COMMIT_REF_NAME": "v1.2.0", "CI_COMMIT_TAG": "v1.2.0"},
+			expected: expected(Build{Tag: "v1.2.0"}),
+		},
+		{
+			name:     "project url with trailing slash",
+			env:      map[string]string{"CI_PROJECT_URL": "https://gitlab.com/my-group/my-project/"},
+			expected: expected(Build{Branch: "feature/a"}),
+		},
+		{
+			name:     "no project url",
+			env:      map[string]string{"CI_PROJECT_URL": ""},
+			expected: Build{RepoType: "gitlab", RepoName: "my-project", Dir: "/builds/my-group/my-project", DefaultBranch: "main", UpdateSequenceId: 42, Branch: "feature/a"},
+		},
+	})
+}
+
+func TestCircleCI(t *testing.T) {
+	base := map[string]string{
+		"CIRCLECI":                 "true",
+		"HOME":                     "/home/circleci",
+		"CIRCLE_PROJECT_REPONAME":  "ld-find-code-refs",
+		"CIRCLE_REPOSITORY_URL":    "git@github.com:launchdarkly/ld-find-code-refs.git",
+		"CIRCLE_WORKING_DIRECTORY": "~/project",
+		"CIRCLE_SHA1":              "4b2c3fd",
+		"CIRCLE_BUILD_NUM":         "311",
+	}
+	expected := func(b Build) Build {
+		b.RepoType = "github"
+		b.RepoName = "ld-find-code-refs"
+		b.RepoUrl = "https://github.com/launchdarkly/ld-find-code-refs"
+		b.Dir = "/home/circleci/project"
+		b.UpdateSequenceId = 311
+		return b
+	}
+	testProvider(t, CircleCI, base, []providerSpec{
+		{name: "branch", env: map[string]string{"CIRCLE_BRANCH": "feature/a"}, expected: expected(Build{Branch: "feature/a"})},
+		{name: "tag", env: map[string]string{"CIRCLE_TAG": "v1.2.0"}, expected: expected(Build{Tag: "v1.2.0"})},
+		{
+			name: "absolute working directory on a custom host",
+			env: map[string]string{
+				"CIRCLE_BRANCH":            "main",
+				"CIRCLE_WORKING_DIRECTORY": "/src",
+				"CIRCLE_REPOSITORY_URL":    "git@git.example.com:launchdarkly/ld-find-code-refs.git",
+			},
+			expected: Build{RepoType: "custom", RepoName: "ld-find-code-refs", RepoUrl: "https://git.example.com/launchdarkly/ld-find-code-refs", Dir: "/src", UpdateSequenceId: 311, Branch: "main"},
+		},
+	})
+}
+
+func TestJenkins(t *testing.T) {
+	base := map[string]string{
+		"JENKINS_URL":  "https://jenkins.example.com/",
+		"GIT_URL":      "https://bitbucket.org/launchdarkly/repo.git",
+		"GIT_COMMIT":   "4b2c3fd",
+		"WORKSPACE":    "/var/jenkins_home/workspace/repo",
+		"BUILD_NUMBER": "15",
+	}
+	expected := func(b Build) Build {
+		b.RepoType = "bitbucket"
+		b.RepoName = "repo"
+		b.RepoUrl = "https://bitbucket.org/launchdarkly/repo"
+		b.Dir = "/var/jenkins_home/workspace/repo"
+		b.UpdateSequenceId = 15
+		return b
+	}
+	testProvider(t, Jenkins, base, []providerSpec{
+		{name: "git plugin", env: map[string]string{"GIT_BRANCH": "origin/feature/a"}, expected: expected(Build{Branch: "feature/a"})},
+		{name: "git plugin with full ref", env: map[string]string{"GIT_BRANCH": "refs/remotes/origin/main"}, expected: expected(Build{Branch: "main"})},
+		{name: "multibranch pipeline", env: map[string]string{"BRANCH_NAME": "feature/a", "GIT_BRANCH": "feature/a"}, expected: expected(Build{Branch: "feature/a"})},
+		{name: "pull request", env: map[string]string{"BRANCH_NAME": "PR-1", "CHANGE_BRANCH": "feature/b", "CHANGE_TARGET": "main"}, expected: expected(Build{Branch: "feature/b", BaseBranch: "main"})},
+		{name: "tag", env: map[string]string{"BRANCH_NAME": "v1.2.0", "TAG_NAME": "v1.2.0"}, expected: expected(Build{Tag: "v1.2.0"})},
+	})
+}
+
+func TestAzurePipelines(t *testing.T) {
+	base := map[string]string{
+		"TF_BUILD":                  "True",
+		"BUILD_REPOSITORY_PROVIDER": "TfsGit",
+		"BUILD_REPOSITORY_NAME":     "repo",
+		"BUILD_REPOSITORY_URI":      "https://launchdarkly@dev.azure.com/launchdarkly/project/_git/repo",
+		"BUILD_SOURCESDIRECTORY":    "/home/vsts/work/1/s",
+		"BUILD_SOURCEVERSION":       "4b2c3fd",
+		"BUILD_BUILDID":             "1024",
+		"BUILD_SOURCEBRANCH":        "refs/heads/feature/a",
+	}
+	expected := func(b Build) Build {
+		if b.RepoType == "" {
+			b.RepoType = "custom"
+			b.RepoName = "repo"
+			b.RepoUrl = "https://dev.azure.com/launchdarkly/project/_git/repo"
+		}
+		b.Dir = "/home/vsts/work/1/s"
+		b.UpdateSequenceId = 1024
+		return b
+	}
+	testProvider(t, AzurePipelines, base, []providerSpec{
+		{name: "branch", expected: expected(Build{Branch: "feature/a"})},
+		{name: "tag", env: map[string]string{"BUILD_SOURCEBRANCH": "refs/tags/v1.2.0"}, expected: expected(Build{Tag: "v1.2.0"})},
+		{
+			name: "pull request",
+			env: map[string]string{
+				"BUILD_SOURCEBRANCH":              "refs/pull/1/merge",
+				"SYSTEM_PULLREQUEST_SOURCEBRANCH": "refs/heads/feature/b",
+				"SYSTEM_PULLREQUEST_TARGETBRANCH": "refs/heads/main",
+			},
+			expected: expected(Build{Branch: "feature/b", BaseBranch: "main"}),
+		},
+		{
+			name: "GitHub repository",
+			env: map[string]string{
+				"BUILD_REPOSITORY_PROVIDER": "GitHub",
+				"BUILD_REPOSITORY_NAME":     "launchdarkly/ld-find-code-refs",
+				"BUILD_REPOSITORY_URI":      "https://github.com/launchdarkly/ld-find-code-refs.git",
+			},
+			expected: expected(Build{RepoType: "github", RepoName: "ld-find-code-refs", RepoUrl: "https://github.com/launchdarkly/ld-find-code-refs", Branch: "feature/a"}),
+		},
+		{name: "invalid ref", env: map[string]string{"BUILD_SOURCEBRANCH": "refs/pull/1/merge"}, expectError: true},
+	})
+}
+
+func TestBuildkite(t *testing.T) {
+	base := map[string]string{
+		"BUILDKITE":                         "true",
+		"BUILDKITE_REPO":                    "git@gitlab.com:launchdarkly/repo.git",
+		"BUILDKITE_BUILD_CHECKOUT_PATH":     "/buildkite/builds/agent/launchdarkly/repo",
+		"BUILDKITE_COMMIT":                  "4b2c3fd",
+		"BUILDKITE_PIPELINE_DEFAULT_BRANCH": "main",
+		"BUILDKITE_BUILD_NUMBER":            "88",
+		"BUILDKITE_BRANCH":                  "feature/a",
+	}
+	expected := func(b Build) Build {
+		b.RepoType = "gitlab"
+		b.RepoName = "repo"
+		b.RepoUrl = "https://gitlab.com/launchdarkly/repo"
+		b.Dir = "/buildkite/builds/agent/launchdarkly/repo"
+		b.DefaultBranch = "main"
+		b.UpdateSequenceId = 88
+		return b
+	}
+	testProvider(t, Buildkite, base, []providerSpec{
+		{name: "branch", expected: expected(Build{Branch: "feature/a"})},
+		{name: "tag", env: map[string]string{"BUILDKITE_BRANCH": "v1.2.0", "BUILDKITE_TAG": "v1.2.0"}, expected: expected(Build{Tag: "v1.2.0"})},
+		{name: "not a pull request", env: map[string]string{"BUILDKITE_PULL_REQUEST": "false"}, expected: expected(Build{Branch: "feature/a"})},
+		{
+			name:     "pull request",
+			env:      map[string]string{"BUILDKITE_PULL_REQUEST": "5", "BUILDKITE_PULL_REQUEST_BASE_BRANCH": "main"},
+			expected: expected(Build{Branch: "feature/a", BaseBranch: "main"}),
+		},
+	})
+}
+
+func TestTeamCity(t *testing.T) {
+	base := map[string]string{
+		"TEAMCITY_VERSION": "2020.1",
+		"BUILD_VCS_NUMBER": "4b2c3fd",
+	}
+	testProvider(t, TeamCity, base, []providerSpec{
+		{name: "build number", env: map[string]string{"BUILD_NUMBER": "53"}, expected: Build{UpdateSequenceId: 53}},
+		{name: "custom build number", env: map[string]string{"BUILD_NUMBER": "1.4.53"}, expected: Build{}},
+	})
+}
+
+func TestTravis(t *testing.T) {
+	base := map[string]string{
+		"TRAVIS":              "true",
+		"TRAVIS_REPO_SLUG":    "launchdarkly/ld-find-code-refs",
+		"TRAVIS_BUILD_DIR":    "/home/travis/build/launchdarkly/ld-find-code-refs",
+		"TRAVIS_COMMIT":       "4b2c3fd",
+		"TRAVIS_BUILD_NUMBER": "401",
+		"TRAVIS_BRANCH":       "feature/a",
+	}
+	expected := func(b Build) Build {
+		b.RepoType = "github"
+		b.RepoName = "ld-find-code-refs"
+		b.RepoUrl = "https://github.com/launchdarkly/ld-find-code-refs"
+		b.Dir = "/home/travis/build/launchdarkly/ld-find-code-refs"
+		b.UpdateSequenceId = 401
+		return b
+	}
+	testProvider(t, Travis, base, []providerSpec{
+		{name: "branch", expected: expected(Build{Branch: "feature/a"})},
+		{name: "pull request", env: map[string]string{"TRAVIS_BRANCH": "main", "TRAVIS_PULL_REQUEST_BRANCH": "feature/b"}, expected: expected(Build{Branch: "feature/b", BaseBranch: "main"})},
+		{name: "tag", env: map[string]string{"TRAVIS_BRANCH": "v1.2.0", "TRAVIS_TAG": "v1.2.0"}, expected: expected(Build{Tag: "v1.2.0"})},
+	})
+}
@@ -1,6 +1,7 @@
 package command
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os/exec"
@@ -9,8 +10,9 @@ import (
 	"runtime"
 	"strings"
 
+	"github.com/launchdarkly/ld-find-code-refs/internal/filetype"
+	"github.com/launchdarkly/ld-find-code-refs/internal/ignore"
 	"github.com/launchdarkly/ld-find-code-refs/internal/log"
-	"github.com/launchdarkly/ld-find-code-refs/internal/validation"
 )
 
 /*
@@ -46,15 +48,32 @@ func DelimCost(delims []rune) int {
 	return len(delims) * 2
 }
 
+// SuppressionMarker starts comments which exclude flag references from the results, e.g.
+// `// ld-find-code-refs:ignore=my-flag,other-flag`, `ld-find-code-refs:ignore-start` and `ld-find-code-refs:ignore-end`
+const SuppressionMarker = "ld-find-code-refs:ignore"
+
 type Searcher interface {
-	SearchForFlags(flags []string, ctxLines int, delimiters []rune) ([][]string, error)
+	SearchForFlags(ctx context.Context, flags []string, ctxLines int, delimiters []rune) ([][]string, error)
+	// SearchForSuppressions finds every line containing SuppressionMarker
+	SearchForSuppressions(ctx context.Context) ([][]string, error)
 }
 
 type AgClient struct {
 	workspace string
+	ignores   *ignore.Matcher
+	// exclusions are names excluded by the root `.ldignore` file, which ag skips without reading them
+	exclusions []string
+	// skipVCSIgnores stops ag from reading .gitignore and .hgignore files
+	skipVCSIgnores bool
+	skip           filetype.Options
+	// skipped records the category of each skipped file, and excluded is set for every other file found by a search
+	skipped  map[string]filetype.Category
+	excluded map[string]bool
 }
 
-func NewAgClient(path string) (*AgClient, error) {
+// NewAgClient returns a client searching the directory at path. Files ignored by `.ldignore` files, and any other
+// ignore files selected by ignoreOpts, are excluded from search results, as are files of the types selected by skip.
+func NewAgClient(path string, ignoreOpts ignore.Options, skip filetype.Options) (*AgClient, error) {
 	if !filepath.IsAbs(path) {
 		log.Fatal.Fatalf("expected an absolute path but received a relative path: %s", path)
 	}
@@ -63,28 +82,55 @@ func NewAgClient(path string) (*AgClient, error) {
 		return nil, errors.New("ag (The Silver Searcher) is a required dependency, but was not found in the system PATH")
 	}
 
-	return &AgClient{workspace: path}, nil
+	ignores := ignore.NewMatcher(path, ignoreOpts)
+	return &AgClient{
+		workspace:      path,
+		ignores:        ignores,
+		exclusions:     ignores.SearchExclusions(),
+		skipVCSIgnores: !ignoreOpts.GitIgnore,
+		skip:           skip,
+		skipped:        map[string]filetype.Category{},
+		excluded:       map[string]bool{},
+	}, nil
 }
 
-func (c *AgClient) SearchForFlags(flags []string, ctxLines int, delimiters []rune) ([][]string, error) {
-	args := []string{"--nogroup", "--case-sensitive"}
-	ignoreFileName := ".ldignore"
-	pathToIgnore := filepath.Join(c.workspace, ignoreFileName)
-	if validation.FileExists(pathToIgnore) {
-		log.Debug.Printf("excluding files matched in %s", ignoreFileName)
-		args = append(args, fmt.Sprintf("--path-to-ignore=%s", pathToIgnore))
-	}
+func (c *AgClient) SearchForFlags(ctx context.Context, flags []string, ctxLines int, delimiters []rune) ([][]string, error) {
+	args := []string{}
 	if ctxLines > 0 {
 		args = append(args, fmt.Sprintf("-C%d", ctxLines))
 	}
 
 	searchPattern := generateSearchPattern(flags, delimiters, runtime.GOOS == windows)
+	return c.search(ctx, args, searchPattern)
+}
+
+func (c *AgClient) SearchForSuppressions(ctx context.Context) ([][]string, error) {
+	return c.search(ctx, []string{"--literal"}, SuppressionMarker)
+}
+
+func (c *AgClient) search(ctx context.Context, extraArgs []string, searchPattern string) ([][]string, error) {
+	args := []string{"--nogroup", "--case-sensitive"}
+	if c.skipVCSIgnores {
+		args = append(args, "--skip-vcs-ignores")
+	}
+	if !c.skip.Binary {
+		args = append(args, "--search-binary")
+	}
+	for _, name := range c.exclusions {
+		args = append(args, "--ignore", name)
+	}
+	args = append(args, extraArgs...)
+
 	/* #nosec */
-	cmd := exec.Command("ag", args...)
+	cmd := exec.CommandContext(ctx, "ag", args...)
 	cmd.Args = append(cmd.Args, searchPattern, c.workspace)
 	out, err := cmd.CombinedOutput()
 	res := string(out)
 	if err != nil {
+		// if the context was cancelled or timed out, ag was killed and its output is incomplete
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		if err.Error() == "exit status 1" {
 			return nil, nil
 		} else if strings.Contains(res, SearchTooLargeErr.Error()) ||
@@ -105,7 +151,50 @@ func (c *AgClient) SearchForFlags(flags []string, ctxLines int, delimiters []run
 	}
 
 	ret := searchRegexWithFilteredPath.FindAllStringSubmatch(output, -1)
-	return ret, err
+	return c.withoutExcludedFiles(ret), err
+}
+
+// withoutExcludedFiles removes search results in ignored and skipped files. ag's own support for ignore files doesn't
+// follow `.gitignore` semantics closely enough, e.g. for negated patterns, so `.ldignore` files are applied here, and
+// only names which are excluded regardless of other patterns are passed to ag.
+func (c *AgClient) withoutExcludedFiles(results [][]string) [][]string {
+	filtered := results[:0]
+	for _, r := range results {
+		path := r[1]
+		if _, ok := c.excluded[path]; !ok {
+			c.excluded[path] = c.excludes(path)
+		}
+		if !c.excluded[path] {
+			filtered = append(filtered, r)
+		}
+	}
+	return filtered
+}
+
+func (c *AgClient) excludes(path string) bool {
+	if c.ignores != nil && c.ignores.Ignored(path, false) {
+		return true
+	}
+	category, err := c.skip.Skip(filepath.Join(c.workspace, filepath.FromSlash(path)))
+	if err != nil {
+		log.Warning.Printf("could not detect the type of %s: %s", path, err)
+		return false
+	}
+	if category != "" {
+		log.Debug.Printf("skipping %s file %s", category, path)
+		c.skipped[path] = category
+		return true
+	}
+	return false
+}
+
+// SkippedFiles returns the number of files found by searches which were skipped, by category
+func (c *AgClient) SkippedFiles() map[filetype.Category]int {
+	counts := map[filetype.Category]int{}
+	for _, category := range c.skipped {
+		counts[category]++
+	}
+	return counts
 }
 
 func generateFlagRegex(flags []string) string {
@@ -1,24 +1,32 @@
 package command
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/launchdarkly/ld-find-code-refs/internal/log"
-	o "github.com/launchdarkly/ld-find-code-refs/internal/options"
 )
 
+// TagRefPrefix prefixes the names of tags recorded as branches, so that they can't collide with branch names
+const TagRefPrefix = "refs/tags/"
+
 type GitClient struct {
 	workspace string
+	// GitBranch is the name of the current branch, or the full ref of a tag, e.g. `refs/tags/v2.3.0`
 	GitBranch string
 	GitSha    string
 }
 
-func NewGitClient(path string) (GitClient, error) {
+// NewGitClient reads the current branch and commit of the repository at path. If branch is provided, it is used
+// instead of the checked out branch name.
+func NewGitClient(ctx context.Context, path, branch string) (GitClient, error) {
 	if !filepath.IsAbs(path) {
 		log.Fatal.Fatalf("expected an absolute path but received a relative path: %s", path)
 	}
@@ -30,7 +38,7 @@ func NewGitClient(path string) (GitClient, error) {
 		return client, errors.New("git is a required dependency, but was not found in the system PATH")
 	}
 
-	currBranch, err := client.branchName()
+	currBranch, err := client.branchName(ctx, branch)
 	if err != nil {
 		return client, fmt.Errorf("error parsing git branch name: %s", err)
 	} else if currBranch == "" {
@@ -39,7 +47,7 @@ func NewGitClient(path string) (GitClient, error) {
 	log.Info.Printf("git branch: %s", currBranch)
 	client.GitBranch = currBranch
 
-	head, err := client.headSha()
+	head, err := client.headSha(ctx)
 	if err != nil {
 		return client, fmt.Errorf("error parsing current commit sha: %s", err)
 	}
@@ -48,18 +56,69 @@ func NewGitClient(path string) (GitClient, error) {
 	return client, nil
 }
 
-func (c GitClient) branchName() (string, error) {
+// NewGitTagClient reads the commit of a tag in the repository at path. The tag must be checked out, since the
+// working tree is scanned.
+func NewGitTagClient(ctx context.Context, path, tag string) (GitClient, error) {
+	if !filepath.IsAbs(path) {
+		log.Fatal.Fatalf("expected an absolute path but received a relative path: %s", path)
+	}
+
+	client := GitClient{workspace: path, GitBranch: TagRefPrefix + tag}
+
+	_, err := exec.LookPath("git")
+	if err != nil {
+		return client, errors.New("git is a required dependency, but was not found in the system PATH")
+	}
+
+	/* #nosec */
+	cmd := exec.CommandContext(ctx, "git", "-C", client.workspace, "rev-parse", "--verify", "--quiet", TagRefPrefix+tag+"^{commit}")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if ctx.Err() != nil {
+			return client, ctx.Err()
+		}
+		return client, fmt.Errorf("tag %s was not found", tag)
+	}
+	tagSha := strings.TrimSpace(string(out))
+
+	head, err := client.headSha(ctx)
+	if err != nil {
+		return client, fmt.Errorf("error parsing current commit sha: %s", err)
+	}
+	if head != tagSha {
+		return client, fmt.Errorf("git repo at %s must be checked out to tag %s (%s), but HEAD is %s", client.workspace, tag, tagSha, head)
+	}
+	log.Info.Printf("git tag: %s", tag)
+	client.GitSha = head
+
+	return client, nil
+}
+
+// NewGitWorkspaceClient returns a client for the repository at path without reading its current branch or commit, so
+// that uncommitted changes can be read from a repository in any state, including one without commits
+func NewGitWorkspaceClient(path string) (GitClient, error) {
+	if !filepath.IsAbs(path) {
+		log.Fatal.Fatalf("expected an absolute path but received a relative path: %s", path)
+	}
+	_, err := exec.LookPath("git")
+	if err != nil {
+		return GitClient{}, errors.New("git is a required dependency, but was not found in the system PATH")
+	}
+	return GitClient{workspace: path}, nil
+}
+
+func (c GitClient) branchName(ctx context.Context, branch string) (string, error) {
 	// Some CI systems leave the repository in a detached HEAD state. To support those, this logic allows
 	// users to pass the branch name in by hand as an option.
-	if o.Branch.Value() != "" {
-		return o.Branch.Value(), nil
+	if branch != "" {
+		return branch, nil
 	}
 
 	/* #nosec */
-	cmd := exec.Command("git", "-C", c.workspace, "rev-parse", "--abbrev-ref", "HEAD")
+	cmd := exec.CommandContext(ctx, "git", "-C", c.workspace, "rev-parse", "--abbrev-ref", "HEAD")
 	out, err := cmd.CombinedOutput()
 	if err != nil {
-		return "", errors.New(string(out))
+		return "", gitError(ctx, out)
 	}
 	ret := strings.TrimSpace(string(out))
 	log.Debug.Printf("identified branch name: %s", ret)
@@ -69,24 +128,24 @@ func (c GitClient) branchName() (string, error) {
 	return ret, nil
 }
 
-func (c GitClient) headSha() (string, error) {
+func (c GitClient) headSha(ctx context.Context) (string, error) {
 	/* #nosec */
-	cmd := exec.Command("git", "-C", c.workspace, "rev-parse", "HEAD")
+	cmd := exec.CommandContext(ctx, "git", "-C", c.workspace, "rev-parse", "HEAD")
 	out, err := cmd.CombinedOutput()
 	if err != nil {
-		return "", errors.New(string(out))
+		return "", gitError(ctx, out)
 	}
 	ret := strings.TrimSpace(string(out))
 	log.Debug.Printf("identified head sha: %s", ret)
 	return ret, nil
 }
 
-func (c GitClient) RemoteBranches() (map[string]bool, error) {
+func (c GitClient) RemoteBranches(ctx context.Context) (map[string]bool, error) {
 	/* #nosec */
-	cmd := exec.Command("git", "-C", c.workspace, "ls-remote", "--quiet", "--heads")
+	cmd := exec.CommandContext(ctx, "git", "-C", c.workspace, "ls-remote", "--quiet", "--heads")
 	out, err := cmd.CombinedOutput()
 	if err != nil {
-		return nil, errors.New(string(out))
+		return nil, gitError(ctx, out)
 	}
 	rgx := regexp.MustCompile("refs/heads/(.*)")
 	results := rgx.FindAllStringSubmatch(string(out), -1)
@@ -99,3 +158,136 @@ func (c GitClient) RemoteBranches() (map[string]bool, error) {
 	ret[c.GitBranch] = true
 	return ret, nil
 }
+
+// gitError prefers the context error over git's output, since a killed git process produces no useful output
+func gitError(ctx context.Context, out []byte) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return errors.New(string(out))
+}
+
+// TrackingBranches lists the branches of the repository's remotes known locally, from `refs/remotes`, without
+// accessing the network. Branches of every remote are included.
+func (c GitClient) TrackingBranches(ctx context.Context) (map[string]bool, error) {
+	/* #nosec */
+	cmd := exec.CommandContext(ctx, "git", "-C", c.workspace, "for-each-ref", "--format=%(refname)", "refs/remotes/")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, gitError(ctx, out)
+	}
+	ret := map[string]bool{}
+	for _, ref := range strings.Fields(string(out)) {
+		// refs/remotes/<remote>/<branch>
+		parts := strings.SplitN(ref, "/", 4)
+		if len(parts) < 4 || parts[3] == "HEAD" {
+			continue
+		}
+		ret[parts[3]] = true
+	}
+	log.Debug.Printf("found %d branches in refs/remotes", len(ret))
+	return ret, nil
+}
+
+// GitDir returns the absolute path of the repository's git directory, e.g. `.git` in the root of the working tree
+func (c GitClient) GitDir(ctx context.Context) (string, error) {
+	/* #nosec */
+	cmd := exec.CommandContext(ctx, "git", "-C", c.workspace, "rev-parse", "--absolute-git-dir")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", gitError(ctx, out)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// AddedLine is a line added to a file by uncommitted changes
+type AddedLine struct {
+	LineNum int
+	Text    string
+}
+
+// FileChanges lists the lines added to a file, with its path relative to the workspace, which may be a subdirectory of
+// the working tree
+type FileChanges struct {
+	Path  string
+	Lines []AddedLine
+}
+
+// Changes returns the lines added by the changes staged for commit if staged is set, and otherwise by all changes to
+// the working tree since the last commit. Only changes within the workspace are returned, and deleted files are omitted.
+func (c GitClient) Changes(ctx context.Context, staged bool) ([]FileChanges, error) {
+	args := []string{"-C", c.workspace, "-c", "core.quotePath=false", "diff", "--relative", "--no-color", "--no-ext-diff", "--no-renames", "--unified=0", "--diff-filter=d"}
+	if staged {
+		args = append(args, "--cached")
+	} else {
+		base := "HEAD"
+		/* #nosec */
+		if exec.CommandContext(ctx, "git", "-C", c.workspace, "rev-parse", "--verify", "--quiet", "HEAD").Run() != nil {
+			// before the first commit, all changes are compared with an empty tree
+			var err error
+			base, err = c.emptyTree(ctx)
+			if err != nil {
+				return nil, err
+			}
+		}
+		args = append(args, base)
+	}
+	/* #nosec */
+	cmd := exec.CommandContext(ctx, "git", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, gitError(ctx, stderr.Bytes())
+	}
+	return parseDiff(string(out)), nil
+}
+
+// emptyTree returns the id of an empty tree, which doesn't need to exist in the repository
+func (c GitClient) emptyTree(ctx context.Context) (string, error) {
+	/* #nosec */
+	cmd := exec.CommandContext(ctx, "git", "-C", c.workspace, "hash-object", "-t", "tree", "--stdin")
+	out, err := cmd.Output()
+	if err != nil {
+		return "", gitError(ctx, out)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+var hunkHeaderRegex = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,\d+)? @@`)
+
+// parseDiff reads the lines added to each file from a diff with no context lines
+func parseDiff(diff string) []FileChanges {
+	ret := []FileChanges{}
+	var file *FileChanges
+	// added lines may start with "++ ", so file headers are only read before the first hunk of each file
+	inHeader := false
+	lineNum := 0
+	for _, line := range strings.Split(diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			file = nil
+			inHeader = true
+		case inHeader && strings.HasPrefix(line, "+++ "):
+			path := strings.TrimSuffix(line[len("+++ "):], "\t")
+			if unquoted, err := strconv.Unquote(path); err == nil {
+				path = unquoted
+			}
+			if path == "/dev/null" {
+				continue
+			}
+			ret = append(ret, FileChanges{Path: strings.TrimPrefix(path, "b/")})
+			file = &ret[len(ret)-1]
+		case strings.HasPrefix(line, "@@ "):
+			inHeader = false
+			match := hunkHeaderRegex.FindStringSubmatch(line)
+			if match != nil {
+				lineNum, _ = strconv.Atoi(match[1])
+			}
+		case !inHeader && strings.HasPrefix(line, "+") && file != nil:
+			file.Lines = append(file.Lines, AddedLine{LineNum: lineNum, Text: strings.TrimSuffix(line[1:], "\r")})
+			lineNum++
+		}
+	}
+	return ret
+}
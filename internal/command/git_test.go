@@ -0,0 +1,109 @@
+package command
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDiff(t *testing.T) {
+	diff := `diff --git a/app.js b/app.js
+index 1e2b3c4..5f6a7b8 100644
+--- a/app.js
++++ b/app.js
+@@ -2,0 +3,2 @@ function main() {
++  if (client.variation('new-flag')) {
++++ counter
+@@ -10 +12 @@ function render() {
+-  return old;
++  return renderer;
+\ No newline at end of file
+diff --git a/removed.js b/removed.js
+deleted file mode 100644
+--- a/removed.js
++++ /dev/null
+@@ -1 +0,0 @@
+-client.variation('old-flag')
+diff --git "a/dir/quo\"te.go" "b/dir/quo\"te.go"
+new file mode 100644
+--- /dev/null
++++ "b/dir/quo\"te.go"
+@@ -0,0 +1 @@
++const flag = "go-flag"
+diff --git a/image.png b/image.png
+Binary files a/image.png and b/image.png differ
+`
+	assert.Equal(t, []FileChanges{
+		{Path: "app.js", Lines: []AddedLine{
+			{LineNum: 3, Text: "  if (client.variation('new-flag')) {"},
+			{LineNum: 4, Text: "++ counter"},
+			{LineNum: 12, Text: "  return renderer;"},
+		}},
+		{Path: `dir/quo"te.go`, Lines: []AddedLine{
+			{LineNum: 1, Text: `const flag = "go-flag"`},
+		}},
+	}, parseDiff(diff))
+}
+
+func TestChanges(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir, err := ioutil.TempDir("", "git-changes")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	git := func(args ...string) {
+		out, err := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...).CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	write := func(name, content string) {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+
+	git("init", "-q")
+	write("committed.txt", "one\n")
+	client, err := NewGitWorkspaceClient(dir)
+	require.NoError(t, err)
+	initial, err := client.Changes(context.Background(), false)
+	require.NoError(t, err)
+	assert.Equal(t, []FileChanges{}, initial, "untracked files are not changes")
+	git("add", ".")
+	initial, err = client.Changes(context.Background(), false)
+	require.NoError(t, err)
+	assert.Equal(t, []FileChanges{{Path: "committed.txt", Lines: []AddedLine{{LineNum: 1, Text: "one"}}}}, initial)
+	git("commit", "-q", "-m", "initial")
+	write("committed.txt", "one\ntwo\n")
+	write("staged.txt", "staged\n")
+	git("add", "staged.txt")
+
+	staged, err := client.Changes(context.Background(), true)
+	require.NoError(t, err)
+	assert.Equal(t, []FileChanges{{Path: "staged.txt", Lines: []AddedLine{{LineNum: 1, Text: "staged"}}}}, staged)
+
+	all, err := client.Changes(context.Background(), false)
+	require.NoError(t, err)
+	assert.Equal(t, []FileChanges{
+		{Path: "committed.txt", Lines: []AddedLine{{LineNum: 2, Text: "two"}}},
+		{Path: "staged.txt", Lines: []AddedLine{{LineNum: 1, Text: "staged"}}},
+	}, all)
+
+	gitDir, err := client.GitDir(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, ".git", filepath.Base(gitDir))
+
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0755))
+	write(filepath.Join("sub", "nested.txt"), "nested\n")
+	git("add", ".")
+	subClient, err := NewGitWorkspaceClient(filepath.Join(dir, "sub"))
+	require.NoError(t, err)
+	sub, err := subClient.Changes(context.Background(), true)
+	require.NoError(t, err)
+	assert.Equal(t, []FileChanges{{Path: "nested.txt", Lines: []AddedLine{{LineNum: 1, Text: "nested"}}}}, sub,
+		"paths are relative to the workspace, and changes outside it are omitted")
+}
@@ -0,0 +1,149 @@
+package filetype
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Category is a kind of file which is skipped by the scanner
+type Category string
+
+const (
+	Binary    Category = "binary"
+	Minified  Category = "minified"
+	Generated Category = "generated"
+	TooLarge  Category = "too large"
+)
+
+// Categories lists every category, in the order they are checked
+var Categories = []Category{TooLarge, Binary, Generated, Minified}
+
+const (
+	// sampleSize is the number of bytes read from the start of a file to detect its type
+	sampleSize = 64 * 1024
+	// binarySampleSize matches the number of bytes git checks for NUL bytes to detect binary files
+	binarySampleSize = 8000
+	// generatedHeaderLines is the number of lines at the start of a file searched for generated code markers
+	generatedHeaderLines = 10
+
+	minifiedAverageLineLength = 500
+	minifiedLongLineLength    = 1000
+	minifiedWhitespaceRatio   = 0.1
+)
+
+var (
+	generatedMarkers = []*regexp.Regexp{
+		regexp.MustCompile(`Code generated .* DO NOT EDIT\.`),
+		regexp.MustCompile(`@generated\b`),
+		regexp.MustCompile(`<auto-generated`),
+		regexp.MustCompile(`(?i)this file (?:is|was|has been) (?:automatically|auto-?)\s?generated`),
+		regexp.MustCompile(`(?i)generated by .*do not (?:edit|modify)`),
+	}
+
+	minifiableExtensions = map[string]bool{".js": true, ".mjs": true, ".cjs": true, ".css": true, ".map": true}
+)
+
+// Options selects the categories of files which are skipped
+type Options struct {
+	Binary    bool
+	Minified  bool
+	Generated bool
+	// MaxSize is the size in bytes above which files are skipped. If 0, files of any size are scanned.
+	MaxSize int64
+}
+
+// Skip returns the category of the file at path if it should be skipped, or an empty category if it should be scanned
+func (o Options) Skip(path string) (Category, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if o.MaxSize > 0 && info.Size() > o.MaxSize {
+		return TooLarge, nil
+	}
+	if !o.Binary && !o.Generated && !o.Minified {
+		return "", nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	sample := make([]byte, sampleSize)
+	n, err := io.ReadFull(f, sample)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	sample = sample[:n]
+
+	switch {
+	case o.Binary && IsBinary(sample):
+		return Binary, nil
+	case o.Generated && IsGenerated(sample):
+		return Generated, nil
+	case o.Minified && minifiableExtensions[strings.ToLower(filepath.Ext(path))] && IsMinified(filepath.Base(path), sample):
+		return Minified, nil
+	}
+	return "", nil
+}
+
+// IsBinary reports whether the start of a file contains a NUL byte, as git does
+func IsBinary(sample []byte) bool {
+	if len(sample) > binarySampleSize {
+		sample = sample[:binarySampleSize]
+	}
+	return bytes.IndexByte(sample, 0) >= 0
+}
+
+// IsGenerated reports whether the first lines of a file contain a marker conventionally used by code generators,
+// such as `// Code generated by protoc-gen-go. DO NOT EDIT.`
+func IsGenerated(sample []byte) bool {
+	lines := bytes.SplitN(sample, []byte("\n"), generatedHeaderLines+1)
+	if len(lines) > generatedHeaderLines {
+		lines = lines[:generatedHeaderLines]
+	}
+	for _, line := range lines {
+		for _, marker := range generatedMarkers {
+			if marker.Match(line) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsMinified reports whether a file named name, starting with sample, looks minified. Files named like `app.min.js`
+// are minified, as are files with very long lines on average, or long lines with little whitespace.
+func IsMinified(name string, sample []byte) bool {
+	if strings.Contains(strings.ToLower(name), ".min.") {
+		return true
+	}
+	if len(sample) == 0 {
+		return false
+	}
+
+	lines := bytes.Split(bytes.TrimRight(sample, "\n"), []byte("\n"))
+	if len(sample)/len(lines) > minifiedAverageLineLength {
+		return true
+	}
+	for _, line := range lines {
+		if len(line) < minifiedLongLineLength {
+			continue
+		}
+		whitespace := 0
+		for _, c := range line {
+			if c == ' ' || c == '\t' {
+				whitespace++
+			}
+		}
+		if float64(whitespace)/float64(len(line)) < minifiedWhitespaceRatio {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package filetype
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsBinary(t *testing.T) {
+	require.True(t, IsBinary([]byte("PNG\x00\x01")))
+	require.False(t, IsBinary([]byte("const flag = 'my-flag'\n")))
+	require.False(t, IsBinary(append([]byte(strings.Repeat("a", binarySampleSize)), 0)))
+}
+
+func TestIsGenerated(t *testing.T) {
+	specs := []struct {
+		name     string
+		src      string
+		expected bool
+	}{
+		{name: "go", src: "// Code generated by protoc-gen-go. DO NOT EDIT.\n\npackage api\n", expected: true},
+		{name: "go with source", src: "// Code generated by mockery v2.10.0 DO NOT EDIT.\n", expected: true},
+		{name: "generated annotation", src: "/**\n * @generated\n */\n", expected: true},
+		{name: "csharp", src: "//------\n// <auto-generated>\n//     This code was generated by a tool.\n", expected: true},
+		{name: "comment", src: "# This file is automatically generated by bundler.\n", expected: true},
+		{name: "generated by, do not edit", src: "/* Generated by the flag exporter. Do not modify. */\n", expected: true},
+		{name: "handwritten", src: "package main\n\n// generate flags with `go generate`\n", expected: false},
+		{name: "marker after header", src: strings.Repeat("\n", generatedHeaderLines) + "// Code generated by x. DO NOT EDIT.\n", expected: false},
+	}
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, IsGenerated([]byte(tt.src)))
+		})
+	}
+}
+
+func TestIsMinified(t *testing.T) {
+	specs := []struct {
+		name     string
+		fileName string
+		src      string
+		expected bool
+	}{
+		{name: "min file name", fileName: "app.min.js", src: "var a = 1;\n", expected: true},
+		{name: "long lines", fileName: "bundle.js", src: strings.Repeat("a=1;", 200) + "\n" + strings.Repeat("b=2;", 200), expected: true},
+		{name: "long line without whitespace", fileName: "bundle.js", src: strings.Repeat("function f(){}\n", 100) + strings.Repeat("x", minifiedLongLineLength), expected: true},
+		{name: "long line with whitespace", fileName: "app.js", src: strings.Repeat("var a = 1;\n", 100) + strings.Repeat("a b ", minifiedLongLineLength/4), expected: false},
+		{name: "formatted", fileName: "app.js", src: "function f() {\n  return 'my-flag'\n}\n", expected: false},
+		{name: "empty", fileName: "app.js", src: "", expected: false},
+	}
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, IsMinified(tt.fileName, []byte(tt.src)))
+		})
+	}
+}
+
+func TestSkip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ld-filetype")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"image.png":  "PNG\x00\x00",
+		"api.pb.go":  "// Code generated by protoc-gen-go. DO NOT EDIT.\n",
+		"app.min.js": "var a=1;",
+		"data.json":  strings.Repeat("x", 2000),
+		"main.go":    "package main\n",
+	}
+	for name, src := range files {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0600))
+	}
+
+	specs := []struct {
+		name     string
+		opts     Options
+		file     string
+		expected Category
+	}{
+		{name: "binary", opts: Options{Binary: true}, file: "image.png", expected: Binary},
+		{name: "binary disabled", opts: Options{}, file: "image.png", expected: ""},
+		{name: "generated", opts: Options{Generated: true}, file: "api.pb.go", expected: Generated},
+		{name: "minified", opts: Options{Minified: true}, file: "app.min.js", expected: Minified},
+		{name: "only js and css may be minified", opts: Options{Minified: true}, file: "data.json", expected: ""},
+		{name: "too large", opts: Options{Binary: true, MaxSize: 1000}, file: "data.json", expected: TooLarge},
+		{name: "source", opts: Options{Binary: true, Minified: true, Generated: true, MaxSize: 1000}, file: "main.go", expected: ""},
+	}
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			category, err := tt.opts.Skip(filepath.Join(dir, tt.file))
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, category)
+		})
+	}
+
+	_, err = Options{Binary: true}.Skip(filepath.Join(dir, "missing.go"))
+	require.Error(t, err)
+}
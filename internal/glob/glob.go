@@ -0,0 +1,102 @@
+package glob
+
+import (
+	"path"
+	"strings"
+)
+
+// Match reports whether name matches the glob pattern. Patterns follow the syntax of path.Match, with the
+// addition of `**` as a path segment, which matches zero or more directories. A trailing `/**` matches
+// everything inside a directory. Both the pattern and name must use forward slashes.
+func Match(pattern, name string) bool {
+	return matchSegments(split(pattern), split(name))
+}
+
+// MatchAny reports whether name matches any of the glob patterns.
+func MatchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if Match(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Valid reports whether the pattern is well formed.
+func Valid(pattern string) bool {
+	for _, segment := range split(pattern) {
+		if segment == "**" {
+			continue
+		}
+		if _, err := path.Match(segment, ""); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func split(p string) []string {
+	return strings.Split(strings.Trim(p, "/"), "/")
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// collapse repeated wildcards, then try to match the rest of the pattern at every depth
+			for len(pattern) > 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := range name {
+				if matchSegments(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		matched, err := path.Match(pattern[0], name[0])
+		if err != nil || !matched {
+			return false
+		}
+		pattern = pattern[1:]
+		name = name[1:]
+	}
+	return len(name) == 0
+}
+
+// Base returns the leading directories of pattern which contain no wildcards, e.g. `a/b` for `a/b/**/*.go`.
+func Base(pattern string) string {
+	base := []string{}
+	segments := split(pattern)
+	for i, segment := range segments {
+		// the last segment of a pattern names files, not directories
+		if i == len(segments)-1 || strings.ContainsAny(segment, "*?[\\") {
+			break
+		}
+		base = append(base, segment)
+	}
+	return strings.Join(base, "/")
+}
+
+// CommonBase returns the longest directory shared by the bases of all patterns.
+func CommonBase(patterns []string) string {
+	if len(patterns) == 0 {
+		return ""
+	}
+	common := split(Base(patterns[0]))
+	for _, p := range patterns[1:] {
+		segments := split(Base(p))
+		i := 0
+		for i < len(common) && i < len(segments) && common[i] == segments[i] {
+			i++
+		}
+		common = common[:i]
+	}
+	return strings.Join(common, "/")
+}
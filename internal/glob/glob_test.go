@@ -0,0 +1,48 @@
+package glob
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatch(t *testing.T) {
+	specs := []struct {
+		name     string
+		pattern  string
+		path     string
+		expected bool
+	}{
+		{"matches exact path", "a/b.go", "a/b.go", true},
+		{"matches single segment wildcard", "a/*.go", "a/b.go", true},
+		{"single segment wildcard does not cross directories", "a/*.go", "a/b/c.go", false},
+		{"matches everything in a directory", "services/payments/**", "services/payments/api/handler.go", true},
+		{"directory wildcard does not match sibling prefix", "services/payments/**", "services/payments-v2/main.go", false},
+		{"matches zero directories", "a/**/b.go", "a/b.go", true},
+		{"matches many directories", "a/**/b.go", "a/x/y/z/b.go", true},
+		{"matches leading wildcard", "**/*.js", "web/src/app.js", true},
+		{"leading wildcard requires matching suffix", "**/*.js", "web/src/app.ts", false},
+		{"ignores leading and trailing slashes", "/a/b/", "a/b", true},
+		{"pattern longer than path", "a/b/c", "a/b", false},
+		{"invalid pattern never matches", "a/[", "a/[", false},
+	}
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Match(tt.pattern, tt.path))
+		})
+	}
+}
+
+func TestValid(t *testing.T) {
+	assert.True(t, Valid("services/**/*.go"))
+	assert.False(t, Valid("services/[a"))
+}
+
+func TestBase(t *testing.T) {
+	assert.Equal(t, "services/payments", Base("services/payments/**"))
+	assert.Equal(t, "a/b", Base("a/b/*/c.go"))
+	assert.Equal(t, "", Base("**/*.go"))
+	assert.Equal(t, "services/payments", CommonBase([]string{"services/payments/**", "services/payments/*.go"}))
+	assert.Equal(t, "services", CommonBase([]string{"services/payments/**", "services/search/**"}))
+	assert.Equal(t, "", CommonBase(nil))
+}
@@ -0,0 +1,281 @@
+package ignore
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/glob"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+)
+
+const (
+	// FileName is the name of the files listing paths which should not be scanned for flag references
+	FileName = ".ldignore"
+
+	gitIgnoreFileName     = ".gitignore"
+	gitAttributesFileName = ".gitattributes"
+)
+
+// Options selects the ignore files read in addition to `.ldignore` files
+type Options struct {
+	// GitIgnore excludes paths matched by `.gitignore` files
+	GitIgnore bool
+	// GitAttributes excludes paths marked as `linguist-generated` or `linguist-vendored` in `.gitattributes` files
+	GitAttributes bool
+}
+
+// Rule is a pattern read from an ignore file
+type Rule struct {
+	// Source is the path of the file defining the rule, relative to the root directory
+	Source string
+	Line   int
+	// Pattern is the rule as written in the file
+	Pattern string
+	// Negate is set for rules which re-include paths excluded by earlier rules, such as `!important.js`
+	Negate bool
+
+	// base is the directory containing the rule's file, relative to the root directory
+	base     string
+	glob     string
+	dirOnly  bool
+	anchored bool
+}
+
+func (r Rule) String() string {
+	return fmt.Sprintf("%s:%d: %s", r.Source, r.Line, r.Pattern)
+}
+
+func (r Rule) matches(p string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if r.base != "" {
+		if !strings.HasPrefix(p, r.base+"/") {
+			return false
+		}
+		p = strings.TrimPrefix(p, r.base+"/")
+	}
+	if r.anchored {
+		return glob.Match(r.glob, p)
+	}
+	return glob.Match("**/"+r.glob, p)
+}
+
+// Match describes whether a path is ignored
+type Match struct {
+	Ignored bool
+	// Rule is the last rule matching the path, or nil if no rules match. It may be a negated rule which re-included
+	// the path.
+	Rule *Rule
+}
+
+// layer is one kind of ignore file. Each directory may contain a file of each kind, whose rules take precedence over
+// those of its parent directories.
+type layer struct {
+	fileName string
+	parse    func(source, base string, content []byte) []Rule
+	// excluding a directory excludes everything inside it, as in `.gitignore`
+	recursive bool
+	rules     map[string][]Rule
+}
+
+// Matcher decides which paths in a directory tree are ignored. Ignore files are read lazily, as directories
+// containing matches are encountered.
+type Matcher struct {
+	root   string
+	layers []*layer
+}
+
+// NewMatcher returns a matcher for the directory tree at root, following `.ldignore` files and any other ignore
+// files selected by opts.
+func NewMatcher(root string, opts Options) *Matcher {
+	m := &Matcher{root: root}
+	m.layers = append(m.layers, &layer{fileName: FileName, parse: parseIgnore, recursive: true})
+	if opts.GitIgnore {
+		m.layers = append(m.layers, &layer{fileName: gitIgnoreFileName, parse: parseIgnore, recursive: true})
+	}
+	if opts.GitAttributes {
+		for _, attr := range []string{"linguist-generated", "linguist-vendored"} {
+			m.layers = append(m.layers, &layer{fileName: gitAttributesFileName, parse: attributeParser(attr)})
+		}
+	}
+	return m
+}
+
+// Match reports whether p, a slash separated path relative to the root directory, is ignored, and which rule
+// decided it. A path is ignored if any kind of ignore file excludes it.
+func (m *Matcher) Match(p string, isDir bool) Match {
+	p = strings.Trim(path.Clean(filepath.ToSlash(p)), "/")
+	var last *Rule
+	for _, l := range m.layers {
+		rule := m.matchLayer(l, p, isDir)
+		if rule == nil {
+			continue
+		}
+		if !rule.Negate {
+			return Match{Ignored: true, Rule: rule}
+		}
+		last = rule
+	}
+	return Match{Rule: last}
+}
+
+// Ignored reports whether p, a slash separated path relative to the root directory, is ignored
+func (m *Matcher) Ignored(p string, isDir bool) bool {
+	return m.Match(p, isDir).Ignored
+}
+
+// SearchExclusions returns the names of files and directories which the `.ldignore` file in the root directory
+// excludes at any depth, such as `node_modules/`, so that search tools can skip them without reading them. Only
+// patterns without wildcards or slashes are returned, and only if no later negated pattern in the file could
+// re-include them. Search tools may also skip files named like an excluded directory. Other patterns, and nested
+// ignore files, are only applied by Match.
+func (m *Matcher) SearchExclusions() []string {
+	rules := m.rulesIn(m.layers[0], "")
+	names := []string{}
+	for i, r := range rules {
+		if r.Negate || r.anchored || strings.ContainsAny(r.glob, `*?[\`) {
+			continue
+		}
+		reincluded := false
+		for _, later := range rules[i+1:] {
+			if later.Negate && glob.Match(path.Base(later.glob), r.glob) {
+				reincluded = true
+			}
+		}
+		if !reincluded {
+			names = append(names, r.glob)
+		}
+	}
+	return names
+}
+
+func (m *Matcher) matchLayer(l *layer, p string, isDir bool) *Rule {
+	segments := strings.Split(p, "/")
+	if l.recursive {
+		// files inside an excluded directory can't be re-included
+		for i := 1; i < len(segments); i++ {
+			if rule := m.lastMatch(l, segments[:i], true); rule != nil && !rule.Negate {
+				return rule
+			}
+		}
+	}
+	return m.lastMatch(l, segments, isDir)
+}
+
+// lastMatch returns the last rule matching the path, reading rules from the root directory down to the path's parent
+func (m *Matcher) lastMatch(l *layer, segments []string, isDir bool) *Rule {
+	p := strings.Join(segments, "/")
+	var match *Rule
+	for i := 0; i < len(segments); i++ {
+		rules := m.rulesIn(l, strings.Join(segments[:i], "/"))
+		for j := range rules {
+			if rules[j].matches(p, isDir) {
+				match = &rules[j]
+			}
+		}
+	}
+	return match
+}
+
+func (m *Matcher) rulesIn(l *layer, dir string) []Rule {
+	if l.rules == nil {
+		l.rules = map[string][]Rule{}
+	}
+	if rules, ok := l.rules[dir]; ok {
+		return rules
+	}
+
+	source := path.Join(dir, l.fileName)
+	content, err := ioutil.ReadFile(filepath.Join(m.root, filepath.FromSlash(source)))
+	if err != nil && !os.IsNotExist(err) {
+		log.Warning.Printf("could not read %s: %s", source, err)
+	}
+	var rules []Rule
+	if err == nil {
+		log.Debug.Printf("excluding files matched in %s", source)
+		rules = l.parse(source, dir, content)
+	}
+	l.rules[dir] = rules
+	return rules
+}
+
+// parseIgnore reads rules in the `.gitignore` format, see https://git-scm.com/docs/gitignore#_pattern_format
+func parseIgnore(source, base string, content []byte) []Rule {
+	rules := []Rule{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := trimTrailingSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := Rule{Source: source, Line: lineNum, Pattern: line, base: base}
+		pattern := line
+		if strings.HasPrefix(pattern, "!") {
+			rule.Negate = true
+			pattern = pattern[1:]
+		} else if strings.HasPrefix(pattern, `\!`) || strings.HasPrefix(pattern, `\#`) {
+			pattern = pattern[1:]
+		}
+		if strings.HasSuffix(pattern, "/") {
+			rule.dirOnly = true
+			pattern = strings.TrimSuffix(pattern, "/")
+		}
+		// a slash anywhere but the end anchors the pattern to the directory containing the ignore file
+		rule.anchored = strings.Contains(pattern, "/")
+		rule.glob = strings.Replace(strings.TrimPrefix(pattern, "/"), "[!", "[^", -1)
+		if rule.glob == "" || !glob.Valid(rule.glob) {
+			log.Warning.Printf("%s:%d: ignoring invalid pattern %q", source, lineNum, line)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+func trimTrailingSpace(line string) string {
+	trimmed := strings.TrimRight(line, " \t\r")
+	// an escaped trailing space is part of the pattern
+	if strings.HasSuffix(trimmed, `\`) && len(trimmed) < len(strings.TrimRight(line, "\r")) {
+		trimmed += " "
+	}
+	return trimmed
+}
+
+// attributeParser returns a parser for `.gitattributes` files, which excludes paths for which attr is set
+func attributeParser(attr string) func(source, base string, content []byte) []Rule {
+	return func(source, base string, content []byte) []Rule {
+		rules := []Rule{}
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		for lineNum := 1; scanner.Scan(); lineNum++ {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "[") {
+				continue
+			}
+			for _, a := range fields[1:] {
+				var set bool
+				switch a {
+				case attr, attr + "=true":
+					set = true
+				case "-" + attr, "!" + attr, attr + "=false":
+					set = false
+				default:
+					continue
+				}
+				pattern := strings.TrimSuffix(fields[0], "/")
+				rule := Rule{Source: source, Line: lineNum, Pattern: fields[0] + " " + a, Negate: !set, base: base,
+					anchored: strings.Contains(pattern, "/"), glob: strings.TrimPrefix(pattern, "/")}
+				if glob.Valid(rule.glob) {
+					rules = append(rules, rule)
+				}
+			}
+		}
+		return rules
+	}
+}
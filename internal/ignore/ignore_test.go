@@ -0,0 +1,112 @@
+package ignore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+)
+
+func TestMain(m *testing.M) {
+	log.Init(true)
+	os.Exit(m.Run())
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ld-ignore")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	writeFiles(t, dir, map[string]string{
+		".ldignore":      "# build output\n*.log\n!important.log\n/dist\nbuild/\ndocs/**/*.md\n\\#notes\n",
+		"web/.ldignore":  "fixtures\n",
+		"logs/.ldignore": "!*.log\n",
+		".gitignore":     "tmp/\n",
+		".gitattributes": "gen/** linguist-generated\ngen/keep.go -linguist-generated\nthird_party/** linguist-vendored=true\n",
+	})
+
+	specs := []struct {
+		name     string
+		path     string
+		isDir    bool
+		opts     Options
+		expected bool
+		rule     string
+	}{
+		{name: "unmatched", path: "main.go", expected: false},
+		{name: "basename at any depth", path: "a/b/debug.log", expected: true, rule: ".ldignore:2: *.log"},
+		{name: "negated", path: "a/important.log", expected: false, rule: ".ldignore:3: !important.log"},
+		{name: "anchored", path: "dist/app.js", expected: true, rule: ".ldignore:4: /dist"},
+		{name: "anchored pattern doesn't match nested path", path: "web/dist/app.js", expected: false},
+		{name: "directory only pattern matches directory", path: "a/build", isDir: true, expected: true, rule: ".ldignore:5: build/"},
+		{name: "directory only pattern matches contents", path: "a/build/out.js", expected: true, rule: ".ldignore:5: build/"},
+		{name: "directory only pattern doesn't match file", path: "a/build", expected: false},
+		{name: "double star", path: "docs/a/b/intro.md", expected: true, rule: ".ldignore:6: docs/**/*.md"},
+		{name: "escaped hash", path: "#notes", expected: true, rule: ".ldignore:7: \\#notes"},
+		{name: "nested ignore file", path: "web/fixtures/flags.json", expected: true, rule: "web/.ldignore:1: fixtures"},
+		{name: "nested ignore file only applies below its directory", path: "fixtures/flags.json", expected: false},
+		{name: "nested negation", path: "logs/app.log", expected: false, rule: "logs/.ldignore:1: !*.log"},
+		{name: "gitignore not read by default", path: "tmp/a.js", expected: false},
+		{name: "gitignore", path: "tmp/a.js", opts: Options{GitIgnore: true}, expected: true, rule: ".gitignore:1: tmp/"},
+		{name: "gitattributes not read by default", path: "gen/api.go", expected: false},
+		{name: "generated", path: "gen/api.go", opts: Options{GitAttributes: true}, expected: true, rule: ".gitattributes:1: gen/** linguist-generated"},
+		{name: "generated unset", path: "gen/keep.go", opts: Options{GitAttributes: true}, expected: false, rule: ".gitattributes:2: gen/keep.go -linguist-generated"},
+		{name: "vendored", path: "third_party/lib/a.go", opts: Options{GitAttributes: true}, expected: true, rule: ".gitattributes:3: third_party/** linguist-vendored=true"},
+	}
+
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMatcher(dir, tt.opts)
+			match := m.Match(tt.path, tt.isDir)
+			require.Equal(t, tt.expected, match.Ignored)
+			if tt.rule == "" {
+				require.Nil(t, match.Rule)
+			} else {
+				require.NotNil(t, match.Rule)
+				require.Equal(t, tt.rule, match.Rule.String())
+			}
+		})
+	}
+}
+
+func TestExcludedDirectoryCannotBeReincluded(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ld-ignore")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	writeFiles(t, dir, map[string]string{".ldignore": "vendor/\n!vendor/keep.go\n"})
+
+	match := NewMatcher(dir, Options{}).Match("vendor/keep.go", false)
+	require.True(t, match.Ignored)
+	require.Equal(t, ".ldignore:1: vendor/", match.Rule.String())
+}
+
+func TestSearchExclusions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ld-ignore")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	writeFiles(t, dir, map[string]string{
+		".ldignore":     "node_modules/\nvendor\n*.min.js\n/dist\ndocs/generated\nfixtures/\nbuild/\n!fixtures/\n!/build/keep.js\n",
+		"web/.ldignore": "assets/\n",
+	})
+
+	require.Equal(t, []string{"node_modules", "vendor", "build"}, NewMatcher(dir, Options{}).SearchExclusions())
+
+	empty, err := ioutil.TempDir("", "ld-ignore")
+	require.NoError(t, err)
+	defer os.RemoveAll(empty)
+	require.Empty(t, NewMatcher(empty, Options{}).SearchExclusions())
+}
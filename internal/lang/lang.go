@@ -0,0 +1,178 @@
+package lang
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Kind classifies a reference by the kind of token it appears in
+type Kind string
+
+const (
+	Identifier Kind = "identifier"
+	String     Kind = "string"
+	Comment    Kind = "comment"
+)
+
+var kinds = []Kind{Identifier, String, Comment}
+
+// ValidKind reports whether k is a known kind of reference
+func ValidKind(k string) bool {
+	for _, kind := range kinds {
+		if string(kind) == k {
+			return true
+		}
+	}
+	return false
+}
+
+// Merge combines the kinds of two references to the same flag. References in code take precedence over comments,
+// so that a flag is only classified as a comment reference when every reference to it is in a comment.
+func Merge(a, b Kind) Kind {
+	if a == "" || a == Comment {
+		return b
+	}
+	return a
+}
+
+// Language describes the lexical syntax needed to tell code, string literals and comments apart. It is a lightweight,
+// line based tokenizer rather than a parser, and may misclassify references in unusual code.
+type Language struct {
+	Name          string
+	extensions    []string
+	lineComments  []string
+	blockComments [][2]string
+	// quotes which open and close a string literal
+	quotes string
+	// quotes in which backslashes don't escape the next character, e.g. Go raw strings
+	rawQuotes string
+	// line comments must be preceded by whitespace, e.g. `#` in YAML
+	commentNeedsSpace bool
+}
+
+var cLikeBlockComments = [][2]string{{"/*", "*/"}}
+
+var languages = []*Language{
+	{Name: "go", extensions: []string{".go"}, lineComments: []string{"//"}, blockComments: cLikeBlockComments, quotes: "\"'`", rawQuotes: "`"},
+	{Name: "javascript", extensions: []string{".js", ".jsx", ".mjs", ".cjs", ".vue"}, lineComments: []string{"//"}, blockComments: cLikeBlockComments, quotes: "\"'`"},
+	{Name: "typescript", extensions: []string{".ts", ".tsx"}, lineComments: []string{"//"}, blockComments: cLikeBlockComments, quotes: "\"'`"},
+	{Name: "python", extensions: []string{".py"}, lineComments: []string{"#"}, quotes: "\"'"},
+	{Name: "java", extensions: []string{".java", ".kt"}, lineComments: []string{"//"}, blockComments: cLikeBlockComments, quotes: "\"'"},
+	{Name: "ruby", extensions: []string{".rb", ".erb"}, lineComments: []string{"#"}, quotes: "\"'"},
+	{Name: "csharp", extensions: []string{".cs"}, lineComments: []string{"//"}, blockComments: cLikeBlockComments, quotes: "\"'"},
+	{Name: "yaml", extensions: []string{".yml", ".yaml"}, lineComments: []string{"#"}, quotes: "\"'", commentNeedsSpace: true},
+	{Name: "json", extensions: []string{".json"}, quotes: "\""},
+}
+
+// Supported reports whether name is the name of a supported language
+func Supported(name string) bool {
+	for _, l := range languages {
+		if l.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Detect returns the language of the file at path, based on its extension, or nil if the language is not supported
+func Detect(path string) *Language {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, l := range languages {
+		for _, e := range l.extensions {
+			if e == ext {
+				return l
+			}
+		}
+	}
+	return nil
+}
+
+type lexState int
+
+const (
+	inCode lexState = iota
+	inString
+	inBlockComment
+)
+
+// Classify returns the kind of token at byte offset pos of line. Lines are tokenized independently, so a line is
+// only known to continue a block comment when it starts with `*`, as is conventional.
+func (l *Language) Classify(line string, pos int) Kind {
+	state := inCode
+	var quote byte
+	var blockEnd string
+
+	if len(l.blockComments) > 0 && continuesBlockComment(line) {
+		state = inBlockComment
+		blockEnd = l.blockComments[0][1]
+	}
+
+	i := 0
+	for i < pos && i < len(line) {
+		switch state {
+		case inCode:
+			if l.lineCommentAt(line, i) {
+				return Comment
+			}
+			if c, ok := l.blockCommentAt(line, i); ok {
+				state = inBlockComment
+				blockEnd = c[1]
+				i += len(c[0])
+				continue
+			}
+			if strings.IndexByte(l.quotes, line[i]) >= 0 {
+				state = inString
+				quote = line[i]
+			}
+		case inString:
+			if line[i] == '\\' && strings.IndexByte(l.rawQuotes, quote) < 0 {
+				i += 2
+				continue
+			}
+			if line[i] == quote {
+				state = inCode
+			}
+		case inBlockComment:
+			if strings.HasPrefix(line[i:], blockEnd) {
+				state = inCode
+				i += len(blockEnd)
+				continue
+			}
+		}
+		i++
+	}
+
+	switch state {
+	case inString:
+		return String
+	case inBlockComment:
+		return Comment
+	}
+	return Identifier
+}
+
+func (l *Language) lineCommentAt(line string, i int) bool {
+	for _, c := range l.lineComments {
+		if strings.HasPrefix(line[i:], c) {
+			if l.commentNeedsSpace && i > 0 && line[i-1] != ' ' && line[i-1] != '\t' {
+				continue
+			}
+			return true
+		}
+	}
+	return false
+}
+
+func (l *Language) blockCommentAt(line string, i int) ([2]string, bool) {
+	for _, c := range l.blockComments {
+		if strings.HasPrefix(line[i:], c[0]) {
+			return c, true
+		}
+	}
+	return [2]string{}, false
+}
+
+func continuesBlockComment(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed == "*" || strings.HasPrefix(trimmed, "* ") || strings.HasPrefix(trimmed, "*/")
+}
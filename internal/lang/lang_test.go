@@ -0,0 +1,56 @@
+package lang
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetect(t *testing.T) {
+	assert.Equal(t, "go", Detect("internal/lang/lang.go").Name)
+	assert.Equal(t, "typescript", Detect("web/App.TSX").Name)
+	assert.Equal(t, "yaml", Detect(".github/workflows/ci.yml").Name)
+	assert.Nil(t, Detect("CHANGELOG.md"))
+	assert.Nil(t, Detect("Makefile"))
+}
+
+func TestClassify(t *testing.T) {
+	specs := []struct {
+		name     string
+		path     string
+		line     string
+		expected Kind
+	}{
+		{"string literal", "main.go", `client.BoolVariation("flag-key", user, false)`, String},
+		{"raw string literal", "main.go", "x := `a\\` + \"flag-key\"", String},
+		{"identifier", "main.go", `const flagKey = flag-key`, Identifier},
+		{"line comment", "main.go", `x := 1 // remove "flag-key" once rolled out`, Comment},
+		{"comment marker inside string", "main.go", `url := "http://example.com" + "flag-key"`, String},
+		{"block comment", "app.js", `/* "flag-key" */ variation()`, Comment},
+		{"after block comment", "app.js", `/* legacy */ variation("flag-key")`, String},
+		{"block comment continuation", "Main.java", ` * Uses "flag-key" to gate checkout`, Comment},
+		{"escaped quote", "app.ts", `log('it\'s ' + 'flag-key')`, String},
+		{"python comment", "app.py", `# ld_client.variation("flag-key")`, Comment},
+		{"ruby string", "app.rb", `client.variation("flag-key", user, false)`, String},
+		{"yaml comment", "config.yml", `flags: ["a"] # "flag-key"`, Comment},
+		{"yaml hash inside value", "config.yml", `url: a#b "flag-key"`, String},
+		{"csharp string", "App.cs", `client.BoolVariation("flag-key", user, false);`, String},
+		{"json string", "flags.json", `{"key": "flag-key"}`, String},
+	}
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			l := Detect(tt.path)
+			require.NotNil(t, l)
+			assert.Equal(t, tt.expected, l.Classify(tt.line, strings.Index(tt.line, "flag-key")))
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	assert.Equal(t, Comment, Merge("", Comment))
+	assert.Equal(t, String, Merge(Comment, String))
+	assert.Equal(t, String, Merge(String, Comment))
+	assert.Equal(t, Identifier, Merge(Identifier, String))
+}
@@ -0,0 +1,216 @@
+package lang
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"strings"
+)
+
+// maxSymbolSearchLines bounds how far above a reference the heuristic symbol finder looks for a definition
+const maxSymbolSearchLines = 2000
+
+var (
+	jsDefinitions = []*regexp.Regexp{
+		regexp.MustCompile(`^\s*(?:export\s+)?(?:default\s+)?(?:abstract\s+)?class\s+(\w+)`),
+		regexp.MustCompile(`^\s*(?:export\s+)?(?:default\s+)?(?:async\s+)?function\s*\*?\s*(\w+)`),
+		regexp.MustCompile(`^\s*(?:export\s+)?(?:const|let|var)\s+(\w+)\s*(?::[^=]+)?=\s*(?:async\s+)?(?:function\b|\([^)]*\)\s*(?::[^=]+)?=>|\w+\s*=>)`),
+		regexp.MustCompile(`^\s*(?:(?:public|private|protected|static|async|get|set|readonly|override)\s+)*(\w+)\s*\([^)]*\)\s*(?::\s*[^{]+)?\{\s*$`),
+	}
+	javaDefinitions = []*regexp.Regexp{
+		regexp.MustCompile(`\b(?:class|interface|enum|record|struct|object)\s+(\w+)`),
+		regexp.MustCompile(`^\s*(?:[\w@]+\s+)*fun\s+(?:<[^>]*>\s*)?(?:[\w.]+\.)?(\w+)\s*\(`),
+		regexp.MustCompile(`^\s*(?:[\w<>\[\],.?@]+\s+)+(\w+)\s*\([^;]*\)\s*(?:throws\s+[\w., ]+)?\s*\{?\s*$`),
+	}
+
+	symbolDefinitions = map[string][]*regexp.Regexp{
+		"go": {
+			regexp.MustCompile(`^func\s+(?:\(\s*\w*\s*\*?(\w+)[^)]*\)\s*)?(\w+)`),
+			regexp.MustCompile(`^type\s+(\w+)`),
+		},
+		"javascript": jsDefinitions,
+		"typescript": jsDefinitions,
+		"python": {
+			regexp.MustCompile(`^\s*(?:async\s+)?def\s+(\w+)`),
+			regexp.MustCompile(`^\s*class\s+(\w+)`),
+		},
+		"java":   javaDefinitions,
+		"csharp": javaDefinitions,
+		"ruby": {
+			regexp.MustCompile(`^\s*def\s+(?:self\.)?([\w?!=]+)`),
+			regexp.MustCompile(`^\s*(?:class|module)\s+([\w:]+)`),
+		},
+	}
+
+	// control flow statements look like method definitions to the heuristic patterns
+	notSymbols = map[string]bool{
+		"if": true, "for": true, "while": true, "switch": true, "catch": true, "return": true, "new": true,
+		"else": true, "do": true, "try": true, "using": true, "lock": true, "foreach": true, "synchronized": true,
+	}
+)
+
+// Symbols finds the function, method or type enclosing a line of a source file
+type Symbols struct {
+	lines []string
+	defs  []*regexp.Regexp
+	// spans of Go declarations, used instead of the heuristic when the file parses
+	spans []symbolSpan
+}
+
+type symbolSpan struct {
+	name       string
+	start, end int
+}
+
+// Symbols indexes the source code of a file in the language. Go files are parsed, while other languages use
+// heuristics based on indentation and common definition syntax.
+func (l *Language) Symbols(src []byte) *Symbols {
+	s := &Symbols{defs: symbolDefinitions[l.Name]}
+	if l.Name == "go" {
+		if spans, ok := goSymbolSpans(src); ok {
+			s.spans = spans
+			return s
+		}
+	}
+	s.lines = strings.Split(string(src), "\n")
+	return s
+}
+
+// At returns the name of the symbol enclosing the 1-based line number, e.g. `CheckoutHandler.ServeHTTP`, or an
+// empty string if the line isn't inside a known definition.
+func (s *Symbols) At(line int) string {
+	if s.spans != nil {
+		for _, span := range s.spans {
+			if line >= span.start && line <= span.end {
+				return span.name
+			}
+		}
+		return ""
+	}
+	return s.heuristicAt(line)
+}
+
+func goSymbolSpans(src []byte) ([]symbolSpan, bool) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, 0)
+	if err != nil {
+		return nil, false
+	}
+
+	spans := []symbolSpan{}
+	add := func(name string, node ast.Node) {
+		spans = append(spans, symbolSpan{name: name, start: fset.Position(node.Pos()).Line, end: fset.Position(node.End()).Line})
+	}
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			name := d.Name.Name
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				if recv := receiverName(d.Recv.List[0].Type); recv != "" {
+					name = recv + "." + name
+				}
+			}
+			add(name, d)
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch sp := spec.(type) {
+				case *ast.TypeSpec:
+					add(sp.Name.Name, sp)
+				case *ast.ValueSpec:
+					if len(sp.Names) > 0 {
+						add(sp.Names[0].Name, sp)
+					}
+				}
+			}
+		}
+	}
+	return spans, true
+}
+
+func receiverName(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.StarExpr:
+		return receiverName(e.X)
+	case *ast.IndexExpr:
+		return receiverName(e.X)
+	case *ast.Ident:
+		return e.Name
+	}
+	return ""
+}
+
+// heuristicAt walks up from line, collecting the names of definitions which are less indented than everything
+// between them and the line, from the outermost to the innermost.
+func (s *Symbols) heuristicAt(line int) string {
+	if len(s.defs) == 0 || line < 1 || line > len(s.lines) {
+		return ""
+	}
+
+	names := []string{}
+	// the referencing line may itself be a definition, e.g. `def checkout(flag="new-checkout"):`
+	if name := s.definitionName(s.lines[line-1]); name != "" {
+		names = append(names, name)
+	}
+	threshold := indentation(s.lines[line-1])
+	for i := line - 2; i >= 0 && i >= line-maxSymbolSearchLines && threshold > 0; i-- {
+		text := s.lines[i]
+		if isBlankOrComment(text) {
+			continue
+		}
+		indent := indentation(text)
+		if indent >= threshold {
+			continue
+		}
+		if name := s.definitionName(text); name != "" {
+			names = append([]string{name}, names...)
+		}
+		threshold = indent
+	}
+	return strings.Join(names, ".")
+}
+
+func (s *Symbols) definitionName(text string) string {
+	for _, def := range s.defs {
+		m := def.FindStringSubmatch(text)
+		if m == nil {
+			continue
+		}
+		parts := []string{}
+		for _, group := range m[1:] {
+			if group != "" {
+				parts = append(parts, group)
+			}
+		}
+		name := strings.Join(parts, ".")
+		if name != "" && !notSymbols[name] {
+			return name
+		}
+	}
+	return ""
+}
+
+func indentation(text string) int {
+	n := 0
+	for _, c := range text {
+		switch c {
+		case ' ':
+			n++
+		case '\t':
+			n += 4
+		default:
+			return n
+		}
+	}
+	return n
+}
+
+func isBlankOrComment(text string) bool {
+	trimmed := strings.TrimSpace(text)
+	for _, prefix := range []string{"//", "#", "/*", "*"} {
+		if strings.HasPrefix(trimmed, prefix) {
+			return true
+		}
+	}
+	return trimmed == ""
+}
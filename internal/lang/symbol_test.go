@@ -0,0 +1,135 @@
+package lang
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSymbolsAt(t *testing.T) {
+	specs := []struct {
+		name     string
+		path     string
+		src      string
+		expected string
+	}{
+		{
+			name: "go method",
+			path: "handler.go",
+			src: `package checkout
+
+type CheckoutHandler struct{}
+
+func (h *CheckoutHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if client.BoolVariation("flag-key", user, false) {
+	}
+}
+`,
+			expected: "CheckoutHandler.ServeHTTP",
+		},
+		{
+			name: "go package level variable",
+			path: "flags.go",
+			src: `package flags
+
+var (
+	newCheckout = "flag-key"
+)
+`,
+			expected: "newCheckout",
+		},
+		{
+			name: "go file that does not parse",
+			path: "broken.go",
+			src: `package broken
+
+func (s Server) handle() {
+	x := "flag-key"
+`,
+			expected: "Server.handle",
+		},
+		{
+			name: "javascript class method",
+			path: "app.js",
+			src: `export class Checkout {
+  render() {
+    if (this.flags['flag-key']) {
+      return null;
+    }
+  }
+}
+`,
+			expected: "Checkout.render",
+		},
+		{
+			name: "typescript arrow function",
+			path: "hooks.ts",
+			src: `export const useCheckout = (user: User) => {
+  return variation('flag-key', false);
+};
+`,
+			expected: "useCheckout",
+		},
+		{
+			name: "python method",
+			path: "app.py",
+			src: `class Checkout:
+    def total(self):
+        # comment at a lower indentation
+        if ld_client.variation("flag-key", user, False):
+            return 0
+`,
+			expected: "Checkout.total",
+		},
+		{
+			name: "java method",
+			path: "Checkout.java",
+			src: `public class Checkout {
+    public boolean isEnabled(LDUser user) {
+        return client.boolVariation("flag-key", user, false);
+    }
+}
+`,
+			expected: "Checkout.isEnabled",
+		},
+		{
+			name: "ruby method",
+			path: "checkout.rb",
+			src: `module Billing
+  class Checkout
+    def enabled?
+      client.variation("flag-key", user, false)
+    end
+  end
+end
+`,
+			expected: "Billing.Checkout.enabled?",
+		},
+		{
+			name: "top level code",
+			path: "app.py",
+			src: `def unrelated():
+    pass
+
+FLAG = "flag-key"
+`,
+			expected: "",
+		},
+	}
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			l := Detect(tt.path)
+			require.NotNil(t, l)
+			line := 0
+			for i, text := range strings.Split(tt.src, "\n") {
+				if strings.Contains(text, "flag-key") {
+					line = i + 1
+					break
+				}
+			}
+			assert.Equal(t, tt.expected, l.Symbols([]byte(tt.src)).At(line))
+		})
+	}
+}
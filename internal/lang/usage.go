@@ -0,0 +1,173 @@
+package lang
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/glob"
+)
+
+// Usage classifies a reference by how the flag key is used
+type Usage string
+
+const (
+	// Evaluation is a call to a LaunchDarkly SDK which evaluates the flag
+	Evaluation Usage = "evaluation"
+	// Constant defines a constant or configuration value holding the flag key
+	Constant Usage = "constant"
+	// Mock is a reference in test code, or to a mocked flag
+	Mock  Usage = "mock"
+	Other Usage = "other"
+)
+
+var usageRanks = map[Usage]int{Other: 1, Mock: 2, Constant: 3, Evaluation: 4}
+
+// ValidUsage reports whether u is a known usage
+func ValidUsage(u string) bool {
+	return usageRanks[Usage(u)] > 0
+}
+
+// MergeUsage combines the usages of two references to the same flag, preferring the more significant usage
+func MergeUsage(a, b Usage) Usage {
+	if usageRanks[b] > usageRanks[a] {
+		return b
+	}
+	return a
+}
+
+// FlagKeyPlaceholder may be used in usage rule patterns to match the referenced flag key
+const FlagKeyPlaceholder = "{flagKey}"
+
+// UsageRule classifies references in lines matching Pattern, in files of one of Languages matching one of Paths.
+// Empty Languages or Paths match every supported language or path, and an empty Pattern matches every line.
+// If the pattern contains FlagKeyPlaceholder, it only matches where the placeholder matches the referenced key.
+type UsageRule struct {
+	Usage     Usage
+	Languages []string
+	Paths     []string
+	Pattern   string
+}
+
+const (
+	quote            = "[\"'`]"
+	evaluationMethod = `(?i)\b\w*variation(?:detail)?(?:ctx)?\(\s*`
+)
+
+// defaultUsageRules are tried after any custom rules, in order. The first matching rule classifies a reference.
+var defaultUsageRules = []UsageRule{
+	{Usage: Mock, Paths: []string{
+		"**/*_test.go", "**/*.test.*", "**/*.spec.*", "**/test_*.py", "**/*_test.py", "**/*_spec.rb",
+		"**/*Test.java", "**/*Test.kt", "**/*Tests.cs", "**/__mocks__/**", "**/testdata/**",
+	}},
+	{Usage: Mock, Pattern: `(?i)\w*(?:mock|stub|fake)\w*\W.*` + quote + FlagKeyPlaceholder},
+	{Usage: Evaluation, Pattern: evaluationMethod + quote + FlagKeyPlaceholder},
+	{Usage: Evaluation, Languages: []string{"javascript", "typescript"}, Pattern: `\b(?:useFlags\(\)|flags|allFlags\(\))\s*\[\s*` + quote + FlagKeyPlaceholder},
+	{Usage: Constant, Languages: []string{"go"}, Pattern: `^\s*(?:const\s+|var\s+)?\w+\s*(?:\w+\s*)?=\s*` + quote + FlagKeyPlaceholder},
+	{Usage: Constant, Languages: []string{"javascript", "typescript"}, Pattern: `(?:\b(?:const|let|var|readonly)\s+\w+\s*(?::\s*\w+\s*)?=|^\s*\w+\s*:)\s*` + quote + FlagKeyPlaceholder},
+	{Usage: Constant, Languages: []string{"python"}, Pattern: `^\s*[A-Za-z_]\w*\s*(?::\s*\w+\s*)?=\s*` + quote + FlagKeyPlaceholder},
+	{Usage: Constant, Languages: []string{"java", "csharp"}, Pattern: `\b(?:final|const|val|readonly)\b[^=(]*=\s*` + quote + FlagKeyPlaceholder},
+	{Usage: Constant, Languages: []string{"ruby"}, Pattern: `^\s*[A-Z]\w*\s*=\s*` + quote + FlagKeyPlaceholder},
+	{Usage: Constant, Languages: []string{"yaml", "json"}, Pattern: `^\s*["']?[\w.-]+["']?\s*:\s*` + quote + FlagKeyPlaceholder},
+}
+
+type usageMatcher struct {
+	usage     Usage
+	languages map[string]bool
+	paths     []string
+	pattern   *regexp.Regexp
+	flagGroup int
+}
+
+// UsageClassifier classifies references by applying usage rules
+type UsageClassifier struct {
+	matchers []usageMatcher
+}
+
+// NewUsageClassifier returns a classifier which applies the custom rules before the rules shipped with the tool
+func NewUsageClassifier(custom []UsageRule) (*UsageClassifier, error) {
+	c := &UsageClassifier{}
+	for _, rule := range append(append([]UsageRule{}, custom...), defaultUsageRules...) {
+		m := usageMatcher{usage: rule.Usage, paths: rule.Paths, flagGroup: -1}
+		if len(rule.Languages) > 0 {
+			m.languages = map[string]bool{}
+			for _, l := range rule.Languages {
+				m.languages[l] = true
+			}
+		}
+		if rule.Pattern != "" {
+			pattern, err := CompileUsagePattern(rule.Pattern)
+			if err != nil {
+				return nil, err
+			}
+			m.pattern = pattern
+			for i, name := range pattern.SubexpNames() {
+				if name == "flagKey" {
+					m.flagGroup = i
+					break
+				}
+			}
+		}
+		c.matchers = append(c.matchers, m)
+	}
+	return c, nil
+}
+
+// CompileUsagePattern compiles a usage rule pattern, replacing FlagKeyPlaceholder with a group matching any flag key
+func CompileUsagePattern(pattern string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile(strings.Replace(pattern, FlagKeyPlaceholder, `(?P<flagKey>[\w.-]+)`, -1))
+	if err != nil {
+		return nil, fmt.Errorf("invalid usage rule pattern %q: %s", pattern, err)
+	}
+	return re, nil
+}
+
+// Classify returns the usage of flagKey in line, a line of the file at path
+func (c *UsageClassifier) Classify(language *Language, path, line, flagKey string) Usage {
+	for _, m := range c.matchers {
+		if m.matches(language, path, line, flagKey) {
+			return m.usage
+		}
+	}
+	return Other
+}
+
+// EvaluatedKeys returns the flag keys evaluated in line, a line of the file at path, whether or not they are known
+// flags. Keys are captured by the FlagKeyPlaceholder of rules classifying references as evaluations, and are only
+// returned if the reference to the key is classified as an evaluation.
+func (c *UsageClassifier) EvaluatedKeys(language *Language, path, line string) []string {
+	keys := []string{}
+	seen := map[string]bool{}
+	for _, m := range c.matchers {
+		// the languages and paths of the rule, and rules taking precedence, are checked by Classify
+		if m.usage != Evaluation || m.flagGroup < 0 {
+			continue
+		}
+		for _, match := range m.pattern.FindAllStringSubmatch(line, -1) {
+			key := match[m.flagGroup]
+			if !seen[key] && c.Classify(language, path, line, key) == Evaluation {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+func (m usageMatcher) matches(language *Language, path, line, flagKey string) bool {
+	if m.languages != nil && (language == nil || !m.languages[language.Name]) {
+		return false
+	}
+	if len(m.paths) > 0 && !glob.MatchAny(m.paths, path) {
+		return false
+	}
+	if m.pattern == nil {
+		return true
+	}
+	for _, match := range m.pattern.FindAllStringSubmatchIndex(line, -1) {
+		if m.flagGroup < 0 || line[match[2*m.flagGroup]:match[2*m.flagGroup+1]] == flagKey {
+			return true
+		}
+	}
+	return false
+}
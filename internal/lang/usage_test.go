@@ -0,0 +1,84 @@
+package lang
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsageClassifier(t *testing.T) {
+	c, err := NewUsageClassifier([]UsageRule{
+		{Usage: Evaluation, Languages: []string{"go"}, Pattern: `featureGate\.Enabled\(\s*"{flagKey}"`},
+	})
+	require.NoError(t, err)
+
+	specs := []struct {
+		name     string
+		path     string
+		line     string
+		expected Usage
+	}{
+		{"go evaluation", "main.go", `if client.BoolVariation("flag-key", user, false) {`, Evaluation},
+		{"go evaluation detail", "main.go", `v, d, _ := client.StringVariationDetail("flag-key", user, "")`, Evaluation},
+		{"go constant", "flags.go", `	NewCheckout = "flag-key"`, Constant},
+		{"custom rule", "main.go", `if featureGate.Enabled("flag-key") {`, Evaluation},
+		{"custom rule only applies to its languages", "app.js", `if (featureGate.Enabled("flag-key")) {`, Other},
+		{"javascript evaluation", "app.js", `const enabled = ldClient.variation('flag-key', false);`, Evaluation},
+		{"react hook", "App.tsx", `if (useFlags()['flag-key']) {`, Evaluation},
+		{"javascript constant", "flags.ts", `export const NEW_CHECKOUT = 'flag-key';`, Constant},
+		{"javascript object property", "flags.js", `  newCheckout: 'flag-key',`, Constant},
+		{"python evaluation", "app.py", `if ld_client.variation("flag-key", user, False):`, Evaluation},
+		{"python constant", "flags.py", `NEW_CHECKOUT = "flag-key"`, Constant},
+		{"java evaluation", "Checkout.java", `client.boolVariation("flag-key", user, false);`, Evaluation},
+		{"java constant", "Flags.java", `public static final String NEW_CHECKOUT = "flag-key";`, Constant},
+		{"ruby evaluation", "checkout.rb", `client.variation("flag-key", user, false)`, Evaluation},
+		{"yaml value", "flags.yml", `new_checkout: "flag-key"`, Constant},
+		{"test file", "checkout_test.go", `client.BoolVariation("flag-key", user, false)`, Mock},
+		{"mocked flag", "app.js", `mockFlags({ 'flag-key': true })`, Mock},
+		{"other mentions", "app.js", `log('flag-key is deprecated')`, Other},
+		{"pattern must match the referenced key", "main.go", `client.BoolVariation("other-key", user, false) // "flag-key"`, Other},
+	}
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, c.Classify(Detect(tt.path), tt.path, tt.line, "flag-key"))
+		})
+	}
+}
+
+func TestEvaluatedKeys(t *testing.T) {
+	c, err := NewUsageClassifier([]UsageRule{
+		{Usage: Evaluation, Languages: []string{"go"}, Pattern: `featureGate\.Enabled\(\s*"{flagKey}"`},
+	})
+	require.NoError(t, err)
+
+	specs := []struct {
+		name     string
+		path     string
+		line     string
+		expected []string
+	}{
+		{"sdk evaluation", "main.go", `if client.BoolVariation("new-flag", user, false) {`, []string{"new-flag"}},
+		{"several evaluations", "app.js", `ld.variation('flag-a', false) && ld.variation('flag-b', false)`, []string{"flag-a", "flag-b"}},
+		{"custom rule", "main.go", `if featureGate.Enabled("gate-flag") {`, []string{"gate-flag"}},
+		{"custom rule only applies to its languages", "app.js", `featureGate.Enabled("gate-flag")`, []string{}},
+		{"test files are mocks", "main_test.go", `client.BoolVariation("new-flag", user, false)`, []string{}},
+		{"constants are not evaluations", "flags.go", `NewCheckout = "new-flag"`, []string{}},
+	}
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, c.EvaluatedKeys(Detect(tt.path), tt.path, tt.line))
+		})
+	}
+}
+
+func TestNewUsageClassifierInvalidPattern(t *testing.T) {
+	_, err := NewUsageClassifier([]UsageRule{{Usage: Evaluation, Pattern: "gate({flagKey}"}})
+	require.Error(t, err)
+}
+
+func TestMergeUsage(t *testing.T) {
+	assert.Equal(t, Evaluation, MergeUsage(Other, Evaluation))
+	assert.Equal(t, Evaluation, MergeUsage(Evaluation, Constant))
+	assert.Equal(t, Mock, MergeUsage("", Mock))
+}
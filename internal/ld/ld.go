@@ -15,6 +15,7 @@ import (
 	"reflect"
 	"sort"
 	"strconv"
+	"strings"
 
 	h "github.com/hashicorp/go-retryablehttp"
 	"github.com/olekukonko/tablewriter"
@@ -33,10 +34,19 @@ type ApiClient struct {
 
 type ApiOptions struct {
 	ApiKey    string
-	ProjKey   string
 	BaseUri   string
 	UserAgent string
 	RetryMax  *int
+
+	// Transport options, applied to all requests made to LaunchDarkly
+	ProxyUrl       string
+	CACertFiles    []string
+	ClientCertFile string
+	ClientKeyFile  string
+	TLSMinVersion  string
+
+	// OnResponse, if provided, is called after every request made to LaunchDarkly, including retries
+	OnResponse func(Response)
 }
 
 const (
@@ -57,28 +67,34 @@ var (
 	BranchUpdateSequenceIdConflictErr = errors.New("updateSequenceId conflict")
 )
 
-func InitApiClient(options ApiOptions) ApiClient {
+func InitApiClient(options ApiOptions) (ApiClient, error) {
 	if options.BaseUri == "" {
 		options.BaseUri = "https://app.launchdarkly.com"
 	}
+	httpClient, err := newHTTPClient(options)
+	if err != nil {
+		return ApiClient{}, err
+	}
 	client := h.NewClient()
+	client.HTTPClient = httpClient
 	client.Logger = log.Debug
 	if options.RetryMax != nil && *options.RetryMax >= 0 {
 		client.RetryMax = *options.RetryMax
 	}
 	return ApiClient{
 		ldClient: ldapi.NewAPIClient(&ldapi.Configuration{
-			BasePath:  options.BaseUri + v2ApiPath,
-			UserAgent: options.UserAgent,
+			BasePath:   options.BaseUri + v2ApiPath,
+			UserAgent:  options.UserAgent,
+			HTTPClient: httpClient,
 		}),
 		httpClient: client,
 		Options:    options,
-	}
+	}, nil
 }
 
-func (c ApiClient) GetFlagKeyList() ([]string, error) {
-	ctx := context.WithValue(context.Background(), ldapi.ContextAPIKey, ldapi.APIKey{Key: c.Options.ApiKey})
-	flags, _, err := c.ldClient.FeatureFlagsApi.GetFeatureFlags(ctx, c.Options.ProjKey, nil)
+func (c ApiClient) GetFlagKeyList(ctx context.Context, projKey string) ([]string, error) {
+	ctx = context.WithValue(ctx, ldapi.ContextAPIKey, ldapi.APIKey{Key: c.Options.ApiKey})
+	flags, _, err := c.ldClient.FeatureFlagsApi.GetFeatureFlags(ctx, projKey, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -89,11 +105,66 @@ func (c ApiClient) GetFlagKeyList() ([]string, error) {
 	return flagKeys, nil
 }
 
+// Flag describes a feature flag, with the properties used to report on references to it
+type Flag struct {
+	Key        string `json:"key"`
+	Temporary  bool   `json:"temporary"`
+	Archived   bool   `json:"archived"`
+	Deprecated bool   `json:"deprecated"`
+}
+
+type flagCollection struct {
+	Items []Flag `json:"items"`
+}
+
+// GetFlags returns the flags in a project, including archived flags
+func (c ApiClient) GetFlags(ctx context.Context, projKey string) ([]Flag, error) {
+	flags, err := c.getFlags(ctx, projKey, url.Values{"summary": {"true"}})
+	if err != nil {
+		return nil, err
+	}
+	archived, err := c.getFlags(ctx, projKey, url.Values{"summary": {"true"}, "archived": {"true"}})
+	if err != nil {
+		return nil, err
+	}
+	for _, flag := range archived {
+		flag.Archived = true
+		flags = append(flags, flag)
+	}
+	return flags, nil
+}
+
+func (c ApiClient) getFlags(ctx context.Context, projKey string, query url.Values) ([]Flag, error) {
+	req, err := h.NewRequest("GET", fmt.Sprintf("%s%s/flags/%s?%s", c.Options.BaseUri, v2ApiPath, url.PathEscape(projKey), query.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	resBytes, err := ioutil.ReadAll(res.Body)
+	if res != nil {
+		defer res.Body.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var flags flagCollection
+	err = json.Unmarshal(resBytes, &flags)
+	if err != nil {
+		return nil, err
+	}
+	return flags.Items, nil
+}
+
 func (c ApiClient) repoUrl() string {
 	return fmt.Sprintf("%s%s", c.Options.BaseUri, reposPath)
 }
 
-func (c ApiClient) patchCodeReferenceRepository(currentRepo, repo RepoParams) error {
+func (c ApiClient) patchCodeReferenceRepository(ctx context.Context, currentRepo, repo RepoParams) error {
 	originalBytes, err := json.Marshal(currentRepo)
 	if err != nil {
 		return err
@@ -114,7 +185,7 @@ func (c ApiClient) patchCodeReferenceRepository(currentRepo, repo RepoParams) er
 		return err
 	}
 
-	_, err = c.do(req)
+	_, err = c.do(ctx, req)
 	if err != nil {
 		return err
 	}
@@ -122,12 +193,12 @@ func (c ApiClient) patchCodeReferenceRepository(currentRepo, repo RepoParams) er
 	return nil
 }
 
-func (c ApiClient) getCodeReferenceRepository(name string) (*RepoRep, error) {
+func (c ApiClient) getCodeReferenceRepository(ctx context.Context, name string) (*RepoRep, error) {
 	req, err := h.NewRequest("GET", fmt.Sprintf("%s/%s", c.repoUrl(), name), nil)
 	if err != nil {
 		return nil, err
 	}
-	res, err := c.do(req)
+	res, err := c.do(ctx, req)
 	if err != nil {
 		return nil, err
 	}
@@ -148,12 +219,12 @@ func (c ApiClient) getCodeReferenceRepository(name string) (*RepoRep, error) {
 	return &repo, err
 }
 
-func (c ApiClient) GetCodeReferenceRepositoryBranches(repoName string) ([]BranchRep, error) {
+func (c ApiClient) GetCodeReferenceRepositoryBranches(ctx context.Context, repoName string) ([]BranchRep, error) {
 	req, err := h.NewRequest("GET", fmt.Sprintf("%s/%s/branches", c.repoUrl(), repoName), nil)
 	if err != nil {
 		return nil, err
 	}
-	res, err := c.do(req)
+	res, err := c.do(ctx, req)
 	if err != nil {
 		return nil, err
 	}
@@ -174,7 +245,35 @@ func (c ApiClient) GetCodeReferenceRepositoryBranches(repoName string) ([]Branch
 	return branches.Items, err
 }
 
-func (c ApiClient) postCodeReferenceRepository(repo RepoParams) error {
+// GetCodeReferenceBranch returns the references recorded for a branch. NotFoundErr is returned if the repository or
+// branch hasn't been recorded.
+func (c ApiClient) GetCodeReferenceBranch(ctx context.Context, repoName, branchName string) (*BranchRep, error) {
+	req, err := h.NewRequest("GET", fmt.Sprintf("%s/%s/branches/%s", c.repoUrl(), repoName, url.PathEscape(branchName)), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	resBytes, err := ioutil.ReadAll(res.Body)
+	if res != nil {
+		defer res.Body.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var branch BranchRep
+	err = json.Unmarshal(resBytes, &branch)
+	if err != nil {
+		return nil, err
+	}
+	return &branch, nil
+}
+
+func (c ApiClient) postCodeReferenceRepository(ctx context.Context, repo RepoParams) error {
 	repoBytes, err := json.Marshal(repo)
 	if err != nil {
 		return err
@@ -185,7 +284,7 @@ func (c ApiClient) postCodeReferenceRepository(repo RepoParams) error {
 		return err
 	}
 
-	_, err = c.do(req)
+	_, err = c.do(ctx, req)
 	if err != nil {
 		return err
 	}
@@ -193,8 +292,8 @@ func (c ApiClient) postCodeReferenceRepository(repo RepoParams) error {
 	return nil
 }
 
-func (c ApiClient) MaybeUpsertCodeReferenceRepository(repo RepoParams) error {
-	currentRepo, err := c.getCodeReferenceRepository(repo.Name)
+func (c ApiClient) MaybeUpsertCodeReferenceRepository(ctx context.Context, repo RepoParams) error {
+	currentRepo, err := c.getCodeReferenceRepository(ctx, repo.Name)
 	if err != nil && err != NotFoundErr {
 		return fmt.Errorf("error retrieving repository: %s", err)
 	}
@@ -229,7 +328,7 @@ func (c ApiClient) MaybeUpsertCodeReferenceRepository(repo RepoParams) error {
 		}
 
 		if !reflect.DeepEqual(currentRepoParams, repo) {
-			err = c.patchCodeReferenceRepository(currentRepoParams, repo)
+			err = c.patchCodeReferenceRepository(ctx, currentRepoParams, repo)
 			if err != nil {
 				return fmt.Errorf("error updating repository: %s", err)
 			}
@@ -237,7 +336,7 @@ func (c ApiClient) MaybeUpsertCodeReferenceRepository(repo RepoParams) error {
 		return nil
 	}
 
-	err = c.postCodeReferenceRepository(repo)
+	err = c.postCodeReferenceRepository(ctx, repo)
 	if err != nil {
 		return fmt.Errorf("error creating repository: %s", err)
 	}
@@ -245,7 +344,7 @@ func (c ApiClient) MaybeUpsertCodeReferenceRepository(repo RepoParams) error {
 	return nil
 }
 
-func (c ApiClient) PutCodeReferenceBranch(branch BranchRep, repoName string) error {
+func (c ApiClient) PutCodeReferenceBranch(ctx context.Context, branch BranchRep, repoName string) error {
 	branchBytes, err := json.Marshal(branch)
 	if err != nil {
 		return err
@@ -256,7 +355,7 @@ func (c ApiClient) PutCodeReferenceBranch(branch BranchRep, repoName string) err
 		return err
 	}
 
-	_, err = c.do(req)
+	_, err = c.do(ctx, req)
 	if err != nil {
 		return err
 	}
@@ -264,7 +363,7 @@ func (c ApiClient) PutCodeReferenceBranch(branch BranchRep, repoName string) err
 	return nil
 }
 
-func (c ApiClient) PostDeleteBranchesTask(repoName string, branches []string) error {
+func (c ApiClient) PostDeleteBranchesTask(ctx context.Context, repoName string, branches []string) error {
 	body, err := json.Marshal(branches)
 	if err != nil {
 		return err
@@ -275,7 +374,7 @@ func (c ApiClient) PostDeleteBranchesTask(repoName string, branches []string) er
 		return err
 	}
 
-	_, err = c.do(req)
+	_, err = c.do(ctx, req)
 	if err != nil {
 		return err
 	}
@@ -288,13 +387,17 @@ type ldErrorResponse struct {
 	Message string `json:"message"`
 }
 
-func (c ApiClient) do(req *h.Request) (*http.Response, error) {
+func (c ApiClient) do(ctx context.Context, req *h.Request) (*http.Response, error) {
 	req.Header.Set("Authorization", c.Options.ApiKey)
 	req.Header.Set("User-Agent", c.Options.UserAgent)
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Content-Length", strconv.FormatInt(req.ContentLength, 10))
-	res, err := c.httpClient.Do(req)
+	res, err := c.httpClient.Do(req.WithContext(ctx))
 	if err != nil {
+		// retryablehttp reports a generic error after giving up, so surface cancellation and timeouts directly
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		return nil, err
 	}
 
@@ -392,7 +495,36 @@ func (b BranchRep) TotalHunkCount() int {
 	return count
 }
 
-func (b BranchRep) WriteToCSV(outDir, projKey, repo, sha string) (path string, err error) {
+// ForProject returns a copy of the branch containing only references to flags in the given project
+func (b BranchRep) ForProject(projKey string) BranchRep {
+	ret := b
+	ret.References = []ReferenceHunksRep{}
+	for _, ref := range b.References {
+		hunks := []HunkRep{}
+		for _, hunk := range ref.Hunks {
+			if hunk.ProjKey == projKey {
+				hunks = append(hunks, hunk)
+			}
+		}
+		if len(hunks) > 0 {
+			ret.References = append(ret.References, ReferenceHunksRep{Path: ref.Path, Hunks: hunks})
+		}
+	}
+	return ret
+}
+
+// FlagCount returns the number of distinct flags referenced in the branch
+func (b BranchRep) FlagCount() int {
+	flags := map[string]bool{}
+	for _, ref := range b.References {
+		for _, hunk := range ref.Hunks {
+			flags[hunk.ProjKey+"/"+hunk.FlagKey] = true
+		}
+	}
+	return len(flags)
+}
+
+func (b BranchRep) WriteToCSV(outDir, projKey, repo, sha string, symbols bool) (path string, err error) {
 	// Try to create a filename with a shortened sha, but if the sha is too short for some unexpected reason, use the branch name instead
 	var tag string
 	if len(sha) >= 7 {
@@ -416,7 +548,7 @@ func (b BranchRep) WriteToCSV(outDir, projKey, repo, sha string) (path string, e
 	w := csv.NewWriter(f)
 	records := make([][]string, 0, len(b.References)+1)
 	for _, ref := range b.References {
-		records = append(records, ref.toRecords()...)
+		records = append(records, ref.toRecords(symbols)...)
 	}
 
 	// sort csv by flag key
@@ -431,7 +563,11 @@ func (b BranchRep) WriteToCSV(outDir, projKey, repo, sha string) (path string, e
 		return false
 	})
 
-	records = append([][]string{{"flagKey", "path", "startingLineNumber", "lines"}}, records...)
+	header := []string{"flagKey", "path", "startingLineNumber", "lines"}
+	if symbols {
+		header = append(header, "symbol")
+	}
+	records = append([][]string{header}, records...)
 	return path, w.WriteAll(records)
 }
 
@@ -440,19 +576,32 @@ type ReferenceHunksRep struct {
 	Hunks []HunkRep `json:"hunks"`
 }
 
-func (r ReferenceHunksRep) toRecords() [][]string {
+// toRecords returns a csv record for each hunk. The symbol column is added after the others, so that consumers reading
+// columns by position aren't affected.
+func (r ReferenceHunksRep) toRecords(symbols bool) [][]string {
 	ret := make([][]string, 0, len(r.Hunks))
 	for _, hunk := range r.Hunks {
-		ret = append(ret, []string{hunk.FlagKey, r.Path, strconv.FormatInt(int64(hunk.StartingLineNumber), 10), hunk.Lines})
+		record := []string{hunk.FlagKey, r.Path, strconv.FormatInt(int64(hunk.StartingLineNumber), 10), hunk.Lines}
+		if symbols {
+			record = append(record, hunk.Symbol)
+		}
+		ret = append(ret, record)
 	}
 	return ret
 }
 
+// HunkRep is a reference to a flag. Fields describing the reference which the code references API doesn't accept
+// are only used locally, and aren't sent to LaunchDarkly.
 type HunkRep struct {
 	StartingLineNumber int    `json:"startingLineNumber"`
 	Lines              string `json:"lines,omitempty"`
 	ProjKey            string `json:"projKey"`
 	FlagKey            string `json:"flagKey"`
+	Kind               string `json:"-"`
+	Language           string `json:"-"`
+	Symbol             string `json:"-"`
+	Usage              string `json:"-"`
+	Confidence         int    `json:"-"`
 }
 
 type tableData [][]string
@@ -471,18 +620,40 @@ func (t tableData) Swap(i, j int) {
 	t[i], t[j] = t[j], t[i]
 }
 
-const maxFlagKeysDisplayed = 50
+const (
+	maxFlagKeysDisplayed = 50
+	maxSymbolsDisplayed  = 3
+)
+
+// ReferenceCountByFlag returns the number of hunks referencing each flag. Counts are keyed by flag key only, so the
+// branch must only contain references to a single project, see ForProject.
+func (b BranchRep) ReferenceCountByFlag() map[string]int {
+	counts := map[string]int{}
+	for _, ref := range b.References {
+		for _, hunk := range ref.Hunks {
+			counts[hunk.FlagKey]++
+		}
+	}
+	return counts
+}
 
+// PrintReferenceCountTable prints the number of references to each flag. Like ReferenceCountByFlag, it must be called
+// on the references of a single project.
 func (b BranchRep) PrintReferenceCountTable() {
 	data := tableData{}
-	refCountByFlag := map[string]int64{}
+	symbolsByFlag := map[string]map[string]bool{}
 	for _, ref := range b.References {
 		for _, hunk := range ref.Hunks {
-			refCountByFlag[hunk.FlagKey]++
+			if hunk.Symbol != "" {
+				if symbolsByFlag[hunk.FlagKey] == nil {
+					symbolsByFlag[hunk.FlagKey] = map[string]bool{}
+				}
+				symbolsByFlag[hunk.FlagKey][hunk.Symbol] = true
+			}
 		}
 	}
-	for k, v := range refCountByFlag {
-		data = append(data, []string{k, strconv.FormatInt(v, 10)})
+	for k, v := range b.ReferenceCountByFlag() {
+		data = append(data, []string{k, strconv.Itoa(v), formatSymbols(symbolsByFlag[k])})
 	}
 	sort.Sort(data)
 
@@ -496,11 +667,24 @@ func (b BranchRep) PrintReferenceCountTable() {
 			additionalRefCount += i
 		}
 	}
-	truncatedData = append(truncatedData, []string{"Other flags", strconv.FormatInt(additionalRefCount, 10)})
+	truncatedData = append(truncatedData, []string{"Other flags", strconv.FormatInt(additionalRefCount, 10), ""})
 
 	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"Flag", "# References"})
+	table.SetHeader([]string{"Flag", "# References", "Symbols"})
 	table.SetBorder(false)
 	table.AppendBulk(truncatedData)
 	table.Render()
 }
+
+// formatSymbols lists a few of the symbols referencing a flag, to keep the table readable
+func formatSymbols(symbols map[string]bool) string {
+	names := make([]string, 0, len(symbols))
+	for name := range symbols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) > maxSymbolsDisplayed {
+		return fmt.Sprintf("%s, +%d more", strings.Join(names[:maxSymbolsDisplayed], ", "), len(names)-maxSymbolsDisplayed)
+	}
+	return strings.Join(names, ", ")
+}
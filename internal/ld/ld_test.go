@@ -1,10 +1,14 @@
 package ld
 
 import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -33,8 +37,9 @@ func TestPostCodeReferenceRepository(t *testing.T) {
 			defer testServer.Close()
 
 			retryMax := 0
-			client := InitApiClient(ApiOptions{ApiKey: "api-x", ProjKey: "default", BaseUri: testServer.URL, RetryMax: &retryMax})
-			err := client.postCodeReferenceRepository(RepoParams{Type: "custom", Name: "test"})
+			client, err := InitApiClient(ApiOptions{ApiKey: "api-x", BaseUri: testServer.URL, RetryMax: &retryMax})
+			require.NoError(t, err)
+			err = client.postCodeReferenceRepository(context.Background(), RepoParams{Type: "custom", Name: "test"})
 			require.Equal(t, tt.expectedErr, err)
 		})
 	}
@@ -60,8 +65,9 @@ func TestGetCodeReferenceRepository(t *testing.T) {
 			defer testServer.Close()
 
 			retryMax := 0
-			client := InitApiClient(ApiOptions{ApiKey: "api-x", ProjKey: "default", BaseUri: testServer.URL, RetryMax: &retryMax})
-			_, err := client.getCodeReferenceRepository("test")
+			client, err := InitApiClient(ApiOptions{ApiKey: "api-x", BaseUri: testServer.URL, RetryMax: &retryMax})
+			require.NoError(t, err)
+			_, err = client.getCodeReferenceRepository(context.Background(), "test")
 			require.Equal(t, tt.expectedErr, err)
 		})
 	}
@@ -86,8 +92,9 @@ func TestPatchCodeReferenceRepository(t *testing.T) {
 			defer testServer.Close()
 
 			retryMax := 0
-			client := InitApiClient(ApiOptions{ApiKey: "api-x", ProjKey: "default", BaseUri: testServer.URL, RetryMax: &retryMax})
-			err := client.patchCodeReferenceRepository(tt.oldRepo, tt.newRepo)
+			client, err := InitApiClient(ApiOptions{ApiKey: "api-x", BaseUri: testServer.URL, RetryMax: &retryMax})
+			require.NoError(t, err)
+			err = client.patchCodeReferenceRepository(context.Background(), tt.oldRepo, tt.newRepo)
 			require.Equal(t, tt.expectedErr, err)
 		})
 	}
@@ -110,13 +117,42 @@ func TestPutCodeReferenceBranch(t *testing.T) {
 			defer testServer.Close()
 
 			retryMax := 0
-			client := InitApiClient(ApiOptions{ApiKey: "api-x", ProjKey: "default", BaseUri: testServer.URL, RetryMax: &retryMax})
-			err := client.PutCodeReferenceBranch(BranchRep{}, "test")
+			client, err := InitApiClient(ApiOptions{ApiKey: "api-x", BaseUri: testServer.URL, RetryMax: &retryMax})
+			require.NoError(t, err)
+			err = client.PutCodeReferenceBranch(context.Background(), BranchRep{}, "test")
 			require.Equal(t, tt.expectedErr, err)
 		})
 	}
 }
 
+func TestHunkRepJSON(t *testing.T) {
+	hunk := HunkRep{StartingLineNumber: 3, Lines: "flag-a\n", ProjKey: "default", FlagKey: "flag-a", Kind: "string", Language: "go", Symbol: "main", Usage: "evaluation", Confidence: 90}
+	data, err := json.Marshal(hunk)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"startingLineNumber":3,"lines":"flag-a\n","projKey":"default","flagKey":"flag-a"}`, string(data), "only fields accepted by the code references API are sent")
+}
+
+func TestWriteToCSV(t *testing.T) {
+	dir, err := ioutil.TempDir("", "csv")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	b := BranchRep{Name: "main", References: []ReferenceHunksRep{
+		{Path: "main.go", Hunks: []HunkRep{{StartingLineNumber: 3, Lines: "flag-a\n", ProjKey: "default", FlagKey: "flag-a", Symbol: "main"}}},
+	}}
+
+	path, err := b.WriteToCSV(dir, "default", "test", "4b2c3fd8", false)
+	require.NoError(t, err)
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "flagKey,path,startingLineNumber,lines\nflag-a,main.go,3,\"flag-a\n\"\n", string(data))
+
+	path, err = b.WriteToCSV(dir, "default", "test", "4b2c3fd8", true)
+	require.NoError(t, err)
+	data, err = ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "flagKey,path,startingLineNumber,lines,symbol\nflag-a,main.go,3,\"flag-a\n\",main\n", string(data))
+}
+
 func TestPostDeleteBranchesTask(t *testing.T) {
 	specs := []struct {
 		name           string
@@ -134,8 +170,9 @@ func TestPostDeleteBranchesTask(t *testing.T) {
 			defer testServer.Close()
 
 			retryMax := 0
-			client := InitApiClient(ApiOptions{ApiKey: "api-x", ProjKey: "default", BaseUri: testServer.URL, RetryMax: &retryMax})
-			err := client.PostDeleteBranchesTask("test", []string{"master"})
+			client, err := InitApiClient(ApiOptions{ApiKey: "api-x", BaseUri: testServer.URL, RetryMax: &retryMax})
+			require.NoError(t, err)
+			err = client.PostDeleteBranchesTask(context.Background(), "test", []string{"master"})
 			require.Equal(t, tt.expectedErr, err)
 		})
 	}
@@ -161,9 +198,85 @@ func TestGetCodeReferenceRepositoryBranches(t *testing.T) {
 			defer testServer.Close()
 
 			retryMax := 0
-			client := InitApiClient(ApiOptions{ApiKey: "api-x", ProjKey: "default", BaseUri: testServer.URL, RetryMax: &retryMax})
-			_, err := client.GetCodeReferenceRepositoryBranches("test")
+			client, err := InitApiClient(ApiOptions{ApiKey: "api-x", BaseUri: testServer.URL, RetryMax: &retryMax})
+			require.NoError(t, err)
+			_, err = client.GetCodeReferenceRepositoryBranches(context.Background(), "test")
 			require.Equal(t, tt.expectedErr, err)
 		})
 	}
 }
+
+func TestGetCodeReferenceBranch(t *testing.T) {
+	specs := []struct {
+		name           string
+		responseStatus int
+		responseBody   string
+		expectedErr    error
+	}{
+		{"succeeds", 200, `{"name":"feature/a","head":"abc","references":[{"path":"a.go","hunks":[{"startingLineNumber":1,"projKey":"default","flagKey":"flag-a"}]}]}`, nil},
+		{"fails on not found", 404, ``, NotFoundErr},
+	}
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				require.Equal(t, "/api/v2/code-refs/repositories/test/branches/feature%2Fa", req.URL.EscapedPath())
+				res.WriteHeader(tt.responseStatus)
+				_, err := res.Write([]byte(tt.responseBody))
+				require.NoError(t, err)
+			}))
+			defer testServer.Close()
+
+			retryMax := 0
+			client, err := InitApiClient(ApiOptions{ApiKey: "api-x", BaseUri: testServer.URL, RetryMax: &retryMax})
+			require.NoError(t, err)
+			branch, err := client.GetCodeReferenceBranch(context.Background(), "test", "feature/a")
+			require.Equal(t, tt.expectedErr, err)
+			if err == nil {
+				require.Equal(t, map[string]int{"flag-a": 1}, branch.ReferenceCountByFlag())
+			}
+		})
+	}
+}
+
+func TestGetFlags(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		require.Equal(t, "/api/v2/flags/default", req.URL.Path)
+		require.Equal(t, "true", req.URL.Query().Get("summary"))
+		body := `{"items":[{"key":"flag-a","temporary":true},{"key":"flag-b","deprecated":true}]}`
+		if req.URL.Query().Get("archived") == "true" {
+			body = `{"items":[{"key":"flag-c"}]}`
+		}
+		_, err := res.Write([]byte(body))
+		require.NoError(t, err)
+	}))
+	defer testServer.Close()
+
+	retryMax := 0
+	client, err := InitApiClient(ApiOptions{ApiKey: "api-x", BaseUri: testServer.URL, RetryMax: &retryMax})
+	require.NoError(t, err)
+	flags, err := client.GetFlags(context.Background(), "default")
+	require.NoError(t, err)
+	require.Equal(t, []Flag{
+		{Key: "flag-a", Temporary: true},
+		{Key: "flag-b", Deprecated: true},
+		{Key: "flag-c", Archived: true},
+	}, flags)
+}
+
+func TestRequestCancellation(t *testing.T) {
+	done := make(chan struct{})
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		// hang until the test has finished
+		<-done
+	}))
+	defer testServer.Close()
+	defer close(done)
+
+	retryMax := 0
+	client, err := InitApiClient(ApiOptions{ApiKey: "api-x", BaseUri: testServer.URL, RetryMax: &retryMax})
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = client.GetCodeReferenceRepositoryBranches(ctx, "test")
+	require.Equal(t, context.DeadlineExceeded, err)
+}
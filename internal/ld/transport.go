@@ -0,0 +1,143 @@
+package ld
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	h "github.com/hashicorp/go-retryablehttp"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+}
+
+// ParseTLSVersion converts a TLS version of the form "1.2" to its crypto/tls constant.
+func ParseTLSVersion(version string) (uint16, error) {
+	v, ok := tlsVersions[version]
+	if !ok {
+		return 0, fmt.Errorf("unsupported TLS version %q, expected one of 1.0, 1.1 or 1.2", version)
+	}
+	return v, nil
+}
+
+// newHTTPClient builds the http client shared by the generated LaunchDarkly API client and the retryable
+// client used for code reference requests, so that proxy and TLS settings apply to every request.
+func newHTTPClient(options ApiOptions) (*http.Client, error) {
+	// start from the transport of a new retryable client, which isn't shared with http.DefaultTransport
+	transport, ok := h.NewClient().HTTPClient.Transport.(*http.Transport)
+	if !ok {
+		transport = &http.Transport{Proxy: http.ProxyFromEnvironment}
+	}
+
+	if options.ProxyUrl != "" {
+		proxyUrl, err := url.Parse(options.ProxyUrl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy url: %s", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyUrl)
+	}
+
+	tlsConfig, err := newTLSConfig(options)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	if options.OnResponse != nil {
+		return &http.Client{Transport: recordingTransport{next: transport, record: options.OnResponse}}, nil
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// NewHTTPClient builds an http client with the proxy and TLS settings in options, for requests made to hosts other
+// than LaunchDarkly, such as git host APIs. OnResponse is ignored, so that only LaunchDarkly requests are recorded.
+func NewHTTPClient(options ApiOptions) (*http.Client, error) {
+	options.OnResponse = nil
+	return newHTTPClient(options)
+}
+
+// Response describes a request made to LaunchDarkly. Error is set if no response was received.
+type Response struct {
+	Method     string  `json:"method"`
+	Path       string  `json:"path"`
+	StatusCode int     `json:"statusCode,omitempty"`
+	Duration   float64 `json:"durationSeconds"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// recordingTransport reports every round trip. Only the method and path are recorded, so that neither
+// credentials nor query parameters are exposed.
+type recordingTransport struct {
+	next   http.RoundTripper
+	record func(Response)
+}
+
+func (t recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	res, err := t.next.RoundTrip(req)
+	r := Response{Method: req.Method, Path: req.URL.Path, Duration: time.Since(start).Seconds()}
+	if err != nil {
+		r.Error = err.Error()
+	} else {
+		r.StatusCode = res.StatusCode
+	}
+	t.record(r)
+	return res, err
+}
+
+// newTLSConfig returns the TLS settings configured by options, or nil if there are none, so that Go's defaults apply
+func newTLSConfig(options ApiOptions) (*tls.Config, error) {
+	if options.TLSMinVersion == "" && len(options.CACertFiles) == 0 && options.ClientCertFile == "" && options.ClientKeyFile == "" {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{}
+
+	if options.TLSMinVersion != "" {
+		minVersion, err := ParseTLSVersion(options.TLSMinVersion)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.MinVersion = minVersion
+	}
+
+	if len(options.CACertFiles) > 0 {
+		// extend the system pool rather than replacing it, so that public endpoints remain reachable
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		for _, path := range options.CACertFiles {
+			/* #nosec */
+			pem, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("could not read CA certificate file: %s", err)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no PEM encoded certificates found in CA certificate file %s", path)
+			}
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if options.ClientCertFile != "" || options.ClientKeyFile != "" {
+		if options.ClientCertFile == "" || options.ClientKeyFile == "" {
+			return nil, fmt.Errorf("a client certificate and a client key must be provided together")
+		}
+		cert, err := tls.LoadX509KeyPair(options.ClientCertFile, options.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,175 @@
+package ld
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const branchesResponse = `{"items":[{"name":"master"}]}`
+
+func branchesHandler(res http.ResponseWriter, req *http.Request) {
+	_, _ = res.Write([]byte(branchesResponse))
+}
+
+func writeTempFile(t *testing.T, dir, name string, contents []byte) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(path, contents, 0600))
+	return path
+}
+
+func writeServerCA(t *testing.T, dir string, server *httptest.Server) string {
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	return writeTempFile(t, dir, "ca.pem", certPem)
+}
+
+// generateClientCert writes a self-signed client certificate and key to dir
+func generateClientCert(t *testing.T, dir string) (certPath, keyPath string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ld-find-code-refs"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certPath = writeTempFile(t, dir, "client.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	keyPath = writeTempFile(t, dir, "client-key.pem", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}))
+	return certPath, keyPath
+}
+
+func TestTransportOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ld-transport")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	retryMax := 0
+
+	t.Run("trusts additional CA certificates", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.HandlerFunc(branchesHandler))
+		defer server.Close()
+
+		untrusted, err := InitApiClient(ApiOptions{BaseUri: server.URL, RetryMax: &retryMax})
+		require.NoError(t, err)
+		_, err = untrusted.GetCodeReferenceRepositoryBranches(context.Background(), "test")
+		require.Error(t, err)
+
+		trusted, err := InitApiClient(ApiOptions{BaseUri: server.URL, RetryMax: &retryMax, CACertFiles: []string{writeServerCA(t, dir, server)}})
+		require.NoError(t, err)
+		branches, err := trusted.GetCodeReferenceRepositoryBranches(context.Background(), "test")
+		require.NoError(t, err)
+		require.Equal(t, []BranchRep{{Name: "master"}}, branches)
+	})
+
+	t.Run("presents client certificates", func(t *testing.T) {
+		server := httptest.NewUnstartedServer(http.HandlerFunc(branchesHandler))
+		server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+		server.StartTLS()
+		defer server.Close()
+		caPath := writeServerCA(t, dir, server)
+
+		withoutCert, err := InitApiClient(ApiOptions{BaseUri: server.URL, RetryMax: &retryMax, CACertFiles: []string{caPath}})
+		require.NoError(t, err)
+		_, err = withoutCert.GetCodeReferenceRepositoryBranches(context.Background(), "test")
+		require.Error(t, err)
+
+		certPath, keyPath := generateClientCert(t, dir)
+		withCert, err := InitApiClient(ApiOptions{BaseUri: server.URL, RetryMax: &retryMax, CACertFiles: []string{caPath}, ClientCertFile: certPath, ClientKeyFile: keyPath})
+		require.NoError(t, err)
+		_, err = withCert.GetCodeReferenceRepositoryBranches(context.Background(), "test")
+		require.NoError(t, err)
+	})
+
+	t.Run("uses Go's TLS defaults when not configured", func(t *testing.T) {
+		tlsConfig, err := newTLSConfig(ApiOptions{})
+		require.NoError(t, err)
+		require.Nil(t, tlsConfig)
+	})
+
+	t.Run("enforces minimum TLS version", func(t *testing.T) {
+		server := httptest.NewUnstartedServer(http.HandlerFunc(branchesHandler))
+		server.TLS = &tls.Config{MinVersion: tls.VersionTLS10, MaxVersion: tls.VersionTLS11}
+		server.StartTLS()
+		defer server.Close()
+		caPath := writeServerCA(t, dir, server)
+
+		client, err := InitApiClient(ApiOptions{BaseUri: server.URL, RetryMax: &retryMax, CACertFiles: []string{caPath}, TLSMinVersion: "1.2"})
+		require.NoError(t, err)
+		_, err = client.GetCodeReferenceRepositoryBranches(context.Background(), "test")
+		require.Error(t, err)
+	})
+
+	t.Run("sends requests through proxy", func(t *testing.T) {
+		proxiedHosts := []string{}
+		proxy := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			proxiedHosts = append(proxiedHosts, req.URL.Host)
+			branchesHandler(res, req)
+		}))
+		defer proxy.Close()
+
+		client, err := InitApiClient(ApiOptions{BaseUri: "http://ld.example.com", RetryMax: &retryMax, ProxyUrl: proxy.URL})
+		require.NoError(t, err)
+		_, err = client.GetCodeReferenceRepositoryBranches(context.Background(), "test")
+		require.NoError(t, err)
+		require.Equal(t, []string{"ld.example.com"}, proxiedHosts)
+	})
+
+	t.Run("reports responses", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			if req.URL.Path == reposPath+"/missing/branches" {
+				res.WriteHeader(http.StatusNotFound)
+				return
+			}
+			branchesHandler(res, req)
+		}))
+		defer server.Close()
+
+		responses := []Response{}
+		client, err := InitApiClient(ApiOptions{BaseUri: server.URL, RetryMax: &retryMax, OnResponse: func(r Response) {
+			responses = append(responses, r)
+		}})
+		require.NoError(t, err)
+		_, err = client.GetCodeReferenceRepositoryBranches(context.Background(), "test")
+		require.NoError(t, err)
+		_, err = client.GetCodeReferenceRepositoryBranches(context.Background(), "missing")
+		require.Error(t, err)
+
+		require.Len(t, responses, 2)
+		require.Equal(t, "GET", responses[0].Method)
+		require.Equal(t, reposPath+"/test/branches", responses[0].Path)
+		require.Equal(t, http.StatusOK, responses[0].StatusCode)
+		require.Equal(t, http.StatusNotFound, responses[1].StatusCode)
+		require.Empty(t, responses[1].Error)
+	})
+
+	t.Run("fails on invalid options", func(t *testing.T) {
+		_, err := InitApiClient(ApiOptions{ClientCertFile: "client.pem"})
+		require.EqualError(t, err, "a client certificate and a client key must be provided together")
+
+		_, err = InitApiClient(ApiOptions{TLSMinVersion: "2.0"})
+		require.EqualError(t, err, `unsupported TLS version "2.0", expected one of 1.0, 1.1 or 1.2`)
+
+		_, err = InitApiClient(ApiOptions{CACertFiles: []string{filepath.Join(dir, "missing.pem")}})
+		require.Error(t, err)
+	})
+}
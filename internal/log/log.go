@@ -1,9 +1,17 @@
 package log
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
 )
 
 // Global package level loggers
@@ -16,30 +24,208 @@ var (
 	Stdout  *log.Logger
 )
 
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+
+	LevelDebug = "debug"
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+	levelFatal = "fatal"
+
+	// CodeInternal is the error code of unexpected errors, logged by the Fatal logger
+	CodeInternal = "internal_error"
+
+	issueUrl = "https://github.com/launchdarkly/ld-find-code-refs"
+)
+
+var levels = []string{LevelDebug, LevelInfo, LevelWarn, LevelError}
+
+// Fields are structured data attached to log messages in the JSON format
+type Fields map[string]interface{}
+
+var (
+	currentFormat = FormatText
+	// writers of each level, which discard messages below the minimum level
+	writers = map[string]io.Writer{}
+	// outputMu serializes writes of JSON messages, which may be built from several fields
+	outputMu sync.Mutex
+
+	contextMu sync.Mutex
+	context   = Fields{}
+)
+
 // Init overrides the default loggers that write to stdout
 func Init(debug bool) {
-	debugHandle := ioutil.Discard
+	level := LevelInfo
 	if debug {
-		debugHandle = os.Stdout
+		level = LevelDebug
 	}
+	_ = Configure(FormatText, level)
+}
 
-	Debug = log.New(debugHandle,
-		"DEBUG: ",
-		log.Ldate|log.Ltime|log.Lshortfile)
+// ValidFormat reports whether f is a supported log format
+func ValidFormat(f string) bool {
+	return f == FormatText || f == FormatJSON
+}
 
-	Info = log.New(os.Stdout,
-		"INFO: ",
-		log.Ldate|log.Ltime|log.Lshortfile)
+// ValidLevel reports whether l is a supported log level
+func ValidLevel(l string) bool {
+	return levelIndex(l) >= 0
+}
 
-	Warning = log.New(os.Stdout,
-		"WARNING: ",
-		log.Ldate|log.Ltime|log.Lshortfile)
+func levelIndex(l string) int {
+	for i, level := range levels {
+		if level == l {
+			return i
+		}
+	}
+	return -1
+}
+
+// Configure overrides the default loggers. Messages are written as text lines prefixed with their level, or as JSON
+// objects with the fields set by SetField, and messages below the minimum level are discarded.
+func Configure(logFormat, minLevel string) error {
+	if !ValidFormat(logFormat) {
+		return fmt.Errorf("log format must be one of %s or %s", FormatText, FormatJSON)
+	}
+	if !ValidLevel(minLevel) {
+		return fmt.Errorf("log level must be one of %s", strings.Join(levels, ", "))
+	}
+	currentFormat = logFormat
+
+	output := func(level string, out io.Writer) io.Writer {
+		if level != levelFatal && levelIndex(level) < levelIndex(minLevel) {
+			out = ioutil.Discard
+		}
+		writers[level] = out
+		return out
+	}
+	newLogger := func(level string, out io.Writer, prefix string) *log.Logger {
+		out = output(level, out)
+		if currentFormat == FormatJSON && out != ioutil.Discard {
+			return log.New(&jsonWriter{level: level, out: out}, "", log.Lshortfile)
+		}
+		return log.New(out, prefix, log.Ldate|log.Ltime|log.Lshortfile)
+	}
 
-	Error = log.New(os.Stderr,
-		"ERROR: ",
-		log.Ldate|log.Ltime|log.Lshortfile)
+	Debug = newLogger(LevelDebug, os.Stdout, "DEBUG: ")
+	Info = newLogger(LevelInfo, os.Stdout, "INFO: ")
+	Warning = newLogger(LevelWarn, os.Stdout, "WARNING: ")
+	Error = newLogger(LevelError, os.Stderr, "ERROR: ")
+	// the Fatal logger is only used for unexpected errors, which are likely to be bugs
+	Fatal = newLogger(levelFatal, os.Stderr, "FATAL Please file an issue at "+issueUrl+": ")
+	return nil
+}
+
+// SetField attaches a field to every following JSON log message, e.g. the name of the repository being scanned
+func SetField(key string, value interface{}) {
+	contextMu.Lock()
+	defer contextMu.Unlock()
+	context[key] = value
+}
+
+// DeleteField removes a field set by SetField
+func DeleteField(key string) {
+	contextMu.Lock()
+	defer contextMu.Unlock()
+	delete(context, key)
+}
+
+// Entry is a log message with additional fields
+type Entry struct {
+	fields Fields
+}
 
-	Fatal = log.New(os.Stderr,
-		"FATAL Please file an issue at https://github.com/launchdarkly/ld-find-code-refs: ",
-		log.Ldate|log.Ltime|log.Lshortfile)
+// With returns an entry which attaches fields to a single JSON log message. Text messages are unchanged.
+func With(fields Fields) Entry {
+	return Entry{fields: fields}
+}
+
+func (e Entry) Debugf(format string, args ...interface{}) {
+	e.output(LevelDebug, Debug, format, args...)
+}
+
+func (e Entry) Infof(format string, args ...interface{}) {
+	e.output(LevelInfo, Info, format, args...)
+}
+
+func (e Entry) Warningf(format string, args ...interface{}) {
+	e.output(LevelWarn, Warning, format, args...)
+}
+
+func (e Entry) Errorf(format string, args ...interface{}) {
+	e.output(LevelError, Error, format, args...)
+}
+
+// Fatalf logs an error which ends the run, and exits with a non-zero status. Unlike the Fatal logger, it is meant for
+// expected errors, such as invalid options or failed requests.
+func (e Entry) Fatalf(format string, args ...interface{}) {
+	e.output(LevelError, Error, format, args...)
+	os.Exit(1)
+}
+
+func (e Entry) output(level string, logger *log.Logger, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	out := writers[level]
+	if out == ioutil.Discard {
+		return
+	}
+	if currentFormat != FormatJSON || out == nil {
+		_ = logger.Output(3, msg)
+		return
+	}
+	caller := ""
+	if _, file, line, ok := runtime.Caller(2); ok {
+		caller = fmt.Sprintf("%s:%d", filepath.Base(file), line)
+	}
+	writeJSON(out, level, caller, msg, e.fields)
+}
+
+// jsonWriter converts the lines written by a logger into JSON objects
+type jsonWriter struct {
+	level string
+	out   io.Writer
+}
+
+func (w *jsonWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSuffix(string(p), "\n")
+	caller := ""
+	// log.Lshortfile prefixes each message with `file.go:123: `
+	if i := strings.Index(msg, ": "); i > 0 && !strings.ContainsAny(msg[:i], " \t") {
+		caller, msg = msg[:i], msg[i+2:]
+	}
+	var fields Fields
+	if w.level == levelFatal {
+		fields = Fields{"errorCode": CodeInternal, "hint": "Please file an issue at " + issueUrl}
+	}
+	writeJSON(w.out, w.level, caller, msg, fields)
+	return len(p), nil
+}
+
+func writeJSON(out io.Writer, level, caller, msg string, fields Fields) {
+	entry := Fields{}
+	contextMu.Lock()
+	for k, v := range context {
+		entry[k] = v
+	}
+	contextMu.Unlock()
+	for k, v := range fields {
+		entry[k] = v
+	}
+	entry["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	entry["level"] = level
+	entry["msg"] = msg
+	if caller != "" {
+		entry["caller"] = caller
+	}
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		b, _ = json.Marshal(Fields{"time": entry["time"], "level": level, "msg": msg, "caller": caller})
+	}
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	_, _ = out.Write(append(b, '\n'))
 }
@@ -0,0 +1,51 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONWriter(t *testing.T) {
+	var out bytes.Buffer
+	logger := log.New(&jsonWriter{level: LevelWarn, out: &out}, "", log.Lshortfile)
+
+	SetField("repo", "my-repo")
+	defer DeleteField("repo")
+	logger.Printf("omitting %d flags: %s", 2, "a, b")
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &entry))
+	require.Equal(t, "warn", entry["level"])
+	require.Equal(t, "omitting 2 flags: a, b", entry["msg"])
+	require.Equal(t, "my-repo", entry["repo"])
+	require.Regexp(t, `^log_test.go:\d+$`, entry["caller"])
+	require.NotEmpty(t, entry["time"])
+}
+
+func TestJSONWriterFatal(t *testing.T) {
+	var out bytes.Buffer
+	logger := log.New(&jsonWriter{level: levelFatal, out: &out}, "", log.Lshortfile)
+	logger.Printf("search results returned out of order")
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &entry))
+	require.Equal(t, "fatal", entry["level"])
+	require.Equal(t, CodeInternal, entry["errorCode"])
+	require.Equal(t, "search results returned out of order", entry["msg"])
+}
+
+func TestConfigure(t *testing.T) {
+	require.NoError(t, Configure(FormatJSON, LevelWarn))
+	defer Init(false)
+	require.IsType(t, &jsonWriter{}, Warning.Writer())
+	require.Equal(t, ioutil.Discard, Info.Writer())
+	require.IsType(t, &jsonWriter{}, Fatal.Writer())
+
+	require.Error(t, Configure("xml", LevelInfo))
+	require.Error(t, Configure(FormatText, "trace"))
+}
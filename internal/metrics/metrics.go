@@ -0,0 +1,127 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Prefix is the prefix of the names of all metrics written by the scanner
+const Prefix = "ld_find_code_refs_"
+
+// Type is the type of a metric family. Only gauges are written by the scanner, since each file describes a single
+// run, so values don't accumulate across runs.
+type Type string
+
+const Gauge Type = "gauge"
+
+// Labels identify a sample within a metric family
+type Labels map[string]string
+
+type Sample struct {
+	Labels Labels
+	Value  float64
+}
+
+// Family is a named group of samples, such as the number of references to each flag
+type Family struct {
+	Name    string
+	Help    string
+	Type    Type
+	Samples []Sample
+}
+
+// Write writes families in the OpenMetrics text format, see https://openmetrics.io. Samples are sorted by their
+// labels, so that the output is stable between runs.
+func Write(w io.Writer, families []Family) error {
+	var b bytes.Buffer
+	for _, f := range families {
+		name := Prefix + f.Name
+		fmt.Fprintf(&b, "# TYPE %s %s\n", name, f.Type)
+		fmt.Fprintf(&b, "# HELP %s %s\n", name, escape(f.Help, false))
+		samples := make([]sample, 0, len(f.Samples))
+		for _, s := range f.Samples {
+			samples = append(samples, sample{labels: formatLabels(s.Labels), value: s.Value})
+		}
+		sort.SliceStable(samples, func(i, j int) bool { return samples[i].labels < samples[j].labels })
+		for _, s := range samples {
+			fmt.Fprintf(&b, "%s%s %s\n", name, s.labels, formatValue(s.value))
+		}
+	}
+	b.WriteString("# EOF\n")
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// WriteFile writes families to path. The file is replaced atomically, so that collectors never read a partial file.
+func WriteFile(path string, families []Family) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	err = Write(tmp, families)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	// temporary files are created readable only by their owner, but collectors may run as another user
+	err = os.Chmod(tmp.Name(), 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+type sample struct {
+	labels string
+	value  float64
+}
+
+func formatLabels(labels Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, escape(labels[name], true)))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// escape escapes backslashes and newlines, and double quotes in label values
+func escape(s string, quoted bool) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	if quoted {
+		s = strings.Replace(s, `"`, `\"`, -1)
+	}
+	return s
+}
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+	var b bytes.Buffer
+	err := Write(&b, []Family{
+		{Name: "scan_success", Help: "Whether the scan succeeded.", Type: Gauge, Samples: []Sample{{Value: 1}}},
+		{Name: "references", Help: "The number of references.", Type: Gauge, Samples: []Sample{
+			{Labels: Labels{"repository": "web", "flag": "new-ui"}, Value: 12},
+			{Labels: Labels{"repository": "api", "flag": `say "hi"\n`}, Value: 0.5},
+		}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, `# TYPE ld_find_code_refs_scan_success gauge
+# HELP ld_find_code_refs_scan_success Whether the scan succeeded.
+ld_find_code_refs_scan_success 1
+# TYPE ld_find_code_refs_references gauge
+# HELP ld_find_code_refs_references The number of references.
+ld_find_code_refs_references{flag="new-ui",repository="web"} 12
+ld_find_code_refs_references{flag="say \"hi\"\\n",repository="api"} 0.5
+# EOF
+`, b.String())
+}
+
+func TestWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metrics")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "ld_find_code_refs.prom")
+	require.NoError(t, ioutil.WriteFile(path, []byte("stale"), 0644))
+	require.NoError(t, WriteFile(path, []Family{{Name: "scan_success", Help: "Whether the scan succeeded.", Type: Gauge, Samples: []Sample{{Value: 0}}}}))
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(data), "ld_find_code_refs_scan_success 0\n")
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+}
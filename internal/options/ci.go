@@ -0,0 +1,95 @@
+package options
+
+import (
+	"flag"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ci"
+)
+
+// detectedBuild is the build of the CI provider detected when options were initialized
+var detectedBuild *ci.Build
+
+// detectionErr is the error reading the build of the detected CI provider, if any
+var detectionErr error
+
+// DetectedBuild returns the build of the CI provider detected when options were initialized, or nil if no CI provider
+// was detected, or the detectCi option was disabled.
+func DetectedBuild() *ci.Build {
+	return detectedBuild
+}
+
+// DetectionError returns the error reading the build of the CI provider detected when options were initialized, if
+// any. It is reported as a warning, since options are then only read from the command line.
+func DetectionError() error {
+	return detectionErr
+}
+
+// detectedOptions are the options read from the build of a detected CI provider. The pull request options supplied by
+// the build post comments and summaries, so they are only set by the wrappers for each provider.
+var detectedOptions = map[string]bool{
+	RepoType.name():          true,
+	RepoName.name():          true,
+	RepoUrl.name():           true,
+	CommitUrlTemplate.name(): true,
+	HunkUrlTemplate.name():   true,
+	Dir.name():               true,
+	Branch.name():            true,
+	Tag.name():               true,
+	DefaultBranch.name():     true,
+	UpdateSequenceId.name():  true,
+}
+
+// repositoryOptions describe the repository being scanned, so they aren't read if the config file defines repositories
+var repositoryOptions = map[string]bool{
+	RepoType.name():          true,
+	RepoName.name():          true,
+	RepoUrl.name():           true,
+	CommitUrlTemplate.name(): true,
+	HunkUrlTemplate.name():   true,
+}
+
+// applyCI sets the options that were not provided from the build of the CI provider detected in env, if any
+func applyCI(env ci.Env) {
+	build, err := ci.Detect(env)
+	if err != nil || build == nil {
+		detectionErr = err
+		return
+	}
+	provided := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		provided[f.Name] = true
+	})
+	// an invalid config file is reported when options are validated
+	c, _ := ReadConfig(ConfigFile.Value())
+	for name, value := range ciOptions(*build, provided, len(c.Repositories) > 0) {
+		err := flag.Set(name, value)
+		if err != nil {
+			detectionErr = err
+			return
+		}
+	}
+	detectedBuild = build
+}
+
+// ciOptions returns the options supplied by build which were not provided
+func ciOptions(build ci.Build, provided map[string]bool, configuredRepositories bool) map[string]string {
+	ret := map[string]string{}
+	for name, value := range build.Options() {
+		if provided[name] {
+			continue
+		}
+		// branch and tag are mutually exclusive
+		if (name == Branch.name() || name == Tag.name()) && (provided[Branch.name()] || provided[Tag.name()]) {
+			continue
+		}
+		if !detectedOptions[name] {
+			continue
+		}
+		// the repository isn't read if the config file defines repositories, since those are scanned instead
+		if configuredRepositories && repositoryOptions[name] {
+			continue
+		}
+		ret[name] = value
+	}
+	return ret
+}
@@ -0,0 +1,88 @@
+package options
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ci"
+)
+
+func TestCiOptions(t *testing.T) {
+	build := ci.Build{
+		Provider:         "GitLab CI",
+		RepoType:         "gitlab",
+		RepoName:         "my-project",
+		RepoUrl:          "https://gitlab.com/my-group/my-project",
+		Dir:              "/builds/my-group/my-project",
+		Branch:           "feature/a",
+		DefaultBranch:    "main",
+		UpdateSequenceId: 42,
+		BaseBranch:       "main",
+		CommentUrl:       "https://gitlab.com/api/v4/projects/7/merge_requests/3/notes",
+		StepSummaryFile:  "/tmp/step_summary",
+	}
+	specs := []struct {
+		name                   string
+		provided               []string
+		configuredRepositories bool
+		expected               map[string]string
+	}{
+		{
+			name: "no options provided",
+			expected: map[string]string{
+				"repoType":         "gitlab",
+				"repoName":         "my-project",
+				"repoUrl":          "https://gitlab.com/my-group/my-project",
+				"dir":              "/builds/my-group/my-project",
+				"branch":           "feature/a",
+				"defaultBranch":    "main",
+				"updateSequenceId": "42",
+			},
+		},
+		{
+			name:     "provided options are not replaced",
+			provided: []string{"repoName", "dir", "updateSequenceId"},
+			expected: map[string]string{
+				"repoType":      "gitlab",
+				"repoUrl":       "https://gitlab.com/my-group/my-project",
+				"branch":        "feature/a",
+				"defaultBranch": "main",
+			},
+		},
+		{
+			name:     "provided tag replaces the branch",
+			provided: []string{"tag"},
+			expected: map[string]string{
+				"repoType":         "gitlab",
+				"repoName":         "my-project",
+				"repoUrl":          "https://gitlab.com/my-group/my-project",
+				"dir":              "/builds/my-group/my-project",
+				"defaultBranch":    "main",
+				"updateSequenceId": "42",
+			},
+		},
+		{
+			name:                   "repositories from the config file",
+			configuredRepositories: true,
+			expected: map[string]string{
+				"dir":              "/builds/my-group/my-project",
+				"branch":           "feature/a",
+				"defaultBranch":    "main",
+				"updateSequenceId": "42",
+			},
+		},
+	}
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			provided := map[string]bool{}
+			for _, name := range tt.provided {
+				provided[name] = true
+			}
+			assert.Equal(t, tt.expected, ciOptions(build, provided, tt.configuredRepositories))
+		})
+	}
+
+	tagged := ci.Build{RepoName: "my-project", Dir: "/builds/my-group/my-project", Tag: "v1.0.0"}
+	assert.Equal(t, map[string]string{"repoName": "my-project", "dir": "/builds/my-group/my-project", "tag": "v1.0.0"}, ciOptions(tagged, map[string]bool{}, false))
+}
@@ -0,0 +1,269 @@
+package options
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/glob"
+	"github.com/launchdarkly/ld-find-code-refs/internal/lang"
+)
+
+// Config holds settings which are too structured to be expressed as command line options.
+// It is read from the JSON file provided by the configFile option.
+type Config struct {
+	Projects     []ProjectConfig    `json:"projects,omitempty"`
+	Repositories []RepositoryConfig `json:"repositories,omitempty"`
+	Redaction    RedactionConfig    `json:"redaction,omitempty"`
+	ContextLines []ContextLinesRule `json:"contextLines,omitempty"`
+	// ReferenceKinds limits the references counted in files of supported languages to those appearing in the
+	// given kinds of token: "identifier", "string" or "comment". By default, all references are counted.
+	ReferenceKinds []string `json:"referenceKinds,omitempty"`
+	// UsageRules extend the rules used to classify how flags are used, and are tried before the built-in rules
+	UsageRules []UsageRuleConfig `json:"usageRules,omitempty"`
+	// ReferenceUsages limits the references counted in files of supported languages to those with the given
+	// usages: "evaluation", "constant", "mock" or "other". By default, all references are counted.
+	ReferenceUsages []string `json:"referenceUsages,omitempty"`
+}
+
+// ProjectConfig describes a LaunchDarkly project whose flags should be searched for. If paths are provided,
+// references are only attributed to the project in files matching one of the glob patterns.
+type ProjectConfig struct {
+	Key   string   `json:"key"`
+	Paths []string `json:"paths,omitempty"`
+}
+
+// RepositoryConfig maps part of the checkout to its own code reference repository. Files matching any of the
+// glob patterns in paths are reported to the repository, with paths relative to root. If root is not provided,
+// it defaults to the directory shared by all patterns, e.g. `services/payments` for `services/payments/**`.
+type RepositoryConfig struct {
+	Name              string   `json:"name"`
+	Type              string   `json:"type,omitempty"`
+	Url               string   `json:"url,omitempty"`
+	CommitUrlTemplate string   `json:"commitUrlTemplate,omitempty"`
+	HunkUrlTemplate   string   `json:"hunkUrlTemplate,omitempty"`
+	DefaultBranch     string   `json:"defaultBranch,omitempty"`
+	Root              string   `json:"root,omitempty"`
+	Paths             []string `json:"paths"`
+}
+
+// RedactionConfig adds patterns to the detectors used to redact potential secrets from source code sent to
+// LaunchDarkly. Patterns are regular expressions. If a pattern contains a capture group, only the text matched by
+// the first group is redacted, e.g. `internal_token: (\w+)`.
+type RedactionConfig struct {
+	Patterns []string `json:"patterns,omitempty"`
+}
+
+// ContextLinesRule overrides the contextLines option for files matching any of the glob patterns in paths. A negative
+// value sends no source code for matching files, only the location of each reference. When several rules match a
+// file, the first one applies.
+type ContextLinesRule struct {
+	Paths        []string `json:"paths"`
+	ContextLines int      `json:"contextLines"`
+}
+
+// UsageRuleConfig classifies references matching a regular expression as a usage. The pattern may contain
+// `{flagKey}`, which matches the referenced flag key. Rules may be limited to languages and glob patterns.
+type UsageRuleConfig struct {
+	Usage     string   `json:"usage"`
+	Pattern   string   `json:"pattern,omitempty"`
+	Languages []string `json:"languages,omitempty"`
+	Paths     []string `json:"paths,omitempty"`
+}
+
+var (
+	config        *Config
+	validRepoName = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+)
+
+// GetConfig returns the configuration read from the configFile option, or an empty configuration if the
+// option was not provided. The file is only read once.
+func GetConfig() (Config, error) {
+	if config != nil {
+		return *config, nil
+	}
+	c, err := ReadConfig(ConfigFile.Value())
+	if err != nil {
+		return c, err
+	}
+	config = &c
+	return c, nil
+}
+
+func ReadConfig(path string) (Config, error) {
+	c := Config{}
+	if path == "" {
+		return c, nil
+	}
+
+	/* #nosec */
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(data, &c)
+	if err != nil {
+		return c, fmt.Errorf("could not parse %s: %s", path, err)
+	}
+	return c, c.validate()
+}
+
+func (c Config) validate() error {
+	seen := map[string]bool{}
+	for _, p := range c.Projects {
+		if p.Key == "" {
+			return fmt.Errorf("projects must have a key")
+		}
+		if seen[p.Key] {
+			return fmt.Errorf("project %s is configured more than once", p.Key)
+		}
+		seen[p.Key] = true
+		for _, pattern := range p.Paths {
+			if !glob.Valid(pattern) {
+				return fmt.Errorf("invalid path pattern for project %s: %s", p.Key, pattern)
+			}
+		}
+	}
+	names := map[string]bool{}
+	for _, r := range c.Repositories {
+		if !validRepoName.MatchString(r.Name) {
+			return fmt.Errorf("invalid repository name %q: repository names must only contain letters, numbers, '.', '_' or '-'", r.Name)
+		}
+		if names[strings.ToLower(r.Name)] {
+			return fmt.Errorf("repository %s is configured more than once", r.Name)
+		}
+		names[strings.ToLower(r.Name)] = true
+		if r.Type != "" && !ValidRepoType(r.Type) {
+			return fmt.Errorf("invalid type for repository %s: %s", r.Name, repoTypeError)
+		}
+		if len(r.Paths) == 0 {
+			return fmt.Errorf("repository %s must have at least one path", r.Name)
+		}
+		for _, pattern := range r.Paths {
+			if !glob.Valid(pattern) {
+				return fmt.Errorf("invalid path pattern for repository %s: %s", r.Name, pattern)
+			}
+		}
+	}
+	for i, rule := range c.ContextLines {
+		if len(rule.Paths) == 0 {
+			return fmt.Errorf("context lines rule %d must have at least one path", i+1)
+		}
+		for _, pattern := range rule.Paths {
+			if !glob.Valid(pattern) {
+				return fmt.Errorf("invalid path pattern for context lines rule %d: %s", i+1, pattern)
+			}
+		}
+		if rule.ContextLines > maxContextLines {
+			return fmt.Errorf("context lines rule %d must not exceed %d context lines", i+1, maxContextLines)
+		}
+	}
+	for _, kind := range c.ReferenceKinds {
+		if !lang.ValidKind(kind) {
+			return fmt.Errorf(`invalid reference kind %q: reference kinds must be "identifier", "string" or "comment"`, kind)
+		}
+	}
+	for i, rule := range c.UsageRules {
+		if !lang.ValidUsage(rule.Usage) {
+			return fmt.Errorf(`invalid usage for usage rule %d: usages must be "evaluation", "constant", "mock" or "other"`, i+1)
+		}
+		if rule.Pattern == "" && len(rule.Paths) == 0 {
+			return fmt.Errorf("usage rule %d must have a pattern or at least one path", i+1)
+		}
+		if _, err := lang.CompileUsagePattern(rule.Pattern); err != nil {
+			return fmt.Errorf("usage rule %d: %s", i+1, err)
+		}
+		for _, l := range rule.Languages {
+			if !lang.Supported(l) {
+				return fmt.Errorf("unsupported language for usage rule %d: %s", i+1, l)
+			}
+		}
+		for _, pattern := range rule.Paths {
+			if !glob.Valid(pattern) {
+				return fmt.Errorf("invalid path pattern for usage rule %d: %s", i+1, pattern)
+			}
+		}
+	}
+	for _, usage := range c.ReferenceUsages {
+		if !lang.ValidUsage(usage) {
+			return fmt.Errorf(`invalid reference usage %q: reference usages must be "evaluation", "constant", "mock" or "other"`, usage)
+		}
+	}
+	for _, pattern := range c.Redaction.Patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid redaction pattern %q: %s", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Repositories returns the repositories to report references to: those in the config file, followed by the
+// repository described by the repo* options, if provided. The latter receives references in all files not
+// claimed by a configured repository.
+func Repositories() ([]RepositoryConfig, error) {
+	c, err := GetConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	repos := make([]RepositoryConfig, 0, len(c.Repositories)+1)
+	for _, r := range c.Repositories {
+		if r.Type == "" {
+			r.Type = "custom"
+		}
+		if r.Root == "" {
+			r.Root = glob.CommonBase(r.Paths)
+		}
+		repos = append(repos, r)
+	}
+
+	if RepoName.Value() != "" {
+		repos = append(repos, RepositoryConfig{
+			Name:              RepoName.Value(),
+			Type:              RepoType.Value(),
+			Url:               RepoUrl.Value(),
+			CommitUrlTemplate: CommitUrlTemplate.Value(),
+			HunkUrlTemplate:   HunkUrlTemplate.Value(),
+			DefaultBranch:     DefaultBranch.Value(),
+		})
+	}
+	return repos, nil
+}
+
+// Projects returns the projects to be scanned: one for each key in the projKey option, followed by those in the
+// config file. A project defined in both places uses the path scoping from the config file.
+func Projects() ([]ProjectConfig, error) {
+	c, err := GetConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	configured := map[string]bool{}
+	for _, p := range c.Projects {
+		configured[p.Key] = true
+	}
+
+	projects := []ProjectConfig{}
+	for _, key := range ProjKeys() {
+		if !configured[key] {
+			projects = append(projects, ProjectConfig{Key: key})
+		}
+	}
+	return append(projects, c.Projects...), nil
+}
+
+// ProjKeys splits the projKey option into individual project keys
+func ProjKeys() []string {
+	keys := []string{}
+	seen := map[string]bool{}
+	for _, key := range strings.Split(ProjKey.Value(), ",") {
+		key = strings.TrimSpace(key)
+		if key != "" && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,145 @@
+package options
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ld-config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	specs := []struct {
+		name        string
+		contents    string
+		expected    Config
+		expectedErr string
+	}{
+		{
+			name:     "reads projects",
+			contents: `{"projects": [{"key": "web", "paths": ["frontend/**"]}, {"key": "platform"}]}`,
+			expected: Config{Projects: []ProjectConfig{{Key: "web", Paths: []string{"frontend/**"}}, {Key: "platform"}}},
+		},
+		{
+			name:     "reads repositories",
+			contents: `{"repositories": [{"name": "payments", "type": "github", "paths": ["services/payments/**"]}]}`,
+			expected: Config{Repositories: []RepositoryConfig{{Name: "payments", Type: "github", Paths: []string{"services/payments/**"}}}},
+		},
+		{
+			name:        "fails on invalid repository name",
+			contents:    `{"repositories": [{"name": "pay ments", "paths": ["services/payments/**"]}]}`,
+			expectedErr: `invalid repository name "pay ments": repository names must only contain letters, numbers, '.', '_' or '-'`,
+		},
+		{
+			name:        "fails on duplicate repository",
+			contents:    `{"repositories": [{"name": "payments", "paths": ["a/**"]}, {"name": "Payments", "paths": ["b/**"]}]}`,
+			expectedErr: "repository Payments is configured more than once",
+		},
+		{
+			name:        "fails on repository without paths",
+			contents:    `{"repositories": [{"name": "payments"}]}`,
+			expectedErr: "repository payments must have at least one path",
+		},
+		{
+			name:        "fails on invalid repository type",
+			contents:    `{"repositories": [{"name": "payments", "type": "svn", "paths": ["a/**"]}]}`,
+			expectedErr: `invalid type for repository payments: repo type must be "custom", "bitbucket", "github", or "gitlab"`,
+		},
+		{
+			name:        "fails on missing project key",
+			contents:    `{"projects": [{"paths": ["frontend/**"]}]}`,
+			expectedErr: "projects must have a key",
+		},
+		{
+			name:        "fails on duplicate project",
+			contents:    `{"projects": [{"key": "web"}, {"key": "web"}]}`,
+			expectedErr: "project web is configured more than once",
+		},
+		{
+			name:     "reads redaction patterns",
+			contents: `{"redaction": {"patterns": ["internal_token: (\\w+)"]}}`,
+			expected: Config{Redaction: RedactionConfig{Patterns: []string{`internal_token: (\w+)`}}},
+		},
+		{
+			name:        "fails on invalid redaction pattern",
+			contents:    `{"redaction": {"patterns": ["(token"]}}`,
+			expectedErr: "invalid redaction pattern \"(token\": error parsing regexp: missing closing ): `(token`",
+		},
+		{
+			name:     "reads context lines rules",
+			contents: `{"contextLines": [{"paths": ["billing/**", "crypto/**"], "contextLines": -1}]}`,
+			expected: Config{ContextLines: []ContextLinesRule{{Paths: []string{"billing/**", "crypto/**"}, ContextLines: -1}}},
+		},
+		{
+			name:        "fails on context lines rule without paths",
+			contents:    `{"contextLines": [{"contextLines": -1}]}`,
+			expectedErr: "context lines rule 1 must have at least one path",
+		},
+		{
+			name:        "fails on too many context lines",
+			contents:    `{"contextLines": [{"paths": ["frontend/**"], "contextLines": 6}]}`,
+			expectedErr: "context lines rule 1 must not exceed 5 context lines",
+		},
+		{
+			name:     "reads reference kinds",
+			contents: `{"referenceKinds": ["identifier", "string"]}`,
+			expected: Config{ReferenceKinds: []string{"identifier", "string"}},
+		},
+		{
+			name:        "fails on invalid reference kind",
+			contents:    `{"referenceKinds": ["docstring"]}`,
+			expectedErr: `invalid reference kind "docstring": reference kinds must be "identifier", "string" or "comment"`,
+		},
+		{
+			name:     "reads usage rules",
+			contents: `{"usageRules": [{"usage": "evaluation", "pattern": "featureGate\\(\"{flagKey}", "languages": ["go"]}], "referenceUsages": ["evaluation"]}`,
+			expected: Config{
+				UsageRules:      []UsageRuleConfig{{Usage: "evaluation", Pattern: `featureGate\("{flagKey}`, Languages: []string{"go"}}},
+				ReferenceUsages: []string{"evaluation"},
+			},
+		},
+		{
+			name:        "fails on invalid usage",
+			contents:    `{"usageRules": [{"usage": "call", "pattern": "gate"}]}`,
+			expectedErr: `invalid usage for usage rule 1: usages must be "evaluation", "constant", "mock" or "other"`,
+		},
+		{
+			name:        "fails on usage rule without pattern or paths",
+			contents:    `{"usageRules": [{"usage": "mock"}]}`,
+			expectedErr: "usage rule 1 must have a pattern or at least one path",
+		},
+		{
+			name:        "fails on unsupported usage rule language",
+			contents:    `{"usageRules": [{"usage": "mock", "pattern": "gate", "languages": ["cobol"]}]}`,
+			expectedErr: "unsupported language for usage rule 1: cobol",
+		},
+		{
+			name:        "fails on invalid reference usage",
+			contents:    `{"referenceUsages": ["call"]}`,
+			expectedErr: `invalid reference usage "call": reference usages must be "evaluation", "constant", "mock" or "other"`,
+		},
+		{
+			name:        "fails on invalid path pattern",
+			contents:    `{"projects": [{"key": "web", "paths": ["[a"]}]}`,
+			expectedErr: "invalid path pattern for project web: [a",
+		},
+	}
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "config.json")
+			require.NoError(t, ioutil.WriteFile(path, []byte(tt.contents), 0600))
+			c, err := ReadConfig(path)
+			if tt.expectedErr != "" {
+				require.EqualError(t, err, tt.expectedErr)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, tt.expected, c)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package options
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/validation"
+)
+
+// Manifest lists the checkouts scanned by the batch command
+type Manifest struct {
+	Repositories []ManifestEntry `json:"repositories"`
+}
+
+// ManifestEntry describes a local checkout. Fields other than dir and name fall back to the corresponding
+// command line options when omitted.
+type ManifestEntry struct {
+	Dir               string `json:"dir"`
+	Name              string `json:"name"`
+	Type              string `json:"type,omitempty"`
+	Url               string `json:"url,omitempty"`
+	CommitUrlTemplate string `json:"commitUrlTemplate,omitempty"`
+	HunkUrlTemplate   string `json:"hunkUrlTemplate,omitempty"`
+	DefaultBranch     string `json:"defaultBranch,omitempty"`
+	Branch            string `json:"branch,omitempty"`
+	Tag               string `json:"tag,omitempty"`
+	Exclude           string `json:"exclude,omitempty"`
+	UpdateSequenceId  *int64 `json:"updateSequenceId,omitempty"`
+}
+
+// ReadManifest reads and validates a manifest. Relative checkout paths are resolved against the manifest's directory.
+func ReadManifest(path string) (Manifest, error) {
+	m := Manifest{}
+
+	/* #nosec */
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return m, err
+	}
+	err = json.Unmarshal(data, &m)
+	if err != nil {
+		return m, fmt.Errorf("could not parse %s: %s", path, err)
+	}
+
+	if len(m.Repositories) == 0 {
+		return m, fmt.Errorf("manifest must list at least one repository")
+	}
+
+	names := map[string]bool{}
+	for i, r := range m.Repositories {
+		if !validRepoName.MatchString(r.Name) {
+			return m, fmt.Errorf("invalid repository name %q: repository names must only contain letters, numbers, '.', '_' or '-'", r.Name)
+		}
+		if names[strings.ToLower(r.Name)] {
+			return m, fmt.Errorf("repository %s is listed more than once", r.Name)
+		}
+		names[strings.ToLower(r.Name)] = true
+		if r.Type != "" && !ValidRepoType(r.Type) {
+			return m, fmt.Errorf("invalid type for repository %s: %s", r.Name, repoTypeError)
+		}
+		if _, err := regexp.Compile(r.Exclude); err != nil {
+			return m, fmt.Errorf("exclude for repository %s must be a valid regular expression: %s", r.Name, err)
+		}
+		if r.Branch != "" && r.Tag != "" {
+			return m, fmt.Errorf("repository %s must not have both a branch and a tag", r.Name)
+		}
+		if r.Dir == "" {
+			return m, fmt.Errorf("repository %s must have a dir", r.Name)
+		}
+		if !filepath.IsAbs(r.Dir) {
+			m.Repositories[i].Dir = filepath.Join(filepath.Dir(path), r.Dir)
+		}
+		if _, err := validation.NormalizeAndValidatePath(m.Repositories[i].Dir); err != nil {
+			return m, fmt.Errorf("invalid dir for repository %s: %s", r.Name, err)
+		}
+	}
+
+	return m, nil
+}
+
+// RepositoryConfig returns the repository configuration for the entry, using command line options for omitted fields
+func (e ManifestEntry) RepositoryConfig() RepositoryConfig {
+	c := RepositoryConfig{
+		Name:              e.Name,
+		Type:              e.Type,
+		Url:               e.Url,
+		CommitUrlTemplate: e.CommitUrlTemplate,
+		HunkUrlTemplate:   e.HunkUrlTemplate,
+		DefaultBranch:     e.DefaultBranch,
+	}
+	if c.Type == "" {
+		c.Type = RepoType.Value()
+	}
+	if c.DefaultBranch == "" {
+		c.DefaultBranch = DefaultBranch.Value()
+	}
+	return c
+}
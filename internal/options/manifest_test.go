@@ -0,0 +1,73 @@
+package options
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ld-manifest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "api"), 0700))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "web"), 0700))
+
+	updateId := int64(3)
+	specs := []struct {
+		name        string
+		contents    string
+		expected    Manifest
+		expectedErr string
+	}{
+		{
+			name:     "resolves relative dirs",
+			contents: `{"repositories": [{"dir": "api", "name": "api", "branch": "main", "updateSequenceId": 3}, {"dir": "` + filepath.Join(dir, "web") + `", "name": "web", "type": "github"}]}`,
+			expected: Manifest{Repositories: []ManifestEntry{
+				{Dir: filepath.Join(dir, "api"), Name: "api", Branch: "main", UpdateSequenceId: &updateId},
+				{Dir: filepath.Join(dir, "web"), Name: "web", Type: "github"},
+			}},
+		},
+		{
+			name:        "fails on empty manifest",
+			contents:    `{"repositories": []}`,
+			expectedErr: "manifest must list at least one repository",
+		},
+		{
+			name:        "fails on duplicate repository",
+			contents:    `{"repositories": [{"dir": "api", "name": "api"}, {"dir": "web", "name": "API"}]}`,
+			expectedErr: "repository API is listed more than once",
+		},
+		{
+			name:        "fails on missing dir",
+			contents:    `{"repositories": [{"name": "api"}]}`,
+			expectedErr: "repository api must have a dir",
+		},
+		{
+			name:        "fails on invalid repository type",
+			contents:    `{"repositories": [{"dir": "api", "name": "api", "type": "svn"}]}`,
+			expectedErr: `invalid type for repository api: repo type must be "custom", "bitbucket", "github", or "gitlab"`,
+		},
+		{
+			name:        "fails on invalid exclude",
+			contents:    `{"repositories": [{"dir": "api", "name": "api", "exclude": "["}]}`,
+			expectedErr: "exclude for repository api must be a valid regular expression: error parsing regexp: missing closing ]: `[`",
+		},
+	}
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "manifest.json")
+			require.NoError(t, ioutil.WriteFile(path, []byte(tt.contents), 0600))
+			m, err := ReadManifest(path)
+			if tt.expectedErr != "" {
+				require.EqualError(t, err, tt.expectedErr)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, tt.expected, m)
+			}
+		})
+	}
+}
@@ -8,7 +8,11 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/launchdarkly/ld-find-code-refs/internal/glob"
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
 	"github.com/launchdarkly/ld-find-code-refs/internal/validation"
 	"github.com/launchdarkly/ld-find-code-refs/internal/version"
 )
@@ -21,6 +25,7 @@ type stringOption string
 type intOption string
 type int64Option string
 type boolOption string
+type durationOption string
 type runeSet string
 
 func (o stringOption) name() string {
@@ -35,6 +40,9 @@ func (o int64Option) name() string {
 func (o boolOption) name() string {
 	return string(o)
 }
+func (o durationOption) name() string {
+	return string(o)
+}
 func (o runeSet) name() string {
 	return string(o)
 }
@@ -62,6 +70,17 @@ func (o boolOption) Value() bool {
 	return flag.Lookup(string(o)).Value.(flag.Getter).Get().(bool)
 }
 
+func (o durationOption) Value() time.Duration {
+	return flag.Lookup(string(o)).Value.(flag.Getter).Get().(time.Duration)
+}
+
+func (o durationOption) minimumError(min time.Duration) error {
+	if o.Value() < min {
+		return fmt.Errorf("%s option must be >= %s", string(o), min)
+	}
+	return nil
+}
+
 func (o runeSet) Value() RuneSet {
 	return flag.Lookup(string(o)).Value.(flag.Getter).Get().(RuneSet)
 }
@@ -99,13 +118,42 @@ const (
 	AccessToken       = stringOption("accessToken")
 	BaseUri           = stringOption("baseUri")
 	Branch            = stringOption("branch")
+	ConfigFile        = stringOption("configFile")
 	ContextLines      = intOption("contextLines")
 	Debug             = boolOption("debug")
+	LogFormat         = stringOption("logFormat")
+	LogLevel          = stringOption("logLevel")
 	DefaultBranch     = stringOption("defaultBranch")
+	Tag               = stringOption("tag")
 	Dir               = stringOption("dir")
+	DetectCI          = boolOption("detectCi")
 	DryRun            = boolOption("dryRun")
 	Exclude           = stringOption("exclude")
+	GitIgnore         = boolOption("gitIgnore")
+	GitAttributes     = boolOption("gitAttributes")
+	SkipBinary        = boolOption("skipBinary")
+	SkipMinified      = boolOption("skipMinified")
+	SkipGenerated     = boolOption("skipGenerated")
+	MaxFileSize       = int64Option("maxFileSize")
+	ManifestFile      = stringOption("manifest")
+	Workers           = intOption("workers")
+	BatchSummaryFile  = stringOption("batchSummaryFile")
+	Staged            = boolOption("staged")
+	FailOn            = stringOption("failOn")
+	FlagCacheFile     = stringOption("flagCacheFile")
+	FlagCacheTtl      = durationOption("flagCacheTtl")
+	SummaryFile       = stringOption("summaryFile")
+	MetricsFile       = stringOption("metricsFile")
+	BaseBranch        = stringOption("baseBranch")
+	PrSummaryFile     = stringOption("prSummaryFile")
+	PrCommentUrl      = stringOption("prCommentUrl")
+	PrCommentToken    = stringOption("prCommentToken")
+	Annotations       = boolOption("githubAnnotations")
+	StepSummaryFile   = stringOption("githubStepSummaryFile")
 	OutDir            = stringOption("outDir")
+	CsvSymbols        = boolOption("csvSymbols")
+	MinConfidence     = intOption("minConfidence")
+	RedactSecrets     = boolOption("redactSecrets")
 	ProjKey           = stringOption("projKey")
 	UpdateSequenceId  = int64Option("updateSequenceId")
 	RepoName          = stringOption("repoName")
@@ -113,6 +161,25 @@ const (
 	RepoUrl           = stringOption("repoUrl")
 	CommitUrlTemplate = stringOption("commitUrlTemplate")
 	HunkUrlTemplate   = stringOption("hunkUrlTemplate")
+	BranchSource      = stringOption("branchSource")
+	BranchFile        = stringOption("branchFile")
+	BranchApiUrl      = stringOption("branchApiUrl")
+	BranchApiToken    = stringOption("branchApiToken")
+	Prune             = boolOption("prune")
+	PruneDryRun       = boolOption("pruneDryRun")
+	PruneProtected    = stringOption("pruneProtectedBranches")
+	PruneMinAge       = durationOption("pruneMinAge")
+	PruneMaxBranches  = intOption("pruneMaxBranches")
+	PruneKeepTags     = intOption("pruneKeepTags")
+	Timeout           = durationOption("timeout")
+	SearchTimeout     = durationOption("searchTimeout")
+	GitTimeout        = durationOption("gitTimeout")
+	ApiTimeout        = durationOption("apiTimeout")
+	ProxyUrl          = stringOption("proxyUrl")
+	CACertFile        = stringOption("caCertFile")
+	ClientCertFile    = stringOption("clientCertFile")
+	ClientKeyFile     = stringOption("clientKeyFile")
+	TLSMinVersion     = stringOption("tlsMinVersion")
 	Version           = boolOption("version")
 	Delimiters        = runeSet("delimiters")
 	delimiterShort    = runeSet("D")
@@ -136,9 +203,27 @@ func (m optionMap) find(name string) *option {
 	return nil
 }
 
+// Sources of the branches which exist, see the branchSource option
+const (
+	BranchSourceRemote = "remote"
+	BranchSourceLocal  = "local"
+	BranchSourceFile   = "file"
+	BranchSourceApi    = "api"
+)
+
+// Problems reported by the check command, see the failOn option
+const (
+	ProblemUnknown  = "unknown"
+	ProblemArchived = "archived"
+	ProblemPolicy   = "policy"
+)
+
 const (
 	noUpdateSequenceID  = int64(-1)
 	defaultContextLines = 2
+	maxContextLines     = 5
+	defaultWorkers      = 4
+	defaultFlagCacheTtl = 24 * time.Hour
 )
 
 var (
@@ -149,20 +234,68 @@ var options = optionMap{
 	AccessToken:       option{"", "LaunchDarkly personal access token with write-level access.", true},
 	BaseUri:           option{"https://app.launchdarkly.com", "LaunchDarkly base URI.", false},
 	Branch:            option{"", "The currently checked out git branch. If not provided, branch name will be auto-detected. Please provide when using CI systems that leave the repository in a detached HEAD state.", false},
+	ConfigFile:        option{"", "Path to a JSON configuration file for settings that cannot be provided as command line options, such as per-project path scoping.", false},
 	ContextLines:      option{defaultContextLines, "The number of context lines to send to LaunchDarkly. If < 0, no source code will be sent to LaunchDarkly. If 0, only the lines containing flag references will be sent. If > 0, will send that number of context lines above and below the flag reference. A maximum of 5 context lines may be provided.", false},
+	Tag:               option{"", "If provided, code references are recorded for this release tag, e.g. `v2.3.0`, instead of a branch. The tag must be checked out. Tags are recorded as `refs/tags/<tag>`, so they don't collide with branch names.", false},
 	DefaultBranch:     option{"", "The git default branch. The LaunchDarkly UI will default to this branch. If not provided, will fallback to `master`.", false},
 	Dir:               option{"", "Path to existing checkout of the git repo.", true},
+	DetectCI:          option{true, "Whether the repository, checkout directory, branch or tag, default branch and update sequence id of the build are read from the environment of a supported CI provider when they are not set. Set to false to only use the options provided.", false},
 	Debug:             option{false, "Enables verbose debug logging", false},
+	LogFormat:         option{"text", "The format of log messages. Acceptable values: text|json. JSON messages include structured fields such as the current phase, repository, branch and number of flags.", false},
+	LogLevel:          option{"info", "The minimum level of log messages. Acceptable values: debug|info|warn|error. The debug option is equivalent to debug.", false},
 	DryRun:            option{false, "If enabled, the scanner will run without sending code references to LaunchDarkly. Combine with the `outDir` option to output code references to a CSV.", false},
 	Exclude:           option{"", `A regular expression (PCRE) defining the files and directories which the flag finder should exclude. Partial matches are allowed. Examples: "vendor/", "\.css"`, false},
+	GitIgnore:         option{true, "If enabled, files ignored by `.gitignore` files are excluded from the scan, in addition to those ignored by `.ldignore` files.", false},
+	GitAttributes:     option{false, "If enabled, files marked as `linguist-generated` or `linguist-vendored` in `.gitattributes` files are excluded from the scan.", false},
+	SkipBinary:        option{true, "If enabled, binary files are not scanned.", false},
+	SkipMinified:      option{true, "If enabled, minified JavaScript and CSS files are not scanned. Files are detected by name, e.g. `app.min.js`, or by their line lengths and whitespace.", false},
+	SkipGenerated:     option{false, "If enabled, generated files are not scanned. Files are detected by markers such as `Code generated ... DO NOT EDIT.` or `@generated` in their first lines.", false},
+	MaxFileSize:       option{int64(0), "Files larger than this size in bytes are not scanned. If 0, files of any size are scanned.", false},
+	ManifestFile:      option{"", "Batch command only. Path to a JSON manifest listing the checkouts to scan.", false},
+	Workers:           option{defaultWorkers, "Batch command only. The maximum number of checkouts scanned concurrently.", false},
+	BatchSummaryFile:  option{"", "Batch command only. If provided, a JSON summary of the result of scanning each checkout will be written to this path.", false},
+	Staged:            option{false, "Check command only. If enabled, only the changes staged for commit are checked, instead of all changes since the last commit.", false},
+	FailOn:            option{ProblemArchived, "Check command only. Comma separated problems which fail the check instead of being reported as warnings. Acceptable values: unknown|archived|policy. `unknown` is an evaluation of a flag missing from the projects, `archived` a reference to an archived flag, and `policy` a reference to a deprecated flag, or to a flag outside the paths of its project.", false},
+	FlagCacheFile:     option{"", "Check command only. Path to the cached flag list of the projects. Defaults to `ld-find-code-refs/flags.json` in the git directory of the checkout.", false},
+	FlagCacheTtl:      option{defaultFlagCacheTtl, "Check command only. The flag list is fetched from LaunchDarkly when the cached list is older than this, if accessToken is provided.", false},
+	SummaryFile:       option{"", "If provided, a JSON summary of the run will be written to this path, including the duration of each phase, the number of flags and search pages, references dropped due to limits, and responses from LaunchDarkly. The summary is written even if the run fails.", false},
+	MetricsFile:       option{"", "If provided, metrics of the run, such as the number of references to each flag in each repository, the scan duration and API errors, will be written to this path in the OpenMetrics text format, e.g. for the node exporter's textfile collector.", false},
+	BaseBranch:        option{"", "The branch a pull request will be merged into. If provided, changes in flag references compared with the references recorded for this branch are reported to `prSummaryFile` and `prCommentUrl`. Set by the CI wrappers in pull request builds.", false},
+	PrSummaryFile:     option{"", "If provided for a pull request build, a Markdown summary of changes in flag references compared with `baseBranch` will be written to this path, such as flags referenced for the first time, flags that are no longer referenced, and references to archived and temporary flags.", false},
+	PrCommentUrl:      option{"", "The API endpoint for comments on the pull request, e.g. `https://api.github.com/repos/owner/repo/issues/1/comments` or `https://gitlab.com/api/v4/projects/1/merge_requests/1/notes`. If provided with `prCommentToken`, the pull request summary is posted as a comment, replacing the comment posted for previous commits. Set by the GitHub action and GitLab CI wrapper.", false},
+	PrCommentToken:    option{"", "Token sent as a bearer token when posting the pull request summary to `prCommentUrl`.", false},
+	Annotations:       option{false, "If enabled, references to archived and deprecated flags are reported as GitHub Actions workflow annotations at the file and line of each reference.", false},
+	StepSummaryFile:   option{"", "If provided, a Markdown table of the number of references to each flag is appended to this path. Set to `$GITHUB_STEP_SUMMARY` in GitHub Actions workflows.", false},
 	OutDir:            option{"", "If provided, will output a csv file containing all code references for the project to this directory.", false},
-	ProjKey:           option{"", "LaunchDarkly project key.", true},
+	CsvSymbols:        option{false, "If enabled, the csv files written to `outDir` have a `symbol` column, after the other columns, with the function, method or type enclosing each reference.", false},
+	MinConfidence:     option{0, "References with a confidence score below this value, from 0 to 100, are excluded and listed for review. The score is based on the flag key's length and commonness, its delimiters, how it is used and the type of file. If 0, all references are included.", false},
+	RedactSecrets:     option{true, "If enabled, potential secrets such as API keys, private keys and passwords are replaced with a placeholder in the source code sent to LaunchDarkly. Additional patterns may be provided in `configFile`.", false},
+	ProjKey:           option{"", "LaunchDarkly project key. Multiple project keys may be separated by commas, in which case references to each project's flags are attributed to that project. Required unless projects are provided in `configFile`.", false},
 	UpdateSequenceId:  option{noUpdateSequenceID, `An integer representing the order number of code reference updates. Used to version updates across concurrent executions of the flag finder. If not provided, data will always be updated. If provided, data will only be updated if the existing "updateSequenceId" is less than the new "updateSequenceId". Examples: the time a "git push" was initiated, CI build number, the current unix timestamp.`, false},
-	RepoName:          option{"", `Git repo name. Will be displayed in LaunchDarkly. Case insensitive. Repo names must only contain letters, numbers, '.', '_' or '-'."`, true},
+	RepoName:          option{"", `Git repo name. Will be displayed in LaunchDarkly. Case insensitive. Repo names must only contain letters, numbers, '.', '_' or '-'." Required unless repositories are provided in ` + "`configFile`" + `, in which case references in files not claimed by a configured repository are reported to this repository.`, false},
 	RepoType:          option{"custom", "The repo service provider. Used to correctly categorize repositories in the LaunchDarkly UI. Aceptable values: github|bitbucket|custom.", false},
 	RepoUrl:           option{"", "The display url for the repository. If provided for a github or bitbucket repository, LaunchDarkly will attempt to automatically generate source code links.", false},
 	CommitUrlTemplate: option{"", "If provided, LaunchDarkly will attempt to generate links to your Git service provider per commit. Example: `https://github.com/launchdarkly/ld-find-code-refs/commit/${sha}`. Allowed template variables: `branchName`, `sha`. If `commitUrlTemplate` is not provided, but `repoUrl` is provided and `repoType` is not custom, LaunchDarkly will automatically generate links to the repository for each commit.", false},
 	HunkUrlTemplate:   option{"", "If provided, LaunchDarkly will attempt to generate links to your Git service provider per code reference. Example: `https://github.com/launchdarkly/ld-find-code-refs/blob/${sha}/${filePath}#L${lineNumber}`. Allowed template variables: `sha`, `filePath`, `lineNumber`. If `hunkUrlTemplate` is not provided, but repoUrl is provided and `repoType` is not custom, LaunchDarkly will automatically generate links to the repository for each code reference.", false},
+	BranchSource:      option{BranchSourceRemote, "The source of the branches which exist, to decide which branches are pruned. Acceptable values: remote|local|file|api. `remote` lists the branches of the git remote, `local` lists `refs/remotes` without network access, `file` reads the branchFile option, and `api` requests the branchApiUrl option.", false},
+	BranchFile:        option{"", "Path to a file listing the branches which exist, one per line, used when branchSource is `file`.", false},
+	BranchApiUrl:      option{"", "URL of a git host API endpoint listing the branches which exist, used when branchSource is `api`, e.g. `https://api.github.com/repos/owner/repo/branches`.", false},
+	BranchApiToken:    option{"", "Token sent as a bearer token to the branchApiUrl endpoint.", false},
+	Prune:             option{true, "If disabled, code references of stale branches are never pruned from LaunchDarkly.", false},
+	PruneDryRun:       option{false, "If enabled, the branches which would be pruned from LaunchDarkly are logged with the reason for each decision, but not pruned.", false},
+	PruneProtected:    option{"", "Comma separated glob patterns of branches which are never pruned, e.g. `release/*,main`. The repository's default branch is always protected.", false},
+	PruneMinAge:       option{time.Duration(0), "Branches whose code references were synced more recently than this, e.g. `168h`, are not pruned. If 0, branches of any age may be pruned.", false},
+	PruneMaxBranches:  option{0, "If more stale branches than this are found, no branches are pruned, since a remote with restricted access can make every branch appear stale. Stale tags are limited separately. If 0, any number of branches may be pruned.", false},
+	PruneKeepTags:     option{0, "The number of most recent release tags whose code references are kept. Older tags are pruned. Tags are ordered by version, e.g. `v2.10.0` is more recent than `v2.9.1`. If 0, no tags are pruned.", false},
+	Timeout:           option{time.Duration(0), "The maximum amount of time the scanner may run for, e.g. `10m`. If 0, no overall timeout is applied.", false},
+	SearchTimeout:     option{time.Duration(0), "The maximum amount of time the search phase may run for, e.g. `5m`. If 0, only the overall `timeout` applies.", false},
+	GitTimeout:        option{time.Duration(0), "The maximum amount of time each git phase (reading the current branch, listing remote branches) may run for, e.g. `30s`. If 0, only the overall `timeout` applies.", false},
+	ApiTimeout:        option{time.Duration(0), "The maximum amount of time each LaunchDarkly API phase (fetching flags, uploading references, pruning branches) may run for, e.g. `1m`. If 0, only the overall `timeout` applies.", false},
+	ProxyUrl:          option{"", "URL of an HTTP(S) proxy used for all requests to LaunchDarkly, e.g. `http://proxy.example.com:3128`. If not provided, the HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables are respected.", false},
+	CACertFile:        option{"", "Path to a PEM encoded file of additional CA certificates trusted when connecting to LaunchDarkly, e.g. for proxies performing TLS interception. Multiple files may be separated by commas.", false},
+	ClientCertFile:    option{"", "Path to a PEM encoded client certificate presented when connecting to LaunchDarkly. Must be provided with `clientKeyFile`.", false},
+	ClientKeyFile:     option{"", "Path to the PEM encoded private key for `clientCertFile`.", false},
+	TLSMinVersion:     option{"", "The minimum TLS version accepted when connecting to LaunchDarkly. Acceptable values: 1.0|1.1|1.2. If not provided, Go's default minimum version is used.", false},
 	Version:           option{false, "If provided, the scanner will print the version number and exit early", false},
 	Delimiters:        option{&delimiters, "Specifies additional delimiters used to match flag keys. Must be a non-control ASCII character. If more than one character is provided in `delimiters`, each character will be treated as a separate delimiter. Will only match flag keys with surrounded by any of the specified delimeters. This option may also be specified multiple times for multiple delimiters. By default, only flags delimited by single-quotes, double-quotes, and backticks will be matched.", false},
 	delimiterShort:    option{&delimiters, "Same as -delimiters", false},
@@ -171,15 +304,33 @@ var options = optionMap{
 // Init reads specified options and exits if options of invalid types or unspecified options were provided.
 // Returns an error if a required option has not been set, or if an option is invalid.
 func Init() (err error, errCb func()) {
+	return initOptions(os.Args[1:], false)
+}
+
+// InitBatch reads options for the batch command. Checkouts are read from the manifest option instead of the dir and repo options.
+func InitBatch(args []string) (err error, errCb func()) {
+	return initOptions(args, true)
+}
+
+func initOptions(args []string, batch bool) (err error, errCb func()) {
 	if !populated {
 		Populate()
 	}
 
-	flag.Parse()
+	err = flag.CommandLine.Parse(args)
+	if err != nil {
+		return err, flag.PrintDefaults
+	}
+	if !batch && DetectCI.Value() {
+		applyCI(os.Getenv)
+	}
 
 	opt := ""
 	flag.VisitAll(func(f *flag.Flag) {
 		o := options.find(f.Name)
+		if batch && f.Name == string(Dir) {
+			return
+		}
 		if o != nil && o.required {
 			val := f.Value.(flag.Getter).Get()
 			switch v := val.(type) {
@@ -203,13 +354,91 @@ func Init() (err error, errCb func()) {
 	if opt != "" {
 		return fmt.Errorf("required option %s not set", opt), flag.PrintDefaults
 	}
-	err = ContextLines.maximumError(5)
+	_, err = GetConfig()
+	if err != nil {
+		return fmt.Errorf("invalid configFile: %s", err), flag.PrintDefaults
+	}
+	projects, _ := Projects()
+	if len(projects) == 0 {
+		return fmt.Errorf("required option projKey not set"), flag.PrintDefaults
+	}
+	if batch {
+		if ManifestFile.Value() == "" {
+			return fmt.Errorf("required option manifest not set"), flag.PrintDefaults
+		}
+		_, err = ReadManifest(ManifestFile.Value())
+		if err != nil {
+			return fmt.Errorf("invalid manifest: %s", err), flag.PrintDefaults
+		}
+		if Workers.Value() < 1 {
+			return fmt.Errorf("workers option must be >= 1"), flag.PrintDefaults
+		}
+	} else {
+		repos, _ := Repositories()
+		if len(repos) == 0 {
+			return fmt.Errorf("required option repoName not set"), flag.PrintDefaults
+		}
+	}
+
+	err = ContextLines.maximumError(maxContextLines)
+	if err != nil {
+		return err, flag.PrintDefaults
+	}
+	err = MinConfidence.maximumError(100)
 	if err != nil {
 		return err, flag.PrintDefaults
 	}
-	repoType := strings.ToLower(RepoType.Value())
-	if repoType != "custom" && repoType != "github" && repoType != "bitbucket" {
-		return fmt.Errorf("repo type must be \"custom\", \"bitbucket\", or \"github\""), flag.PrintDefaults
+	switch BranchSource.Value() {
+	case BranchSourceRemote, BranchSourceLocal:
+	case BranchSourceFile:
+		if !validation.FileExists(BranchFile.Value()) {
+			return fmt.Errorf("branchFile must be an existing file when branchSource is %s", BranchSourceFile), flag.PrintDefaults
+		}
+	case BranchSourceApi:
+		branchApiUrl, err := url.Parse(BranchApiUrl.Value())
+		if err != nil || branchApiUrl.Scheme == "" || branchApiUrl.Host == "" {
+			return fmt.Errorf("branchApiUrl must be an absolute url when branchSource is %s", BranchSourceApi), flag.PrintDefaults
+		}
+	default:
+		return fmt.Errorf("branchSource must be one of remote, local, file or api"), flag.PrintDefaults
+	}
+	if PrCommentUrl.Value() != "" {
+		commentUrl, err := url.Parse(PrCommentUrl.Value())
+		if err != nil || commentUrl.Scheme == "" || commentUrl.Host == "" {
+			return fmt.Errorf("prCommentUrl must be an absolute url"), flag.PrintDefaults
+		}
+	}
+	if Branch.Value() != "" && Tag.Value() != "" {
+		return fmt.Errorf("branch and tag options must not be provided together"), flag.PrintDefaults
+	}
+	if PruneKeepTags.Value() < 0 {
+		return fmt.Errorf("pruneKeepTags option must be >= 0"), flag.PrintDefaults
+	}
+	if PruneMaxBranches.Value() < 0 {
+		return fmt.Errorf("pruneMaxBranches option must be >= 0"), flag.PrintDefaults
+	}
+	for _, pattern := range PruneProtectedBranches() {
+		if !glob.Valid(pattern) {
+			return fmt.Errorf("invalid pruneProtectedBranches pattern: %s", pattern), flag.PrintDefaults
+		}
+	}
+	if MaxFileSize.Value() < 0 {
+		return fmt.Errorf("maxFileSize option must be >= 0"), flag.PrintDefaults
+	}
+	for _, d := range []durationOption{Timeout, SearchTimeout, GitTimeout, ApiTimeout, PruneMinAge} {
+		err = d.minimumError(0)
+		if err != nil {
+			return err, flag.PrintDefaults
+		}
+	}
+	if !log.ValidFormat(LogFormat.Value()) {
+		return fmt.Errorf("logFormat must be one of text or json"), flag.PrintDefaults
+	}
+	if !log.ValidLevel(LogLevel.Value()) {
+		return fmt.Errorf("logLevel must be one of debug, info, warn or error"), flag.PrintDefaults
+	}
+	if !ValidRepoType(RepoType.Value()) {
+		return fmt.Errorf(repoTypeError), flag.PrintDefaults
 	}
 	_, err = regexp.Compile(Exclude.Value())
 	if err != nil {
@@ -220,6 +449,26 @@ func Init() (err error, errCb func()) {
 		return fmt.Errorf("error parsing repo url: %+v", err), flag.PrintDefaults
 	}
 
+	if ProxyUrl.Value() != "" {
+		proxyUrl, err := url.Parse(ProxyUrl.Value())
+		if err != nil || proxyUrl.Scheme == "" || proxyUrl.Host == "" {
+			return fmt.Errorf("proxyUrl must be an absolute url, e.g. http://proxy.example.com:3128"), flag.PrintDefaults
+		}
+	}
+	for _, path := range CACertFiles() {
+		if !validation.FileExists(path) {
+			return fmt.Errorf("invalid caCertFile: file does not exist: %s", path), flag.PrintDefaults
+		}
+	}
+	if (ClientCertFile.Value() == "") != (ClientKeyFile.Value() == "") {
+		return fmt.Errorf("clientCertFile and clientKeyFile must be provided together"), flag.PrintDefaults
+	}
+	if TLSMinVersion.Value() != "" {
+		if _, err := ld.ParseTLSVersion(TLSMinVersion.Value()); err != nil {
+			return fmt.Errorf("invalid tlsMinVersion: %s", err), flag.PrintDefaults
+		}
+	}
+
 	// match all non-control ASCII characters
 	validDelims := regexp.MustCompile("[\x20-\x7E]")
 	for _, d := range delimiters {
@@ -228,9 +477,11 @@ func Init() (err error, errCb func()) {
 		}
 	}
 
-	_, err = validation.NormalizeAndValidatePath(Dir.Value())
-	if err != nil {
-		return fmt.Errorf("invalid dir: %s", err), flag.PrintDefaults
+	if !batch {
+		_, err = validation.NormalizeAndValidatePath(Dir.Value())
+		if err != nil {
+			return fmt.Errorf("invalid dir: %s", err), flag.PrintDefaults
+		}
 	}
 
 	if OutDir.Value() != "" {
@@ -243,6 +494,84 @@ func Init() (err error, errCb func()) {
 	return nil, flag.PrintDefaults
 }
 
+// InitExplainIgnore reads options for the explain-ignore command, which only requires the dir option. The paths to
+// explain are the remaining command line arguments.
+func InitExplainIgnore(args []string) (err error, errCb func()) {
+	if !populated {
+		Populate()
+	}
+
+	err = flag.CommandLine.Parse(args)
+	if err != nil {
+		return err, flag.PrintDefaults
+	}
+	if Dir.Value() == "" {
+		return fmt.Errorf("required option dir not set"), flag.PrintDefaults
+	}
+	_, err = validation.NormalizeAndValidatePath(Dir.Value())
+	if err != nil {
+		return fmt.Errorf("invalid dir: %s", err), flag.PrintDefaults
+	}
+	_, err = regexp.Compile(Exclude.Value())
+	if err != nil {
+		return fmt.Errorf("exclude must be a valid regular expression: %+v", err), flag.PrintDefaults
+	}
+	if flag.NArg() == 0 {
+		return fmt.Errorf("at least one path to explain must be provided"), flag.PrintDefaults
+	}
+	return nil, flag.PrintDefaults
+}
+
+// InitCheck reads options for the check command, which checks the flag references added by uncommitted changes to the
+// checkout provided by the dir option, or the current directory. The accessToken option is only required to refresh the
+// cached flag list.
+func InitCheck(args []string) (err error, errCb func()) {
+	if !populated {
+		Populate()
+	}
+
+	err = flag.CommandLine.Parse(args)
+	if err != nil {
+		return err, flag.PrintDefaults
+	}
+	if Dir.Value() != "" {
+		_, err = validation.NormalizeAndValidatePath(Dir.Value())
+		if err != nil {
+			return fmt.Errorf("invalid dir: %s", err), flag.PrintDefaults
+		}
+	}
+	_, err = GetConfig()
+	if err != nil {
+		return fmt.Errorf("invalid configFile: %s", err), flag.PrintDefaults
+	}
+	projects, _ := Projects()
+	if len(projects) == 0 {
+		return fmt.Errorf("required option projKey not set"), flag.PrintDefaults
+	}
+	for _, problem := range FailOnProblems() {
+		switch problem {
+		case ProblemUnknown, ProblemArchived, ProblemPolicy:
+		default:
+			return fmt.Errorf("failOn must only contain unknown, archived or policy"), flag.PrintDefaults
+		}
+	}
+	err = FlagCacheTtl.minimumError(0)
+	if err != nil {
+		return err, flag.PrintDefaults
+	}
+	_, err = regexp.Compile(Exclude.Value())
+	if err != nil {
+		return fmt.Errorf("exclude must be a valid regular expression: %+v", err), flag.PrintDefaults
+	}
+	if !log.ValidFormat(LogFormat.Value()) {
+		return fmt.Errorf("logFormat must be one of text or json"), flag.PrintDefaults
+	}
+	if !log.ValidLevel(LogLevel.Value()) {
+		return fmt.Errorf("logLevel must be one of debug, info, warn or error"), flag.PrintDefaults
+	}
+	return nil, flag.PrintDefaults
+}
+
 var populated = false
 
 func Populate() {
@@ -258,29 +587,117 @@ func Populate() {
 			flag.String(name, v, o.usage)
 		case bool:
 			flag.Bool(name, v, o.usage)
+		case time.Duration:
+			flag.Duration(name, v, o.usage)
 		case *RuneSet:
 			flag.Var(v, name, o.usage)
 		}
 	}
 }
 
+const repoTypeError = `repo type must be "custom", "bitbucket", "github", or "gitlab"`
+
+func ValidRepoType(repoType string) bool {
+	switch strings.ToLower(repoType) {
+	case "custom", "github", "bitbucket", "gitlab":
+		return true
+	}
+	return false
+}
+
+// LogLevelValue returns the minimum level of log messages, taking the debug option into account
+func LogLevelValue() string {
+	if Debug.Value() {
+		return log.LevelDebug
+	}
+	return LogLevel.Value()
+}
+
+// CACertFiles splits the caCertFile option into individual paths
+func CACertFiles() []string {
+	paths := []string{}
+	for _, path := range strings.Split(CACertFile.Value(), ",") {
+		if strings.TrimSpace(path) != "" {
+			paths = append(paths, strings.TrimSpace(path))
+		}
+	}
+	return paths
+}
+
+// PruneProtectedBranches splits the pruneProtectedBranches option into individual patterns
+func PruneProtectedBranches() []string {
+	patterns := []string{}
+	for _, pattern := range strings.Split(PruneProtected.Value(), ",") {
+		if strings.TrimSpace(pattern) != "" {
+			patterns = append(patterns, strings.TrimSpace(pattern))
+		}
+	}
+	return patterns
+}
+
+// FailOnProblems splits the failOn option into individual problems
+func FailOnProblems() []string {
+	problems := []string{}
+	for _, problem := range strings.Split(FailOn.Value(), ",") {
+		if strings.TrimSpace(problem) != "" {
+			problems = append(problems, strings.TrimSpace(problem))
+		}
+	}
+	return problems
+}
+
 // GetLDOptionsFromEnv returns a map of all expected environment variables for ld-find-code-refs wrappers
 func GetLDOptionsFromEnv() (map[string]string, error) {
 	ldOptions := map[string]string{
-		"accessToken":  os.Getenv("LD_ACCESS_TOKEN"),
-		"projKey":      os.Getenv("LD_PROJ_KEY"),
-		"exclude":      os.Getenv("LD_EXCLUDE"),
-		"contextLines": os.Getenv("LD_CONTEXT_LINES"),
-		"baseUri":      os.Getenv("LD_BASE_URI"),
-		"debug":        os.Getenv("LD_DEBUG"),
-		"delimiters":   os.Getenv("LD_DELIMITERS"),
+		"accessToken":   os.Getenv("LD_ACCESS_TOKEN"),
+		"projKey":       os.Getenv("LD_PROJ_KEY"),
+		"exclude":       os.Getenv("LD_EXCLUDE"),
+		"contextLines":  os.Getenv("LD_CONTEXT_LINES"),
+		"baseUri":       os.Getenv("LD_BASE_URI"),
+		"debug":         os.Getenv("LD_DEBUG"),
+		"delimiters":    os.Getenv("LD_DELIMITERS"),
+		"timeout":       os.Getenv("LD_TIMEOUT"),
+		"redactSecrets": os.Getenv("LD_REDACT_SECRETS"),
+	}
+
+	// transport and reporting options are only set when provided, so that their defaults apply otherwise
+	optionalOptions := map[string]string{
+		"proxyUrl":          os.Getenv("LD_PROXY_URL"),
+		"caCertFile":        os.Getenv("LD_CA_CERT_FILE"),
+		"clientCertFile":    os.Getenv("LD_CLIENT_CERT_FILE"),
+		"clientKeyFile":     os.Getenv("LD_CLIENT_KEY_FILE"),
+		"tlsMinVersion":     os.Getenv("LD_TLS_MIN_VERSION"),
+		"prSummaryFile":     os.Getenv("LD_PR_SUMMARY_FILE"),
+		"prCommentToken":    os.Getenv("LD_PR_COMMENT_TOKEN"),
+		"githubAnnotations": os.Getenv("LD_GITHUB_ANNOTATIONS"),
+	}
+	for k, v := range optionalOptions {
+		if v != "" {
+			ldOptions[k] = v
+		}
+	}
+
+	if ldOptions["timeout"] == "" {
+		ldOptions["timeout"] = "0"
+	}
+	_, err := time.ParseDuration(ldOptions["timeout"])
+	if err != nil {
+		return ldOptions, fmt.Errorf("couldn't parse LD_TIMEOUT as a duration: %+v", err)
 	}
 
 	if ldOptions["debug"] == "" {
 		ldOptions["debug"] = "false"
 	}
 
-	_, err := regexp.Compile(ldOptions["exclude"])
+	if ldOptions["redactSecrets"] == "" {
+		ldOptions["redactSecrets"] = "true"
+	}
+	_, err = strconv.ParseBool(ldOptions["redactSecrets"])
+	if err != nil {
+		return ldOptions, fmt.Errorf("couldn't parse LD_REDACT_SECRETS as a boolean: %+v", err)
+	}
+
+	_, err = regexp.Compile(ldOptions["exclude"])
 	if err != nil {
 		return ldOptions, fmt.Errorf("couldn't parse LD_EXCLUDE as regex: %+v", err)
 	}
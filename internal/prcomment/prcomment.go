@@ -0,0 +1,152 @@
+package prcomment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+)
+
+// Marker identifies comments posted by the scanner, so that the comment posted for a previous commit is replaced
+// instead of adding another comment for each commit
+const Marker = "<!-- ld-find-code-refs -->"
+
+// pageSize is the number of comments requested when looking for a previous comment, the maximum allowed by GitHub
+// and GitLab
+const pageSize = 100
+
+// Client posts comments to a git host API endpoint accepting a JSON object with a `body` field, such as GitHub's
+// `/repos/{owner}/{repo}/issues/{number}/comments` or GitLab's `/projects/{id}/merge_requests/{iid}/notes`.
+type Client struct {
+	url        string
+	token      string
+	httpClient *http.Client
+}
+
+func NewClient(endpoint, token string, httpClient *http.Client) (*Client, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("comment url must be an absolute url, e.g. https://api.github.com/repos/owner/repo/issues/1/comments")
+	}
+	return &Client{url: endpoint, token: token, httpClient: httpClient}, nil
+}
+
+type comment struct {
+	Id   int64  `json:"id"`
+	Body string `json:"body"`
+	// Url is the API url of a GitHub comment. GitLab notes are updated at the comments endpoint, followed by the id.
+	Url string `json:"url"`
+}
+
+// Post adds a comment, or replaces the previous comment containing Marker. The Marker is added to body if it doesn't
+// already contain it.
+func (c *Client) Post(ctx context.Context, body string) error {
+	if !strings.Contains(body, Marker) {
+		body = Marker + "\n" + body
+	}
+	previous, err := c.previous(ctx)
+	if err != nil {
+		return err
+	}
+	if previous == nil {
+		log.Debug.Printf("adding pull request comment")
+		return c.send(ctx, "POST", c.url, body)
+	}
+	log.Debug.Printf("replacing pull request comment %d", previous.Id)
+	if previous.Url != "" {
+		return c.send(ctx, "PATCH", previous.Url, body)
+	}
+	return c.send(ctx, "PUT", strings.TrimSuffix(c.url, "/")+"/"+strconv.FormatInt(previous.Id, 10), body)
+}
+
+// previous returns the most recent comment containing Marker, or nil. Pages of comments are requested by following
+// the `next` link of each response, as returned by GitHub and GitLab, until a page contains Marker.
+func (c *Client) previous(ctx context.Context) (*comment, error) {
+	u, err := url.Parse(c.url)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("per_page", strconv.Itoa(pageSize))
+	u.RawQuery = q.Encode()
+
+	for endpoint := u.String(); endpoint != ""; {
+		res, header, err := c.do(ctx, "GET", endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+		var comments []comment
+		err = json.Unmarshal(res, &comments)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse comments: %s", err)
+		}
+		var ret *comment
+		for i, cm := range comments {
+			if strings.Contains(cm.Body, Marker) {
+				ret = &comments[i]
+			}
+		}
+		if ret != nil {
+			return ret, nil
+		}
+		endpoint = nextLink(header)
+	}
+	return nil, nil
+}
+
+var nextLinkRegex = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// nextLink returns the url of the next page from a `Link` header, e.g. `<https://host/comments?page=2>; rel="next"`,
+// or an empty string on the last page
+func nextLink(header http.Header) string {
+	for _, link := range header["Link"] {
+		if m := nextLinkRegex.FindStringSubmatch(link); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+func (c *Client) send(ctx context.Context, method, endpoint, body string) error {
+	data, err := json.Marshal(map[string]string{"body": body})
+	if err != nil {
+		return err
+	}
+	_, _, err = c.do(ctx, method, endpoint, data)
+	return err
+}
+
+func (c *Client) do(ctx context.Context, method, endpoint string, data []byte) ([]byte, http.Header, error) {
+	req, err := http.NewRequest(method, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	res, err := c.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, nil, fmt.Errorf("comment API responded to %s with status %d", method, res.StatusCode)
+	}
+	return body, res.Header, nil
+}
@@ -0,0 +1,131 @@
+package prcomment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+)
+
+func TestMain(m *testing.M) {
+	log.Init(true)
+	os.Exit(m.Run())
+}
+
+// commentServer is a stand-in for a git host API serving the comments of a single pull request at /comments, in pages
+// linked by a `Link` header. Comments include their API url if withUrls is set, like GitHub, and are otherwise updated
+// at /comments/{id}, like GitLab.
+type commentServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	token    string
+	withUrls bool
+	comments []comment
+}
+
+func newCommentServer(t *testing.T, token string, withUrls bool) *commentServer {
+	s := &commentServer{token: token, withUrls: withUrls}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if req.Header.Get("Authorization") != "Bearer "+s.token {
+			res.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if req.Method == "GET" && req.URL.Path == "/comments" {
+			require.Equal(t, "100", req.URL.Query().Get("per_page"))
+			page, err := strconv.Atoi(req.URL.Query().Get("page"))
+			if err != nil {
+				page = 1
+			}
+			start, end := (page-1)*100, page*100
+			if end < len(s.comments) {
+				res.Header().Set("Link", fmt.Sprintf(`<%s/comments?page=%d&per_page=100>; rel="next", <%s/comments?page=1&per_page=100>; rel="first"`, s.URL, page+1, s.URL))
+			} else {
+				end = len(s.comments)
+			}
+			require.NoError(t, json.NewEncoder(res).Encode(s.comments[start:end]))
+			return
+		}
+
+		var body struct {
+			Body string `json:"body"`
+		}
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&body))
+		switch {
+		case req.Method == "POST" && req.URL.Path == "/comments":
+			c := comment{Id: int64(len(s.comments) + 1), Body: body.Body}
+			if s.withUrls {
+				c.Url = fmt.Sprintf("%s/issues/comments/%d", s.URL, c.Id)
+			}
+			s.comments = append(s.comments, c)
+			res.WriteHeader(http.StatusCreated)
+		case (req.Method == "PATCH" && s.withUrls && strings.HasPrefix(req.URL.Path, "/issues/comments/")) ||
+			(req.Method == "PUT" && !s.withUrls && strings.HasPrefix(req.URL.Path, "/comments/")):
+			id, err := strconv.ParseInt(req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:], 10, 64)
+			require.NoError(t, err)
+			s.comments[id-1].Body = body.Body
+		default:
+			res.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return s
+}
+
+func TestPost(t *testing.T) {
+	for _, withUrls := range []bool{true, false} {
+		t.Run(fmt.Sprintf("with comment urls: %t", withUrls), func(t *testing.T) {
+			server := newCommentServer(t, "secret", withUrls)
+			defer server.Close()
+			server.comments = []comment{{Id: 1, Body: "LGTM"}}
+
+			client, err := NewClient(server.URL+"/comments", "secret", server.Client())
+			require.NoError(t, err)
+			require.NoError(t, client.Post(context.Background(), "first summary"))
+			require.NoError(t, client.Post(context.Background(), "second summary"))
+
+			require.Len(t, server.comments, 2)
+			require.Equal(t, "LGTM", server.comments[0].Body)
+			require.Equal(t, Marker+"\nsecond summary", server.comments[1].Body)
+		})
+	}
+}
+
+func TestPostPaginated(t *testing.T) {
+	server := newCommentServer(t, "secret", true)
+	defer server.Close()
+	for i := 1; i <= 150; i++ {
+		server.comments = append(server.comments, comment{Id: int64(i), Body: "LGTM"})
+	}
+	server.comments[120].Body = Marker + "\nfirst summary"
+	server.comments[120].Url = fmt.Sprintf("%s/issues/comments/%d", server.URL, 121)
+
+	client, err := NewClient(server.URL+"/comments", "secret", server.Client())
+	require.NoError(t, err)
+	require.NoError(t, client.Post(context.Background(), "second summary"))
+
+	require.Len(t, server.comments, 150)
+	require.Equal(t, Marker+"\nsecond summary", server.comments[120].Body)
+}
+
+func TestPostFailures(t *testing.T) {
+	server := newCommentServer(t, "secret", true)
+	defer server.Close()
+
+	client, err := NewClient(server.URL+"/comments", "wrong", server.Client())
+	require.NoError(t, err)
+	require.EqualError(t, client.Post(context.Background(), "summary"), "comment API responded to GET with status 401")
+
+	_, err = NewClient("comments", "secret", http.DefaultClient)
+	require.Error(t, err)
+}
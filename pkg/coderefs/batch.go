@@ -0,0 +1,171 @@
+package coderefs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	o "github.com/launchdarkly/ld-find-code-refs/internal/options"
+)
+
+// batchResult records the outcome of scanning a single checkout listed in a batch manifest
+type batchResult struct {
+	Name     string `json:"name"`
+	Dir      string `json:"dir"`
+	Success  bool   `json:"success"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+	checkoutStats
+}
+
+type batchSummary struct {
+	Succeeded    int           `json:"succeeded"`
+	Failed       int           `json:"failed"`
+	Duration     string        `json:"duration"`
+	Repositories []batchResult `json:"repositories"`
+}
+
+// Batch scans every checkout listed in the manifest option. The flag list is fetched once, and checkouts are
+// scanned concurrently by a bounded pool of workers. A failure to scan one checkout does not stop the others;
+// the process exits with a non-zero status after all checkouts have been scanned if any failed.
+func Batch() {
+	ctx, cancel := scanContext(o.Timeout.Value())
+	defer cancel()
+
+	startRunSummary()
+	summary, err := batch(ctx)
+	runErr := err
+	if err == nil && summary.Failed > 0 {
+		runErr = fmt.Errorf("failed to scan %d of %d repositories", summary.Failed, len(summary.Repositories))
+	}
+	if summaryErr := writeRunReports(runErr); summaryErr != nil {
+		if runErr == nil {
+			cancel()
+			log.Error.Fatalf("%s", summaryErr)
+		}
+		log.Error.Printf("%s", summaryErr)
+	}
+	if err != nil {
+		cancel()
+		log.With(log.Fields{"errorCode": errorCode(err)}).Fatalf("%s", err)
+	}
+
+	if o.BatchSummaryFile.Value() != "" {
+		err = summary.write(o.BatchSummaryFile.Value())
+		if err != nil {
+			cancel()
+			log.Error.Fatalf("could not write batch summary: %s", err)
+		}
+		log.Info.Printf("wrote batch summary to %s", o.BatchSummaryFile.Value())
+	}
+
+	if runErr != nil {
+		cancel()
+		log.Error.Fatalf("%s", runErr)
+	}
+}
+
+func batch(ctx context.Context) (batchSummary, error) {
+	start := time.Now()
+	manifest, err := o.ReadManifest(o.ManifestFile.Value())
+	if err != nil {
+		return batchSummary{}, fmt.Errorf("could not read manifest: %s", err)
+	}
+
+	s, err := newScanner(ctx)
+	if err != nil {
+		return batchSummary{}, err
+	}
+
+	results := make([]batchResult, len(manifest.Repositories))
+	if len(s.flags) > 0 {
+		results = s.scanManifest(ctx, manifest, o.Workers.Value())
+	} else {
+		for i, entry := range manifest.Repositories {
+			results[i] = batchResult{Name: entry.Name, Dir: entry.Dir, Success: true, Duration: time.Duration(0).String()}
+		}
+	}
+
+	summary := batchSummary{Repositories: results, Duration: time.Since(start).String()}
+	for _, r := range results {
+		if r.Success {
+			summary.Succeeded++
+		} else {
+			summary.Failed++
+		}
+	}
+	log.Info.Printf("batch scan completed in %s: %d repositories succeeded, %d failed", summary.Duration, summary.Succeeded, summary.Failed)
+	return summary, nil
+}
+
+// scanManifest scans each checkout in the manifest with at most workers concurrent scans. Results are returned in manifest order.
+func (s *scanner) scanManifest(ctx context.Context, manifest o.Manifest, workers int) []batchResult {
+	results := make([]batchResult, len(manifest.Repositories))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = s.scanManifestEntry(ctx, manifest.Repositories[i])
+			}
+		}()
+	}
+
+	for i := range manifest.Repositories {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+func (s *scanner) scanManifestEntry(ctx context.Context, entry o.ManifestEntry) batchResult {
+	start := time.Now()
+	result := batchResult{Name: entry.Name, Dir: entry.Dir}
+
+	opts := checkoutOptions{
+		dir:              entry.Dir,
+		branch:           entry.Branch,
+		tag:              entry.Tag,
+		exclude:          entry.Exclude,
+		updateSequenceId: entry.UpdateSequenceId,
+		repos:            []o.RepositoryConfig{entry.RepositoryConfig()},
+	}
+	if opts.exclude == "" {
+		opts.exclude = o.Exclude.Value()
+	}
+	if opts.updateSequenceId == nil && o.UpdateSequenceId.Value() >= 0 {
+		updateId := o.UpdateSequenceId.Value()
+		opts.updateSequenceId = &updateId
+	}
+
+	log.With(log.Fields{"repo": entry.Name}).Infof("scanning repository %s at %s", entry.Name, entry.Dir)
+	stats, err := s.scanCheckout(ctx, opts)
+	duration := time.Since(start)
+	result.Duration = duration.String()
+	result.checkoutStats = stats
+	currentRun.setRepositoryResult(entry.Name, err == nil, duration)
+	if err != nil {
+		log.With(log.Fields{"repo": entry.Name, "errorCode": errorCode(err)}).Errorf("failed to scan repository %s: %s", entry.Name, err)
+		result.Error = err.Error()
+		return result
+	}
+	result.Success = true
+	return result
+}
+
+func (b batchSummary) write(path string) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
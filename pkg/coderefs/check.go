@@ -0,0 +1,240 @@
+package coderefs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/command"
+	"github.com/launchdarkly/ld-find-code-refs/internal/ignore"
+	"github.com/launchdarkly/ld-find-code-refs/internal/lang"
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	o "github.com/launchdarkly/ld-find-code-refs/internal/options"
+	"github.com/launchdarkly/ld-find-code-refs/internal/validation"
+	"github.com/launchdarkly/ld-find-code-refs/internal/version"
+)
+
+// checkProblem is a flag reference added by uncommitted changes which is reported by the check command
+type checkProblem struct {
+	kind    string
+	path    string
+	lineNum int
+	message string
+}
+
+// checker finds problems with the flag references in lines added to a checkout
+type checker struct {
+	projs   projects
+	flags   []string
+	delims  string
+	usages  *lang.UsageClassifier
+	ignores *ignore.Matcher
+	exclude *regexp.Regexp
+}
+
+// Check reports problems with the flag references added by uncommitted changes to the checkout provided by the dir
+// option, or the current directory, e.g. in a git pre-commit hook. The process exits with an error if any problem
+// listed by the failOn option is found.
+func Check() {
+	ctx, cancel := scanContext(o.Timeout.Value())
+	defer cancel()
+
+	problems, err := check(ctx)
+	if err != nil {
+		cancel()
+		log.Error.Fatalf("%s", err)
+	}
+	failOn := map[string]bool{}
+	for _, problem := range o.FailOnProblems() {
+		failOn[problem] = true
+	}
+	if writeCheckProblems(os.Stdout, problems, failOn) {
+		cancel()
+		os.Exit(1)
+	}
+}
+
+func check(ctx context.Context) ([]checkProblem, error) {
+	dir := o.Dir.Value()
+	if dir == "" {
+		dir = "."
+	}
+	absPath, err := validation.NormalizeAndValidatePath(dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not validate directory option: %s", err)
+	}
+	gitClient, err := command.NewGitWorkspaceClient(absPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []command.FileChanges
+	err = gitPhase("git diff").run(ctx, func(ctx context.Context) (err error) {
+		changes, err = gitClient.Changes(ctx, o.Staged.Value())
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not read changes: %s", err)
+	}
+	if len(changes) == 0 {
+		log.Debug.Printf("no changes to check")
+		return nil, nil
+	}
+
+	cachePath := o.FlagCacheFile.Value()
+	if cachePath == "" {
+		gitDir, err := gitClient.GitDir(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("could not find git directory: %s", err)
+		}
+		cachePath = filepath.Join(gitDir, "ld-find-code-refs", "flags.json")
+	}
+	projectConfigs, err := o.Projects()
+	if err != nil {
+		return nil, err
+	}
+	var fetch flagSource
+	if o.AccessToken.Value() != "" {
+		apiOptions := transportOptions()
+		apiOptions.ApiKey = o.AccessToken.Value()
+		apiOptions.BaseUri = o.BaseUri.Value()
+		apiOptions.UserAgent = "LDFindCodeRefs/" + version.Version
+		ldApi, err := ld.InitApiClient(apiOptions)
+		if err != nil {
+			return nil, fmt.Errorf("could not configure LaunchDarkly API client: %s", err)
+		}
+		fetch = func(ctx context.Context, projKey string) (flags []ld.Flag, err error) {
+			err = apiPhase("flag fetch").run(ctx, func(ctx context.Context) (err error) {
+				flags, err = ldApi.GetFlags(ctx, projKey)
+				return err
+			})
+			return flags, err
+		}
+	}
+	projs, err := cachedProjects(ctx, cachePath, projectConfigs, o.BaseUri.Value(), o.FlagCacheTtl.Value(), fetch, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := o.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	usageRules := make([]lang.UsageRule, 0, len(c.UsageRules))
+	for _, r := range c.UsageRules {
+		usageRules = append(usageRules, lang.UsageRule{Usage: lang.Usage(r.Usage), Pattern: r.Pattern, Languages: r.Languages, Paths: r.Paths})
+	}
+	usages, err := lang.NewUsageClassifier(usageRules)
+	if err != nil {
+		return nil, err
+	}
+	flags, _ := filterShortFlagKeys(projs.flagKeys())
+	chk := checker{
+		projs:   projs,
+		flags:   flags,
+		delims:  string(o.Delimiters.Value()),
+		usages:  usages,
+		ignores: ignore.NewMatcher(absPath, ignoreOptions()),
+		exclude: regexp.MustCompile(o.Exclude.Value()),
+	}
+	return chk.check(changes), nil
+}
+
+// check returns the problems with the flag references in the added lines of each file, in order
+func (c checker) check(changes []command.FileChanges) []checkProblem {
+	problems := []checkProblem{}
+	for _, file := range changes {
+		if c.ignores != nil && c.ignores.Match(file.Path, false).Ignored {
+			continue
+		}
+		if c.exclude != nil && c.exclude.String() != "" && c.exclude.MatchString(file.Path) {
+			continue
+		}
+		language := lang.Detect(file.Path)
+		for _, line := range file.Lines {
+			problems = append(problems, c.checkLine(language, file.Path, line)...)
+		}
+	}
+	return problems
+}
+
+func (c checker) checkLine(language *lang.Language, path string, line command.AddedLine) []checkProblem {
+	problems := []checkProblem{}
+	add := func(kind, format string, args ...interface{}) {
+		problems = append(problems, checkProblem{kind: kind, path: path, lineNum: line.LineNum, message: fmt.Sprintf(format, args...)})
+	}
+
+	// only flags appearing in the line are matched, since matching every flag would be slow for large projects
+	candidates := []string{}
+	for _, flag := range c.flags {
+		if strings.Contains(line.Text, flag) {
+			candidates = append(candidates, flag)
+		}
+	}
+	for _, flagKey := range findReferencedFlags(line.Text, candidates, c.delims) {
+		attributed := c.projs.keysFor(path, flagKey)
+		if len(attributed) == 0 {
+			add(o.ProblemPolicy, "flag %s is referenced outside the paths of project %s", flagKey, strings.Join(c.projectsWith(flagKey), ", "))
+			continue
+		}
+		for _, projKey := range attributed {
+			flag := c.projs.flag(projKey, flagKey)
+			switch {
+			case flag.Archived:
+				add(o.ProblemArchived, "flag %s in project %s is archived", flagKey, projKey)
+			case flag.Deprecated:
+				add(o.ProblemPolicy, "flag %s in project %s is deprecated", flagKey, projKey)
+			}
+		}
+	}
+
+	if c.usages != nil {
+		for _, flagKey := range c.usages.EvaluatedKeys(language, path, line.Text) {
+			if len(c.projectsWith(flagKey)) == 0 {
+				add(o.ProblemUnknown, "flag %s does not exist in project %s", flagKey, c.projs)
+			}
+		}
+	}
+	return problems
+}
+
+// projectsWith returns the keys of the projects containing a flag
+func (c checker) projectsWith(flagKey string) []string {
+	keys := []string{}
+	for _, p := range c.projs {
+		if p.flags[flagKey] {
+			keys = append(keys, p.key)
+		}
+	}
+	return keys
+}
+
+// writeCheckProblems lists the problems as errors if they are listed in failOn, and otherwise as warnings. It reports
+// whether any errors were found.
+func writeCheckProblems(w io.Writer, problems []checkProblem, failOn map[string]bool) (failed bool) {
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].path != problems[j].path {
+			return problems[i].path < problems[j].path
+		}
+		return problems[i].lineNum < problems[j].lineNum
+	})
+	for _, p := range problems {
+		severity := "warning"
+		if failOn[p.kind] {
+			severity = "error"
+			failed = true
+		}
+		fmt.Fprintf(w, "%s:%d: %s: %s (%s)\n", p.path, p.lineNum, severity, p.message, p.kind)
+	}
+	if failed {
+		fmt.Fprintf(w, "flag reference check failed, see the failOn option\n")
+	}
+	return failed
+}
@@ -0,0 +1,79 @@
+package coderefs
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/command"
+	"github.com/launchdarkly/ld-find-code-refs/internal/lang"
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	o "github.com/launchdarkly/ld-find-code-refs/internal/options"
+)
+
+func Test_checkerCheck(t *testing.T) {
+	projs := projects{
+		newProjectWithDetails("web", nil, []ld.Flag{
+			{Key: "active-flag"},
+			{Key: "old-flag", Archived: true},
+			{Key: "legacy-flag", Deprecated: true},
+		}),
+		newProjectWithDetails("payments", []string{"services/payments/**"}, []ld.Flag{{Key: "payments-flag"}}),
+	}
+	usages, err := lang.NewUsageClassifier(nil)
+	require.NoError(t, err)
+	c := checker{
+		projs:   projs,
+		flags:   projs.flagKeys(),
+		delims:  `"'` + "`",
+		usages:  usages,
+		exclude: regexp.MustCompile(`^vendor/`),
+	}
+
+	changes := []command.FileChanges{
+		{Path: "app.js", Lines: []command.AddedLine{
+			{LineNum: 1, Text: `if (ld.variation('active-flag', false)) {`},
+			{LineNum: 2, Text: `if (ld.variation('old-flag', false) || ld.variation('new-flag', false)) {`},
+			{LineNum: 3, Text: `const LEGACY = 'legacy-flag'`},
+			{LineNum: 4, Text: `// old-flag without delimiters is not a reference`},
+			{LineNum: 5, Text: `if (ld.variation('payments-flag', false)) {`},
+		}},
+		{Path: "services/payments/main.go", Lines: []command.AddedLine{
+			{LineNum: 7, Text: `if client.BoolVariation("payments-flag", user, false) {`},
+		}},
+		{Path: "app.test.js", Lines: []command.AddedLine{
+			{LineNum: 1, Text: `ld.variation('test-only-flag', false)`},
+		}},
+		{Path: "vendor/lib.js", Lines: []command.AddedLine{
+			{LineNum: 1, Text: `ld.variation('old-flag', false)`},
+		}},
+	}
+	require.Equal(t, []checkProblem{
+		{kind: o.ProblemArchived, path: "app.js", lineNum: 2, message: "flag old-flag in project web is archived"},
+		{kind: o.ProblemUnknown, path: "app.js", lineNum: 2, message: "flag new-flag does not exist in project web, payments"},
+		{kind: o.ProblemPolicy, path: "app.js", lineNum: 3, message: "flag legacy-flag in project web is deprecated"},
+		{kind: o.ProblemPolicy, path: "app.js", lineNum: 5, message: "flag payments-flag is referenced outside the paths of project payments"},
+	}, c.check(changes))
+}
+
+func Test_writeCheckProblems(t *testing.T) {
+	problems := []checkProblem{
+		{kind: o.ProblemUnknown, path: "b.js", lineNum: 1, message: "flag new-flag does not exist in project web"},
+		{kind: o.ProblemArchived, path: "a.js", lineNum: 9, message: "flag old-flag in project web is archived"},
+	}
+
+	var out bytes.Buffer
+	require.False(t, writeCheckProblems(&out, problems, map[string]bool{o.ProblemPolicy: true}))
+	require.Equal(t, `a.js:9: warning: flag old-flag in project web is archived (archived)
+b.js:1: warning: flag new-flag does not exist in project web (unknown)
+`, out.String())
+
+	out.Reset()
+	require.True(t, writeCheckProblems(&out, problems, map[string]bool{o.ProblemArchived: true}))
+	require.Equal(t, `a.js:9: error: flag old-flag in project web is archived (archived)
+b.js:1: warning: flag new-flag does not exist in project web (unknown)
+flag reference check failed, see the failOn option
+`, out.String())
+}
@@ -2,8 +2,8 @@ package coderefs
 
 import (
 	"container/list"
+	"context"
 	"fmt"
-	"os"
 	"regexp"
 	"sort"
 	"strconv"
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/launchdarkly/ld-find-code-refs/internal/command"
+	"github.com/launchdarkly/ld-find-code-refs/internal/lang"
 	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
 	"github.com/launchdarkly/ld-find-code-refs/internal/log"
 	o "github.com/launchdarkly/ld-find-code-refs/internal/options"
@@ -53,176 +54,409 @@ type branch struct {
 	SearchResults    searchResultLines
 }
 
+// Scan searches the checkout provided by the dir option, and reports code references to LaunchDarkly.
+// The process exits if the scan fails.
 func Scan() {
-	dir := o.Dir.Value()
-	absPath, err := validation.NormalizeAndValidatePath(dir)
+	ctx, cancel := scanContext(o.Timeout.Value())
+	defer cancel()
+
+	startRunSummary()
+	err := scan(withLogFields(ctx))
+	if summaryErr := writeRunReports(err); summaryErr != nil {
+		if err == nil {
+			err = summaryErr
+		} else {
+			log.Error.Printf("%s", summaryErr)
+		}
+	}
 	if err != nil {
-		log.Error.Fatalf("could not validate directory option: %s", err)
+		cancel()
+		log.With(log.Fields{"errorCode": errorCode(err)}).Fatalf("%s", err)
 	}
+}
 
-	log.Info.Printf("absolute directory path: %s", absPath)
-	searchClient, err := command.NewAgClient(absPath)
+func scan(ctx context.Context) error {
+	opts, err := checkoutOptionsFromFlags()
 	if err != nil {
-		log.Error.Fatalf("%s", err)
+		return err
 	}
 
-	gitClient, err := command.NewGitClient(absPath)
+	s, err := newScanner(ctx)
 	if err != nil {
-		log.Error.Fatalf("%s", err)
+		return err
 	}
+	if len(s.flags) == 0 {
+		return nil
+	}
+
+	_, err = s.scanCheckout(ctx, opts)
+	return err
+}
 
-	projKey := o.ProjKey.Value()
+// checkoutOptions describes a single checkout to scan
+type checkoutOptions struct {
+	dir              string
+	branch           string
+	tag              string
+	baseBranch       string
+	exclude          string
+	updateSequenceId *int64
+	repos            []o.RepositoryConfig
+}
 
-	// Check for potential sdk keys or access tokens provided as the project key
-	if len(projKey) > maxProjKeyLength {
-		if strings.HasPrefix(projKey, "sdk-") {
-			log.Warning.Printf("provided projKey (%s) appears to be a LaunchDarkly SDK key", "sdk-xxxx")
-		} else if strings.HasPrefix(projKey, "api-") {
-			log.Warning.Printf("provided projKey (%s) appears to be a LaunchDarkly API access token", "api-xxxx")
-		}
+func checkoutOptionsFromFlags() (checkoutOptions, error) {
+	repoConfigs, err := o.Repositories()
+	if err != nil {
+		return checkoutOptions{}, fmt.Errorf("could not read repository configuration: %s", err)
 	}
 
-	ldApi := ld.InitApiClient(ld.ApiOptions{ApiKey: o.AccessToken.Value(), BaseUri: o.BaseUri.Value(), ProjKey: projKey, UserAgent: "LDFindCodeRefs/" + version.Version})
-	repoParams := ld.RepoParams{
-		Type:              o.RepoType.Value(),
-		Name:              o.RepoName.Value(),
-		Url:               o.RepoUrl.Value(),
-		CommitUrlTemplate: o.CommitUrlTemplate.Value(),
-		HunkUrlTemplate:   o.HunkUrlTemplate.Value(),
-		DefaultBranch:     o.DefaultBranch.Value(),
+	var updateId *int64
+	if o.UpdateSequenceId.Value() >= 0 {
+		updateIdOption := o.UpdateSequenceId.Value()
+		updateId = &updateIdOption
 	}
 
-	isDryRun := o.DryRun.Value()
+	return checkoutOptions{
+		dir:              o.Dir.Value(),
+		branch:           o.Branch.Value(),
+		tag:              o.Tag.Value(),
+		baseBranch:       o.BaseBranch.Value(),
+		exclude:          o.Exclude.Value(),
+		updateSequenceId: updateId,
+		repos:            repoConfigs,
+	}, nil
+}
 
-	if !isDryRun {
-		err = ldApi.MaybeUpsertCodeReferenceRepository(repoParams)
-		if err != nil {
-			log.Fatal.Fatalf(err.Error())
+// scanner holds the state shared between scans of one or more checkouts: the API client, the flags to search for,
+// how references are classified and which of them to count, the number of context lines sent for each file, and
+// the redactor applied to code references before they leave the machine (nil if redaction is disabled).
+type scanner struct {
+	ldApi     ld.ApiClient
+	projs     projects
+	flags     []string
+	kinds     []lang.Kind
+	usages    *lang.UsageClassifier
+	usageKeep []lang.Usage
+	ctxPolicy contextPolicy
+	redactor  *redactor
+}
+
+func newScanner(ctx context.Context) (*scanner, error) {
+	projectConfigs, err := o.Projects()
+	if err != nil {
+		return nil, fmt.Errorf("could not read project configuration: %s", err)
+	}
+
+	// Check for potential sdk keys or access tokens provided as the project key
+	for _, p := range projectConfigs {
+		if len(p.Key) > maxProjKeyLength {
+			if strings.HasPrefix(p.Key, "sdk-") {
+				log.Warning.Printf("provided projKey (%s) appears to be a LaunchDarkly SDK key", "sdk-xxxx")
+			} else if strings.HasPrefix(p.Key, "api-") {
+				log.Warning.Printf("provided projKey (%s) appears to be a LaunchDarkly API access token", "api-xxxx")
+			}
 		}
 	}
 
-	flags, err := getFlags(ldApi)
+	apiOptions := transportOptions()
+	apiOptions.ApiKey = o.AccessToken.Value()
+	apiOptions.BaseUri = o.BaseUri.Value()
+	apiOptions.UserAgent = "LDFindCodeRefs/" + version.Version
+	if currentRun != nil {
+		apiOptions.OnResponse = currentRun.addApiResponse
+	}
+	ldApi, err := ld.InitApiClient(apiOptions)
+	if err != nil {
+		return nil, fmt.Errorf("could not configure LaunchDarkly API client: %s", err)
+	}
+	s := &scanner{ldApi: ldApi}
+
+	err = apiPhase("flag fetch").run(ctx, func(ctx context.Context) (err error) {
+		s.projs, err = getProjects(ctx, ldApi, projectConfigs, flagDetailsRequired())
+		return err
+	})
 	if err != nil {
-		log.Fatal.Fatalf("could not retrieve flag keys from LaunchDarkly: %s", err)
+		return nil, wrapError(err, "could not retrieve flag keys from LaunchDarkly")
 	}
+	flags := s.projs.flagKeys()
 	if len(flags) == 0 {
-		log.Info.Printf("no flag keys found for project: %s, exiting early", projKey)
-		os.Exit(0)
+		log.Info.Printf("no flag keys found for projects: %s, exiting early", s.projs)
+		return s, nil
 	}
 
 	filteredFlags, omittedFlags := filterShortFlagKeys(flags)
 	if len(filteredFlags) == 0 {
-		log.Info.Printf("no flag keys longer than the minimum flag key length (%v) were found for project: %s, exiting early",
-			minFlagKeyLen, projKey)
-		os.Exit(0)
+		log.Info.Printf("no flag keys longer than the minimum flag key length (%v) were found for projects: %s, exiting early",
+			minFlagKeyLen, s.projs)
+		return s, nil
 	} else if len(omittedFlags) > 0 {
 		log.Warning.Printf("omitting %d flags with keys less than minimum (%d)", len(omittedFlags), minFlagKeyLen)
 	}
+	s.flags = filteredFlags
+	currentRun.setFlags(len(s.flags), len(omittedFlags))
+	log.SetField("flagCount", len(s.flags))
 
-	ctxLines := o.ContextLines.Value()
-	var updateId *int64
-	if o.UpdateSequenceId.Value() >= 0 {
-		updateIdOption := o.UpdateSequenceId.Value()
-		updateId = &updateIdOption
+	c, err := o.GetConfig()
+	if err != nil {
+		return nil, err
 	}
-	b := &branch{
-		Name:             gitClient.GitBranch,
-		UpdateSequenceId: updateId,
-		SyncTime:         makeTimestamp(),
-		Head:             gitClient.GitSha,
+	s.ctxPolicy = contextPolicy{defaultLines: o.ContextLines.Value(), rules: c.ContextLines}
+	for _, kind := range c.ReferenceKinds {
+		s.kinds = append(s.kinds, lang.Kind(kind))
 	}
-
-	// exclude option has already been validated as regex in options.go
-	excludeRegex, _ := regexp.Compile(o.Exclude.Value())
-	refs, err := findReferences(searchClient, filteredFlags, ctxLines, excludeRegex)
+	usageRules := make([]lang.UsageRule, 0, len(c.UsageRules))
+	for _, r := range c.UsageRules {
+		usageRules = append(usageRules, lang.UsageRule{Usage: lang.Usage(r.Usage), Pattern: r.Pattern, Languages: r.Languages, Paths: r.Paths})
+	}
+	s.usages, err = lang.NewUsageClassifier(usageRules)
 	if err != nil {
-		log.Fatal.Fatalf("error searching for flag key references: %s", err)
+		return nil, err
+	}
+	for _, usage := range c.ReferenceUsages {
+		s.usageKeep = append(s.usageKeep, lang.Usage(usage))
+	}
+	if o.RedactSecrets.Value() {
+		s.redactor, err = newRedactor(c.Redaction.Patterns, s.flags)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	b.SearchResults = refs
-	sort.Sort(b.SearchResults)
+	return s, nil
+}
 
-	branchRep := b.makeBranchRep(projKey, ctxLines)
+// checkoutStats counts the code references found in a checkout, across all repositories it reports to
+type checkoutStats struct {
+	References int `json:"references"`
+	Files      int `json:"files"`
+}
 
-	outDir := o.OutDir.Value()
-	if outDir != "" {
-		outPath, err := branchRep.WriteToCSV(outDir, projKey, repoParams.Name, gitClient.GitSha)
-		if err != nil {
-			log.Fatal.Fatalf("error writing code references to csv: %s", err)
-		}
-		log.Info.Printf("wrote code references to %s", outPath)
+// transportOptions returns the proxy and TLS options applied to every request, including those made to git host APIs
+func transportOptions() ld.ApiOptions {
+	return ld.ApiOptions{
+		ProxyUrl:       o.ProxyUrl.Value(),
+		CACertFiles:    o.CACertFiles(),
+		ClientCertFile: o.ClientCertFile.Value(),
+		ClientKeyFile:  o.ClientKeyFile.Value(),
+		TLSMinVersion:  o.TLSMinVersion.Value(),
+	}
+}
+
+func (s *scanner) scanCheckout(ctx context.Context, opts checkoutOptions) (checkoutStats, error) {
+	stats := checkoutStats{}
+
+	absPath, err := validation.NormalizeAndValidatePath(opts.dir)
+	if err != nil {
+		return stats, fmt.Errorf("could not validate directory option: %s", err)
 	}
 
-	if o.Debug.Value() {
-		branchRep.PrintReferenceCountTable()
+	log.Info.Printf("absolute directory path: %s", absPath)
+	searchClient, err := command.NewAgClient(absPath, ignoreOptions(), fileTypeOptions())
+	if err != nil {
+		return stats, err
 	}
 
-	if isDryRun {
-		log.Info.Printf(
-			"dry run found %d code references across %d flags and %d files",
-			branchRep.TotalHunkCount(),
-			len(filteredFlags),
-			len(branchRep.References),
-		)
-		return
+	var gitClient command.GitClient
+	err = gitPhase("git").run(ctx, func(ctx context.Context) (err error) {
+		if opts.tag != "" {
+			gitClient, err = command.NewGitTagClient(ctx, absPath, opts.tag)
+			return err
+		}
+		gitClient, err = command.NewGitClient(ctx, absPath, opts.branch)
+		return err
+	})
+	if err != nil {
+		return stats, err
 	}
+	setLogField(ctx, "branch", gitClient.GitBranch)
+
+	repos := newRepositories(opts.repos)
+	setLogField(ctx, "repo", repos[0].params.Name)
 
-	log.Info.Printf(
-		"sending %d code references across %d flags and %d files to LaunchDarkly for project: %s",
-		branchRep.TotalHunkCount(),
-		len(filteredFlags),
-		len(branchRep.References),
-		projKey,
-	)
+	isDryRun := o.DryRun.Value()
+
+	if !isDryRun {
+		for _, repo := range repos {
+			err = apiPhase("repository update").run(ctx, func(ctx context.Context) error {
+				return s.ldApi.MaybeUpsertCodeReferenceRepository(ctx, repo.params)
+			})
+			if err != nil {
+				return stats, err
+			}
+		}
+	}
 
-	err = ldApi.PutCodeReferenceBranch(branchRep, repoParams.Name)
+	excludeRegex, err := regexp.Compile(opts.exclude)
+	if err != nil {
+		return stats, fmt.Errorf("exclude must be a valid regular expression: %s", err)
+	}
+	var refs searchResultLines
+	err = searchPhase().run(ctx, func(ctx context.Context) (err error) {
+		refs, err = findReferences(ctx, searchClient, s.flags, s.ctxPolicy.searchLines(), excludeRegex, s.usages)
+		return err
+	})
 	if err != nil {
-		if err == ld.BranchUpdateSequenceIdConflictErr && b.UpdateSequenceId != nil {
-			log.Warning.Printf("updateSequenceId (%d) must be greater than previously submitted updateSequenceId", *b.UpdateSequenceId)
+		return stats, wrapError(err, "error searching for flag key references")
+	}
+	logSkippedFiles(searchClient.SkippedFiles())
+	refs = refs.withKinds(s.kinds).withUsages(s.usageKeep)
+	refs, lowConfidence := refs.withConfidence(o.MinConfidence.Value())
+	sort.Sort(refs)
+	sort.Sort(lowConfidence)
+	lowConfidenceByRepo := partitionByRepository(lowConfidence, repos)
+
+	var pr *prSummary
+	if opts.baseBranch != "" && prSummaryEnabled() {
+		if opts.baseBranch == gitClient.GitBranch {
+			log.Info.Printf("not summarizing changes in flag references, since %s is the base branch", opts.baseBranch)
 		} else {
-			log.Fatal.Fatalf("error sending code references to LaunchDarkly: %s", err)
+			pr = &prSummary{baseBranch: opts.baseBranch}
 		}
 	}
 
-	log.Info.Printf("attempting to prune old code reference data from LaunchDarkly")
-	remoteBranches, err := gitClient.RemoteBranches()
-	if err != nil {
-		log.Warning.Printf("unable to retrieve branch list from remote, skipping code reference pruning: %s", err)
-	} else {
-		err = deleteStaleBranches(ldApi, repoParams.Name, remoteBranches)
+	// The checkout is searched once, and the results are split between the repositories it reports to
+	syncTime := makeTimestamp()
+	for i, repoRefs := range partitionByRepository(refs, repos) {
+		repo := repos[i]
+		b := &branch{
+			Name:             gitClient.GitBranch,
+			UpdateSequenceId: opts.updateSequenceId,
+			SyncTime:         syncTime,
+			Head:             gitClient.GitSha,
+			SearchResults:    repoRefs,
+		}
+		hunkingStart := time.Now()
+		branchRep := b.makeBranchRep(s.projs, s.ctxPolicy)
+		currentRun.addPhase("hunking", time.Since(hunkingStart), nil)
+		// symbols are only reported by the csv files and the debug table, so files aren't read again otherwise
+		if o.Debug.Value() || o.CsvSymbols.Value() {
+			annotateSymbols(absPath, branchRep.References)
+		}
+		if s.redactor != nil {
+			redactions := s.redactor.redactReferences(branchRep.References)
+			for _, ref := range branchRep.References {
+				if redactions[ref.Path] > 0 {
+					log.Info.Printf("redacted %d potential secrets in %s", redactions[ref.Path], ref.Path)
+				}
+			}
+		}
+		// annotations are reported at paths in the checkout, which is the workspace of the workflow
+		if o.Annotations.Value() {
+			writeAnnotations(workflowOutput, branchRep.References, s.projs)
+		}
+		branchRep.References = repo.relativizeReferences(branchRep.References)
+		// the pull request summary reports on references to archived flags, which aren't recorded
+		summarizedRep := branchRep
+		branchRep.References = s.projs.withoutArchivedFlags(branchRep.References)
+		stats.References += branchRep.TotalHunkCount()
+		stats.Files += len(branchRep.References)
+		currentRun.addReferences(repo.params.Name, branchRep, s.projs)
+
+		outDir := o.OutDir.Value()
+		err = reportLowConfidence(lowConfidenceByRepo[i], o.MinConfidence.Value(), repo, outDir, gitClient.GitSha)
 		if err != nil {
-			log.Fatal.Fatalf("failed to mark old branches for code reference pruning: %s", err)
+			return stats, err
+		}
+		if outDir != "" {
+			for _, p := range s.projs {
+				outPath, err := branchRep.ForProject(p.key).WriteToCSV(outDir, p.key, repo.params.Name, gitClient.GitSha, o.CsvSymbols.Value())
+				if err != nil {
+					return stats, fmt.Errorf("error writing code references to csv: %s", err)
+				}
+				log.Info.Printf("wrote code references for project %s to %s", p.key, outPath)
+			}
 		}
-	}
-}
 
-func deleteStaleBranches(ldApi ld.ApiClient, repoName string, remoteBranches map[string]bool) error {
-	branches, err := ldApi.GetCodeReferenceRepositoryBranches(repoName)
-	if err != nil {
-		return err
+		if o.Debug.Value() {
+			for _, p := range s.projs {
+				if len(s.projs) > 1 {
+					log.Debug.Printf("references to flags in project %s:", p.key)
+				}
+				branchRep.ForProject(p.key).PrintReferenceCountTable()
+			}
+		}
+		if path := o.StepSummaryFile.Value(); path != "" {
+			err = appendStepSummary(path, repo.params.Name, branchRep, s.projs)
+			if err != nil {
+				return stats, err
+			}
+		}
+
+		if pr != nil {
+			err = pr.addRepository(ctx, s.ldApi, repo.params.Name, summarizedRep, s.projs)
+			if err != nil {
+				return stats, err
+			}
+		}
+
+		if isDryRun {
+			log.Info.Printf(
+				"dry run found %d code references across %d flags and %d files for repository: %s",
+				branchRep.TotalHunkCount(),
+				branchRep.FlagCount(),
+				len(branchRep.References),
+				repo.params.Name,
+			)
+			continue
+		}
+
+		// References for all projects are sent in a single request, since each hunk records its project and
+		// the branch endpoint replaces all references for the branch.
+		for _, p := range s.projs {
+			projBranchRep := branchRep.ForProject(p.key)
+			log.Info.Printf(
+				"sending %d code references across %d flags and %d files to LaunchDarkly for project: %s, repository: %s",
+				projBranchRep.TotalHunkCount(),
+				projBranchRep.FlagCount(),
+				len(projBranchRep.References),
+				p.key,
+				repo.params.Name,
+			)
+		}
+
+		err = apiPhase("upload").run(ctx, func(ctx context.Context) error {
+			return s.ldApi.PutCodeReferenceBranch(ctx, branchRep, repo.params.Name)
+		})
+		if err != nil {
+			if err == ld.BranchUpdateSequenceIdConflictErr && b.UpdateSequenceId != nil {
+				log.Warning.Printf("updateSequenceId (%d) must be greater than previously submitted updateSequenceId", *b.UpdateSequenceId)
+			} else {
+				return stats, wrapError(err, "error sending code references to LaunchDarkly")
+			}
+		}
 	}
 
-	staleBranches := calculateStaleBranches(branches, remoteBranches)
-	if len(staleBranches) > 0 {
-		log.Debug.Printf("marking stale branches for code reference pruning: %v", staleBranches)
-		err = ldApi.PostDeleteBranchesTask(repoName, staleBranches)
+	if pr != nil {
+		err = pr.report(ctx)
 		if err != nil {
-			return err
+			return stats, err
 		}
 	}
 
-	return nil
-}
+	if isDryRun {
+		return stats, nil
+	}
+	if !o.Prune.Value() {
+		log.Info.Printf("code reference pruning is disabled")
+		return stats, nil
+	}
 
-func calculateStaleBranches(branches []ld.BranchRep, remoteBranches map[string]bool) []string {
-	staleBranches := []string{}
-	for _, branch := range branches {
-		if !remoteBranches[branch.Name] {
-			staleBranches = append(staleBranches, branch.Name)
+	log.Info.Printf("attempting to prune old code reference data from LaunchDarkly")
+	remoteBranches, err := listBranches(ctx, gitClient)
+	if err != nil {
+		log.Warning.Printf("unable to retrieve branch list from %s, skipping code reference pruning: %s", o.BranchSource.Value(), err)
+		return stats, nil
+	}
+	for _, repo := range repos {
+		policy := prunePolicyFromFlags(repo.params.DefaultBranch)
+		err = apiPhase("pruning").run(ctx, func(ctx context.Context) error {
+			return deleteStaleBranches(ctx, s.ldApi, repo.params.Name, remoteBranches, policy)
+		})
+		if err != nil {
+			return stats, wrapError(err, "failed to mark old branches for code reference pruning")
 		}
 	}
-	log.Info.Printf("found %d stale branches to be marked for code reference pruning", len(staleBranches))
-	return staleBranches
+	return stats, nil
 }
 
 // Very short flag keys lead to many false positives when searching in code,
@@ -240,15 +474,15 @@ func filterShortFlagKeys(flags []string) (filtered []string, omitted []string) {
 	return filteredFlags, omittedFlags
 }
 
-func getFlags(ldApi ld.ApiClient) ([]string, error) {
-	flags, err := ldApi.GetFlagKeyList()
+func getFlags(ctx context.Context, ldApi ld.ApiClient, projKey string) ([]string, error) {
+	flags, err := ldApi.GetFlagKeyList(ctx, projKey)
 	if err != nil {
 		return nil, err
 	}
 	return flags, nil
 }
 
-func generateReferences(flags []string, searchResult [][]string, ctxLines int, delims string, exclude *regexp.Regexp) []searchResultLine {
+func generateReferences(flags []string, searchResult [][]string, ctxLines int, delims string, exclude *regexp.Regexp, usages *lang.UsageClassifier) []searchResultLine {
 	references := []searchResultLine{}
 
 	for _, r := range searchResult {
@@ -266,6 +500,9 @@ func generateReferences(flags []string, searchResult [][]string, ctxLines int, d
 		ref := searchResultLine{Path: path, LineNum: lineNum}
 		if contextContainsFlagKey {
 			ref.FlagKeys = findReferencedFlags(lineText, flags, delims)
+			if len(ref.FlagKeys) > 0 {
+				ref.classify(lineText, delims, usages)
+			}
 		}
 		if ctxLines >= 0 {
 			ref.LineText = lineText
@@ -287,36 +524,88 @@ func findReferencedFlags(ref string, flags []string, delims string) []string {
 	return ret
 }
 
-func (b *branch) makeBranchRep(projKey string, ctxLines int) ld.BranchRep {
+// classify records the kind, usage and confidence of each flag reference in the line. Kinds and usages are only
+// recorded for files in supported languages, and usages and confidence only when a usage classifier is provided.
+func (ref *searchResultLine) classify(lineText, delims string, usages *lang.UsageClassifier) {
+	language := lang.Detect(ref.Path)
+	if language != nil {
+		ref.Kinds = classifyReferencedFlags(language, lineText, ref.FlagKeys, delims)
+	}
+	if usages == nil {
+		return
+	}
+
+	if language != nil {
+		ref.Usages = make(map[string]lang.Usage, len(ref.FlagKeys))
+	}
+	ref.Confidence = make(map[string]int, len(ref.FlagKeys))
+	for _, flag := range ref.FlagKeys {
+		usage := usages.Classify(language, ref.Path, lineText, flag)
+		if language != nil {
+			ref.Usages[flag] = usage
+		}
+		ref.Confidence[flag] = scoreReference(flag, ref.Path, lineText, delims, ref.Kinds[flag], usage)
+	}
+}
+
+// classifyReferencedFlags returns the kind of reference to each flag in the line. If a flag is referenced more than
+// once, references in code take precedence over those in comments.
+func classifyReferencedFlags(language *lang.Language, line string, flags []string, delims string) map[string]lang.Kind {
+	kinds := make(map[string]lang.Kind, len(flags))
+	for _, flag := range flags {
+		for start := 0; start < len(line); {
+			i := strings.Index(line[start:], flag)
+			if i < 0 {
+				break
+			}
+			i += start
+			end := i + len(flag)
+			if i > 0 && end < len(line) && strings.IndexByte(delims, line[i-1]) >= 0 && strings.IndexByte(delims, line[end]) >= 0 {
+				kinds[flag] = lang.Merge(kinds[flag], language.Classify(line, i))
+			}
+			start = i + 1
+		}
+	}
+	return kinds
+}
+
+func (b *branch) makeBranchRep(projs projects, policy contextPolicy) ld.BranchRep {
 	return ld.BranchRep{
 		Name:             strings.TrimPrefix(b.Name, "refs/heads/"),
 		Head:             b.Head,
 		UpdateSequenceId: b.UpdateSequenceId,
 		SyncTime:         b.SyncTime,
-		References:       b.SearchResults.makeReferenceHunksReps(projKey, ctxLines),
+		References:       b.SearchResults.makeReferenceHunksReps(projs, policy),
 	}
 }
 
-func (g searchResultLines) makeReferenceHunksReps(projKey string, ctxLines int) []ld.ReferenceHunksRep {
+func (g searchResultLines) makeReferenceHunksReps(projs projects, policy contextPolicy) []ld.ReferenceHunksRep {
 	reps := []ld.ReferenceHunksRep{}
 
 	aggregatedSearchResults := g.aggregateByPath()
 
 	if len(aggregatedSearchResults) > maxFileCount {
 		log.Warning.Printf("found %d files with code references, which exceeded the limit of %d", len(aggregatedSearchResults), maxFileCount)
+		currentRun.addLimit(limitExceeded{Limit: "maxFileCount", Max: maxFileCount, Found: len(aggregatedSearchResults)}, len(aggregatedSearchResults)-maxFileCount, 0)
 		aggregatedSearchResults = aggregatedSearchResults[0:maxFileCount]
 	}
 
 	numHunks := 0
 
 	shouldSuppressUnexpectedError := false
-	for _, fileSearchResults := range aggregatedSearchResults {
+	for i, fileSearchResults := range aggregatedSearchResults {
 		if numHunks > maxHunkCount {
 			log.Warning.Printf("found %d code references across all files, which exceeeded the limit of %d. halting code reference search", numHunks, maxHunkCount)
+			currentRun.addLimit(limitExceeded{Limit: "maxHunkCount", Max: maxHunkCount, Found: numHunks}, len(aggregatedSearchResults)-i, 0)
 			break
 		}
 
-		hunks := fileSearchResults.makeHunkReps(projKey, ctxLines)
+		hunks := fileSearchResults.makeHunkReps(projs, policy)
+
+		if len(hunks) == 0 && !fileSearchResults.isAttributed(projs) {
+			log.Debug.Printf("skipping '%s': flag references are outside the paths of the projects they belong to", fileSearchResults.path)
+			continue
+		}
 
 		if len(hunks) == 0 && !shouldSuppressUnexpectedError {
 			log.Error.Printf("expected code references but found none in '%s'", fileSearchResults.path)
@@ -328,6 +617,7 @@ func (g searchResultLines) makeReferenceHunksReps(projKey string, ctxLines int)
 
 		if len(hunks) > maxHunksPerFileCount {
 			log.Warning.Printf("found %d code references in %s, which exceeded the limit of %d, truncating file hunks", len(hunks), fileSearchResults.path, maxHunksPerFileCount)
+			currentRun.addLimit(limitExceeded{Limit: "maxHunksPerFileCount", Max: maxHunksPerFileCount, Found: len(hunks), Path: fileSearchResults.path}, 0, len(hunks)-maxHunksPerFileCount)
 			hunks = hunks[0:maxHunksPerFileCount]
 		}
 
@@ -403,12 +693,23 @@ func (fsr *fileSearchResults) addFlagReference(key string, ref *list.Element) {
 	}
 }
 
-func (fsr fileSearchResults) makeHunkReps(projKey string, ctxLines int) []ld.HunkRep {
+func (fsr fileSearchResults) makeHunkReps(projs projects, policy contextPolicy) []ld.HunkRep {
 	hunks := []ld.HunkRep{}
 
+	ctxLines, source := policy.linesFor(fsr.path)
+	log.Debug.Printf("using %d context lines for '%s' (%s)", ctxLines, fsr.path, source)
+
 	for flagKey, flagReferences := range fsr.flagReferenceMap {
-		flagHunks := buildHunksForFlag(projKey, flagKey, fsr.path, flagReferences, ctxLines)
-		hunks = append(hunks, flagHunks...)
+		for _, projKey := range projs.keysFor(fsr.path, flagKey) {
+			flagHunks := buildHunksForFlag(projKey, flagKey, fsr.path, flagReferences, ctxLines)
+			hunks = append(hunks, flagHunks...)
+		}
+	}
+
+	if language := lang.Detect(fsr.path); language != nil {
+		for i := range hunks {
+			hunks[i].Language = language.Name
+		}
 	}
 
 	return hunks
@@ -478,11 +779,22 @@ func buildHunksForFlag(projKey, flag, path string, flagReferences []*list.Elemen
 			}
 		}
 
+		refKind := ref.Value.(searchResultLine).Kinds[flag]
+		refUsage := ref.Value.(searchResultLine).Usages[flag]
+		refConfidence := ref.Value.(searchResultLine).Confidence[flag]
 		if appendToPreviousHunk {
 			previousHunk.Lines = hunkStringBuilder.String()
+			previousHunk.Kind = string(lang.Merge(lang.Kind(previousHunk.Kind), refKind))
+			previousHunk.Usage = string(lang.MergeUsage(lang.Usage(previousHunk.Usage), refUsage))
+			if refConfidence > previousHunk.Confidence {
+				previousHunk.Confidence = refConfidence
+			}
 			appendToPreviousHunk = false
 		} else {
 			currentHunk.Lines = hunkStringBuilder.String()
+			currentHunk.Kind = string(refKind)
+			currentHunk.Usage = string(refUsage)
+			currentHunk.Confidence = refConfidence
 			hunks = append(hunks, currentHunk)
 			previousHunk = &hunks[len(hunks)-1]
 		}
@@ -492,6 +804,7 @@ func buildHunksForFlag(projKey, flag, path string, flagReferences []*list.Elemen
 		if numHunkedLines > maxHunkedLinesPerFileAndFlagCount {
 			log.Warning.Printf("found %d code reference lines in %s for the flag %s, which exceeded the limit of %d. truncating code references for this path and flag.",
 				numHunkedLines, path, flag, maxHunkedLinesPerFileAndFlagCount)
+			currentRun.addLimit(limitExceeded{Limit: "maxHunkedLinesPerFileAndFlagCount", Max: maxHunkedLinesPerFileAndFlagCount, Found: numHunkedLines, Path: path, FlagKey: flag}, 0, 0)
 			return hunks
 		}
 	}
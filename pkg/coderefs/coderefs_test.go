@@ -6,10 +6,12 @@ import (
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/launchdarkly/ld-find-code-refs/internal/lang"
 	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
 	"github.com/launchdarkly/ld-find-code-refs/internal/log"
 )
@@ -37,6 +39,11 @@ const (
 	testFlagKey2 = "anotherFlag"
 )
 
+// testProjects returns a single project containing all flag keys used in tests
+func testProjects(projKey string) projects {
+	return projects{newProject(projKey, nil, []string{"flag-1", "flag-2", "flag-3", "flag-4", testFlagKey, testFlagKey2})}
+}
+
 func TestMain(m *testing.M) {
 	log.Init(true)
 	os.Exit(m.Run())
@@ -132,6 +139,23 @@ func Test_generateReferences(t *testing.T) {
 			ctxLines:     0,
 			want:         []searchResultLine{testWant},
 		},
+		{
+			name:  "classifies references in supported languages",
+			flags: []string{testFlagKey, testFlagKey2},
+			searchResult: [][]string{
+				{"", "main.go", ":", "12", `x := "someFlag" // was "anotherFlag"`},
+			},
+			ctxLines: 0,
+			want: []searchResultLine{
+				{
+					Path:     "main.go",
+					LineNum:  12,
+					LineText: `x := "someFlag" // was "anotherFlag"`,
+					FlagKeys: []string{testFlagKey, testFlagKey2},
+					Kinds:    map[string]lang.Kind{testFlagKey: lang.String, testFlagKey2: lang.Comment},
+				},
+			},
+		},
 		{
 			// delimeters don't have to match on both sides
 			name:  "succeeds with multiple delimiters",
@@ -149,7 +173,7 @@ func Test_generateReferences(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			ex, err := regexp.Compile(tt.exclude)
 			require.NoError(t, err)
-			got := generateReferences(tt.flags, tt.searchResult, tt.ctxLines, `"'`, ex)
+			got := generateReferences(tt.flags, tt.searchResult, tt.ctxLines, `"'`, ex, nil)
 			require.Equal(t, tt.want, got)
 		})
 	}
@@ -279,7 +303,7 @@ func Test_makeReferenceHunksReps(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := tt.refs.makeReferenceHunksReps(projKey, 1)
+			got := tt.refs.makeReferenceHunksReps(testProjects(projKey), uniformContext(1))
 
 			require.Equal(t, tt.want, got)
 		})
@@ -794,7 +818,7 @@ func Test_makeHunkReps(t *testing.T) {
 
 			fileSearchResults := groupedResults[0]
 
-			got := fileSearchResults.makeHunkReps(projKey, tt.ctxLines)
+			got := fileSearchResults.makeHunkReps(testProjects(projKey), uniformContext(tt.ctxLines))
 
 			sort.Sort(byStartingLineNumber(got))
 
@@ -979,7 +1003,52 @@ func Test_calculateStaleBranches(t *testing.T) {
 				remoteBranchMap[b] = true
 			}
 
-			assert.ElementsMatch(t, tt.expected, calculateStaleBranches(branchReps, remoteBranchMap))
+			assert.ElementsMatch(t, tt.expected, prunedBranchNames(calculateStaleBranches(branchReps, remoteBranchMap, prunePolicy{}, time.Now())))
 		})
 	}
 }
+
+func Test_withKinds(t *testing.T) {
+	lines := searchResultLines{
+		{Path: "main.go", LineNum: 1, FlagKeys: []string{"flag-1", "flag-2"}, Kinds: map[string]lang.Kind{"flag-1": lang.String, "flag-2": lang.Comment}},
+		{Path: "CHANGELOG.md", LineNum: 1, FlagKeys: []string{"flag-2"}},
+	}
+
+	require.Equal(t, lines, lines.withKinds(nil))
+
+	got := lines.withKinds([]lang.Kind{lang.String, lang.Identifier})
+	require.Equal(t, searchResultLines{
+		{Path: "main.go", LineNum: 1, FlagKeys: []string{"flag-1"}, Kinds: map[string]lang.Kind{"flag-1": lang.String}},
+		{Path: "CHANGELOG.md", LineNum: 1, FlagKeys: []string{"flag-2"}},
+	}, got)
+}
+
+func Test_makeHunkRepsClassifiesHunks(t *testing.T) {
+	refs := searchResultLines{
+		{Path: "app.js", LineNum: 1, LineText: "// flag-1", FlagKeys: []string{"flag-1"}, Kinds: map[string]lang.Kind{"flag-1": lang.Comment}},
+		{Path: "app.js", LineNum: 2, LineText: "v('flag-1')", FlagKeys: []string{"flag-1"}, Kinds: map[string]lang.Kind{"flag-1": lang.String}},
+		{Path: "app.js", LineNum: 3, LineText: ""},
+		{Path: "app.js", LineNum: 9, LineText: ""},
+		{Path: "app.js", LineNum: 10, LineText: "// flag-1", FlagKeys: []string{"flag-1"}, Kinds: map[string]lang.Kind{"flag-1": lang.Comment}},
+	}
+
+	got := refs.aggregateByPath()[0].makeHunkReps(testProjects("test"), uniformContext(1))
+	require.Equal(t, []ld.HunkRep{
+		{StartingLineNumber: 1, Lines: "// flag-1\nv('flag-1')\n\n", ProjKey: "test", FlagKey: "flag-1", Kind: "string", Language: "javascript"},
+		{StartingLineNumber: 9, Lines: "\n// flag-1\n", ProjKey: "test", FlagKey: "flag-1", Kind: "comment", Language: "javascript"},
+	}, got)
+}
+
+func Test_generateReferencesClassifiesUsages(t *testing.T) {
+	usages, err := lang.NewUsageClassifier(nil)
+	require.NoError(t, err)
+	line := `if client.BoolVariation("someFlag", user, false) && "anotherFlag" != "" {`
+	got := generateReferences([]string{testFlagKey, testFlagKey2}, [][]string{{"", "main.go", ":", "3", line}}, 0, `"`, nil, usages)
+
+	require.Equal(t, map[string]lang.Usage{testFlagKey: lang.Evaluation, testFlagKey2: lang.Other}, got[0].Usages)
+	require.Equal(t, searchResultLines{
+		{Path: "main.go", LineNum: 3, LineText: line, FlagKeys: []string{testFlagKey},
+			Kinds: map[string]lang.Kind{testFlagKey: lang.String}, Usages: map[string]lang.Usage{testFlagKey: lang.Evaluation},
+			Confidence: map[string]int{testFlagKey: 100}},
+	}, searchResultLines(got).withUsages([]lang.Usage{lang.Evaluation}))
+}
@@ -0,0 +1,238 @@
+package coderefs
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/lang"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/internal/validation"
+)
+
+const (
+	baseConfidence = 50
+	maxConfidence  = 100
+
+	// maxLowConfidenceLogged limits how many excluded references are logged, the rest are only counted
+	maxLowConfidenceLogged = 50
+)
+
+// commonWords are flag keys, or parts of flag keys, likely to appear in source code for reasons unrelated to flags
+var commonWords = map[string]bool{}
+
+func init() {
+	for _, w := range strings.Fields(`
+		a about access account active add admin alert all alpha api app apply archive auth auto
+		back banner basic beta billing blue body button cache cancel card cart change chat check checkout
+		clear click close code color config content create current custom dark dashboard data debug default
+		delete demo dev disable disabled display done down draft edit email enable enabled error event
+		experiment export external false fast feature file filter flag flow footer form free full green
+		header help hidden home icon id image import info input key label layout legacy light limit link
+		list live load local lock log login logout main maintenance menu message mobile mode modal name
+		nav new next notification notifications off old on open order page panel password pay payment
+		plan preview pricing primary profile promo public query quick rate read red redesign refresh
+		release remote report request reset search secondary settings setup share show sidebar sign signup
+		simple size sort status store style submit summary support sync tab table test text theme toggle
+		top tracking trial true ui update upload user users v1 v2 v3 version view web welcome widget
+	`) {
+		commonWords[w] = true
+	}
+}
+
+// scoreReference scores how likely a reference to flagKey in line is to be a genuine flag reference rather than a
+// coincidental match, from 0 to 100. Long, unusual keys evaluated through an SDK in source code score highly,
+// while short dictionary words mentioned in comments or documentation score poorly.
+func scoreReference(flagKey, path, line, delims string, kind lang.Kind, usage lang.Usage) int {
+	score := baseConfidence
+
+	switch {
+	case len(flagKey) >= 12:
+		score += 20
+	case len(flagKey) >= 8:
+		score += 10
+	case len(flagKey) < 5:
+		score -= 15
+	}
+
+	if commonWords[strings.ToLower(flagKey)] {
+		score -= 25
+	} else if isCommonPhrase(flagKey) {
+		score -= 10
+	}
+
+	if quotedReference(flagKey, line, delims) {
+		score += 10
+	}
+
+	switch usage {
+	case lang.Evaluation:
+		score += 30
+	case lang.Constant:
+		score += 15
+	case lang.Other:
+		score -= 5
+	}
+
+	if kind == lang.Comment {
+		score -= 15
+	}
+
+	switch {
+	case lang.Detect(path) != nil:
+		score += 5
+	case isDocumentation(path):
+		score -= 15
+	}
+
+	if score < 0 {
+		return 0
+	}
+	if score > maxConfidence {
+		return maxConfidence
+	}
+	return score
+}
+
+// isCommonPhrase reports whether a key is made of at most two common words, e.g. `new-ui`
+func isCommonPhrase(flagKey string) bool {
+	words := strings.FieldsFunc(strings.ToLower(flagKey), func(r rune) bool {
+		return r == '-' || r == '_' || r == '.'
+	})
+	if len(words) == 0 || len(words) > 2 {
+		return false
+	}
+	for _, w := range words {
+		if !commonWords[w] {
+			return false
+		}
+	}
+	return true
+}
+
+// quotedReference reports whether any occurrence of flagKey in line is delimited by quotes, rather than only by
+// custom delimiters
+func quotedReference(flagKey, line, delims string) bool {
+	quotes := "\"'`"
+	for start := 0; start < len(line); {
+		i := strings.Index(line[start:], flagKey)
+		if i < 0 {
+			return false
+		}
+		i += start
+		end := i + len(flagKey)
+		if i > 0 && end < len(line) && strings.IndexByte(delims, line[i-1]) >= 0 && strings.IndexByte(quotes, line[i-1]) >= 0 &&
+			strings.IndexByte(quotes, line[end]) >= 0 {
+			return true
+		}
+		start = i + 1
+	}
+	return false
+}
+
+func isDocumentation(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".md", ".markdown", ".txt", ".rst", ".adoc", ".html", ".htm":
+		return true
+	}
+	return false
+}
+
+// withConfidence removes references scoring below minConfidence, and returns them separately so that they can be
+// reported for review. Lines without scores are kept.
+func (lines searchResultLines) withConfidence(minConfidence int) (kept searchResultLines, excluded searchResultLines) {
+	excluded = searchResultLines{}
+	if minConfidence <= 0 {
+		return lines, excluded
+	}
+
+	for _, line := range lines {
+		if line.Confidence == nil {
+			continue
+		}
+		low := searchResultLine{Path: line.Path, LineNum: line.LineNum, LineText: line.LineText, Confidence: map[string]int{}}
+		for _, flagKey := range line.FlagKeys {
+			if line.Confidence[flagKey] < minConfidence {
+				low.FlagKeys = append(low.FlagKeys, flagKey)
+				low.Confidence[flagKey] = line.Confidence[flagKey]
+			}
+		}
+		if len(low.FlagKeys) > 0 {
+			excluded = append(excluded, low)
+		}
+	}
+
+	lines.filterFlagReferences(func(line searchResultLine, flagKey string) bool {
+		return line.Confidence == nil || line.Confidence[flagKey] >= minConfidence
+	})
+	return lines, excluded
+}
+
+// reportLowConfidence logs references excluded for scoring below the minConfidence option, and writes them to a
+// csv file in outDir, if provided
+func reportLowConfidence(excluded searchResultLines, minConfidence int, repo repository, outDir, sha string) error {
+	count := 0
+	for _, line := range excluded {
+		count += len(line.FlagKeys)
+	}
+	if count == 0 {
+		return nil
+	}
+
+	log.Warning.Printf("excluded %d references with a confidence below %d from repository %s, please review them:", count, minConfidence, repo.params.Name)
+	logged := 0
+	for _, line := range excluded {
+		for _, flagKey := range line.FlagKeys {
+			if logged < maxLowConfidenceLogged {
+				log.Info.Printf("  %s:%d %s (confidence %d)", repo.relativePath(line.Path), line.LineNum, flagKey, line.Confidence[flagKey])
+			}
+			logged++
+		}
+	}
+	if logged > maxLowConfidenceLogged {
+		log.Info.Printf("  ... and %d more", logged-maxLowConfidenceLogged)
+	}
+
+	if outDir == "" {
+		return nil
+	}
+	path, err := writeLowConfidenceCSV(excluded, repo, outDir, sha)
+	if err != nil {
+		return fmt.Errorf("error writing low confidence references to csv: %s", err)
+	}
+	log.Info.Printf("wrote low confidence references to %s", path)
+	return nil
+}
+
+func writeLowConfidenceCSV(excluded searchResultLines, repo repository, outDir, sha string) (string, error) {
+	absPath, err := validation.NormalizeAndValidatePath(outDir)
+	if err != nil {
+		return "", fmt.Errorf("invalid outDir '%s': %s", outDir, err)
+	}
+	if len(sha) > 7 {
+		sha = sha[:7]
+	}
+	path := filepath.Join(absPath, fmt.Sprintf("coderefs_low_confidence_%s_%s.csv", repo.params.Name, sha))
+
+	records := [][]string{}
+	for _, line := range excluded {
+		for _, flagKey := range line.FlagKeys {
+			records = append(records, []string{flagKey, repo.relativePath(line.Path), strconv.Itoa(line.LineNum), strconv.Itoa(line.Confidence[flagKey])})
+		}
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i][0] < records[j][0]
+	})
+
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	return path, w.WriteAll(append([][]string{{"flagKey", "path", "lineNumber", "confidence"}}, records...))
+}
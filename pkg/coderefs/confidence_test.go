@@ -0,0 +1,106 @@
+package coderefs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/lang"
+)
+
+func Test_scoreReference(t *testing.T) {
+	specs := []struct {
+		name     string
+		flagKey  string
+		path     string
+		line     string
+		kind     lang.Kind
+		usage    lang.Usage
+		expected int
+	}{
+		{
+			name:     "long key evaluated in source code",
+			flagKey:  "checkout-redesign-2024",
+			path:     "app.go",
+			line:     `client.BoolVariation("checkout-redesign-2024", user, false)`,
+			kind:     lang.String,
+			usage:    lang.Evaluation,
+			expected: 100,
+		},
+		{
+			name:     "constant holding a medium length key",
+			flagKey:  "new-cart-ui",
+			path:     "flags.py",
+			line:     `NEW_CART = "new-cart-ui"`,
+			kind:     lang.String,
+			usage:    lang.Constant,
+			expected: 90,
+		},
+		{
+			name:     "common word in a comment",
+			flagKey:  "beta",
+			path:     "app.js",
+			line:     `// beta users only`,
+			kind:     lang.Comment,
+			usage:    lang.Other,
+			expected: 0,
+		},
+		{
+			name:     "common word in documentation",
+			flagKey:  "search",
+			path:     "README.md",
+			line:     `Use the search box`,
+			expected: 10,
+		},
+		{
+			name:     "phrase of common words in an unsupported file",
+			flagKey:  "new-ui",
+			path:     "main.c",
+			line:     `flag("new-ui")`,
+			expected: 50,
+		},
+		{
+			name:     "key delimited by custom delimiters only",
+			flagKey:  "pricing-experiment-v2",
+			path:     "template.c",
+			line:     `<pricing-experiment-v2>`,
+			expected: 70,
+		},
+	}
+
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, scoreReference(tt.flagKey, tt.path, tt.line, "\"'`<>", tt.kind, tt.usage))
+		})
+	}
+}
+
+func Test_withConfidence(t *testing.T) {
+	lines := searchResultLines{
+		{Path: "a.go", LineNum: 1, FlagKeys: []string{"flag-1", "beta"}, Confidence: map[string]int{"flag-1": 90, "beta": 20}},
+		{Path: "a.go", LineNum: 2},
+		{Path: "b.go", LineNum: 1, FlagKeys: []string{"beta"}, Confidence: map[string]int{"beta": 40}},
+		{Path: "c.go", LineNum: 1, FlagKeys: []string{"flag-2"}},
+	}
+
+	kept, excluded := lines.withConfidence(50)
+	require.Equal(t, searchResultLines{
+		{Path: "a.go", LineNum: 1, FlagKeys: []string{"flag-1"}, Confidence: map[string]int{"flag-1": 90}},
+		{Path: "a.go", LineNum: 2},
+		{Path: "b.go", LineNum: 1, FlagKeys: []string{}, Confidence: map[string]int{}},
+		{Path: "c.go", LineNum: 1, FlagKeys: []string{"flag-2"}},
+	}, kept)
+	require.Equal(t, searchResultLines{
+		{Path: "a.go", LineNum: 1, FlagKeys: []string{"beta"}, Confidence: map[string]int{"beta": 20}},
+		{Path: "b.go", LineNum: 1, FlagKeys: []string{"beta"}, Confidence: map[string]int{"beta": 40}},
+	}, excluded)
+}
+
+func Test_withConfidenceDisabled(t *testing.T) {
+	lines := searchResultLines{
+		{Path: "a.go", LineNum: 1, FlagKeys: []string{"beta"}, Confidence: map[string]int{"beta": 0}},
+	}
+	kept, excluded := lines.withConfidence(0)
+	require.Equal(t, lines, kept)
+	require.Empty(t, excluded)
+}
@@ -0,0 +1,42 @@
+package coderefs
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/glob"
+	o "github.com/launchdarkly/ld-find-code-refs/internal/options"
+)
+
+// contextPolicy decides how many lines of source code are sent with the references in each file. Files matching a
+// rule from the config file use the rule's context lines, and all other files use the contextLines option.
+type contextPolicy struct {
+	defaultLines int
+	rules        []o.ContextLinesRule
+}
+
+func uniformContext(ctxLines int) contextPolicy {
+	return contextPolicy{defaultLines: ctxLines}
+}
+
+// linesFor returns the number of context lines for path, and a description of where that number came from
+func (p contextPolicy) linesFor(path string) (int, string) {
+	for _, rule := range p.rules {
+		if glob.MatchAny(rule.Paths, path) {
+			return rule.ContextLines, fmt.Sprintf("config rule for %s", strings.Join(rule.Paths, ", "))
+		}
+	}
+	return p.defaultLines, "contextLines option"
+}
+
+// searchLines returns the number of context lines to search with, so that every file can be given as many as its
+// policy allows. If no file may include source code, the search doesn't return any.
+func (p contextPolicy) searchLines() int {
+	max := p.defaultLines
+	for _, rule := range p.rules {
+		if rule.ContextLines > max {
+			max = rule.ContextLines
+		}
+	}
+	return max
+}
@@ -0,0 +1,56 @@
+package coderefs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	o "github.com/launchdarkly/ld-find-code-refs/internal/options"
+)
+
+func Test_contextPolicy(t *testing.T) {
+	policy := contextPolicy{defaultLines: 1, rules: []o.ContextLinesRule{
+		{Paths: []string{"billing/**", "crypto/**"}, ContextLines: -1},
+		{Paths: []string{"frontend/**"}, ContextLines: 3},
+		{Paths: []string{"frontend/**"}, ContextLines: 0},
+	}}
+
+	specs := []struct {
+		name           string
+		path           string
+		expectedLines  int
+		expectedSource string
+	}{
+		{"uses the contextLines option by default", "main.go", 1, "contextLines option"},
+		{"uses matching rule", "crypto/keys.go", -1, "config rule for billing/**, crypto/**"},
+		{"uses first matching rule", "frontend/app.js", 3, "config rule for frontend/**"},
+	}
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, source := policy.linesFor(tt.path)
+			require.Equal(t, tt.expectedLines, lines)
+			require.Equal(t, tt.expectedSource, source)
+		})
+	}
+
+	require.Equal(t, 3, policy.searchLines())
+	require.Equal(t, -1, contextPolicy{defaultLines: -1, rules: []o.ContextLinesRule{{Paths: []string{"a/**"}, ContextLines: -1}}}.searchLines())
+}
+
+func Test_makeReferenceHunksRepsWithContextRules(t *testing.T) {
+	projs := projects{newProject("proj-a", nil, []string{"flag-1"})}
+	policy := contextPolicy{defaultLines: 1, rules: []o.ContextLinesRule{{Paths: []string{"billing/**"}, ContextLines: -1}}}
+	refs := searchResultLines{
+		{Path: "billing/charge.go", LineNum: 1, LineText: "a"},
+		{Path: "billing/charge.go", LineNum: 2, LineText: "flag-1", FlagKeys: []string{"flag-1"}},
+		{Path: "frontend/app.js", LineNum: 1, LineText: "a"},
+		{Path: "frontend/app.js", LineNum: 2, LineText: "flag-1", FlagKeys: []string{"flag-1"}},
+	}
+
+	got := refs.makeReferenceHunksReps(projs, policy)
+	require.Equal(t, []ld.ReferenceHunksRep{
+		{Path: "billing/charge.go", Hunks: []ld.HunkRep{{StartingLineNumber: 2, ProjKey: "proj-a", FlagKey: "flag-1", Language: "go"}}},
+		{Path: "frontend/app.js", Hunks: []ld.HunkRep{{StartingLineNumber: 1, Lines: "a\nflag-1\n", ProjKey: "proj-a", FlagKey: "flag-1", Language: "javascript"}}},
+	}, got)
+}
@@ -0,0 +1,131 @@
+package coderefs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	o "github.com/launchdarkly/ld-find-code-refs/internal/options"
+)
+
+// flagCache holds the flags of each project, including archived flags, so that the check command doesn't need to
+// request them from LaunchDarkly for every commit
+type flagCache struct {
+	FetchedAt time.Time            `json:"fetchedAt"`
+	BaseUri   string               `json:"baseUri"`
+	Projects  map[string][]ld.Flag `json:"projects"`
+}
+
+// readFlagCache reads the cache at path. It returns nil if there is no cache.
+func readFlagCache(path string) (*flagCache, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var c flagCache
+	err = json.Unmarshal(data, &c)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse flag cache %s: %s", path, err)
+	}
+	return &c, nil
+}
+
+// covers reports whether the cache holds the flags of every project, fetched from baseUri
+func (c *flagCache) covers(baseUri string, configs []o.ProjectConfig) bool {
+	if c == nil || c.BaseUri != baseUri {
+		return false
+	}
+	for _, p := range configs {
+		if _, ok := c.Projects[p.Key]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// writeFlagCache writes the cache to path. The file is replaced atomically, since several checks may run at once.
+func writeFlagCache(path string, c flagCache) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// flagSource fetches the flags of a project, including archived flags
+type flagSource func(ctx context.Context, projKey string) ([]ld.Flag, error)
+
+// cachedProjects returns the projects with the flags cached at path. The flags are fetched, and the cache replaced,
+// when the cache is older than ttl or doesn't cover every project, unless fetch is nil. A stale cache is used if the
+// flags can't be fetched.
+func cachedProjects(ctx context.Context, path string, configs []o.ProjectConfig, baseUri string, ttl time.Duration, fetch flagSource, now time.Time) (projects, error) {
+	cache, err := readFlagCache(path)
+	if err != nil {
+		log.Warning.Printf("ignoring flag cache: %s", err)
+		cache = nil
+	}
+	covered := cache.covers(baseUri, configs)
+	if !covered || now.Sub(cache.FetchedAt) >= ttl {
+		fetched, err := fetchFlagCache(ctx, configs, baseUri, fetch, now)
+		switch {
+		case err == nil:
+			cache = fetched
+			err = writeFlagCache(path, *cache)
+			if err != nil {
+				log.Warning.Printf("could not write flag cache %s: %s", path, err)
+			}
+		case !covered:
+			return nil, err
+		default:
+			log.Warning.Printf("using flags cached %s ago: %s", now.Sub(cache.FetchedAt).Round(time.Minute), err)
+		}
+	} else {
+		log.Debug.Printf("using flags cached at %s", path)
+	}
+
+	ret := make(projects, 0, len(configs))
+	for _, c := range configs {
+		ret = append(ret, newProjectWithDetails(c.Key, c.Paths, cache.Projects[c.Key]))
+	}
+	return ret, nil
+}
+
+func fetchFlagCache(ctx context.Context, configs []o.ProjectConfig, baseUri string, fetch flagSource, now time.Time) (*flagCache, error) {
+	if fetch == nil {
+		return nil, fmt.Errorf("the flag cache is missing or stale, and accessToken is not set to fetch flags from LaunchDarkly")
+	}
+	c := flagCache{FetchedAt: now, BaseUri: baseUri, Projects: map[string][]ld.Flag{}}
+	for _, p := range configs {
+		flags, err := fetch(ctx, p.Key)
+		if err != nil {
+			return nil, wrapError(err, fmt.Sprintf("could not retrieve flags for project %s from LaunchDarkly", p.Key))
+		}
+		c.Projects[p.Key] = flags
+	}
+	return &c, nil
+}
@@ -0,0 +1,75 @@
+package coderefs
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	o "github.com/launchdarkly/ld-find-code-refs/internal/options"
+)
+
+func Test_cachedProjects(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flag-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "ld-find-code-refs", "flags.json")
+
+	const baseUri = "https://app.launchdarkly.com"
+	configs := []o.ProjectConfig{{Key: "web"}}
+	now := time.Date(2020, 5, 9, 12, 0, 0, 0, time.UTC)
+	fetches := 0
+	fetch := func(ctx context.Context, projKey string) ([]ld.Flag, error) {
+		fetches++
+		return []ld.Flag{{Key: "active-flag"}, {Key: "old-flag", Archived: true}}, nil
+	}
+	failingFetch := func(ctx context.Context, projKey string) ([]ld.Flag, error) {
+		return nil, errors.New("network is unreachable")
+	}
+	requireFlags := func(projs projects) {
+		require.Len(t, projs, 1)
+		require.Equal(t, "web", projs[0].key)
+		require.True(t, projs[0].flags["active-flag"])
+		require.True(t, projs[0].flag("old-flag").Archived)
+	}
+
+	_, err = cachedProjects(context.Background(), path, configs, baseUri, time.Hour, nil, now)
+	require.EqualError(t, err, "the flag cache is missing or stale, and accessToken is not set to fetch flags from LaunchDarkly")
+	_, err = cachedProjects(context.Background(), path, configs, baseUri, time.Hour, failingFetch, now)
+	require.EqualError(t, err, "could not retrieve flags for project web from LaunchDarkly: network is unreachable")
+
+	projs, err := cachedProjects(context.Background(), path, configs, baseUri, time.Hour, fetch, now)
+	require.NoError(t, err)
+	requireFlags(projs)
+	require.Equal(t, 1, fetches)
+
+	// a fresh cache is used without fetching flags
+	projs, err = cachedProjects(context.Background(), path, configs, baseUri, time.Hour, fetch, now.Add(59*time.Minute))
+	require.NoError(t, err)
+	requireFlags(projs)
+	require.Equal(t, 1, fetches)
+
+	// a stale cache is used if flags can't be fetched
+	projs, err = cachedProjects(context.Background(), path, configs, baseUri, time.Hour, failingFetch, now.Add(2*time.Hour))
+	require.NoError(t, err)
+	requireFlags(projs)
+	projs, err = cachedProjects(context.Background(), path, configs, baseUri, time.Hour, nil, now.Add(2*time.Hour))
+	require.NoError(t, err)
+	requireFlags(projs)
+
+	// the cache is refreshed when it's stale, or doesn't cover every project
+	_, err = cachedProjects(context.Background(), path, configs, baseUri, time.Hour, fetch, now.Add(2*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 2, fetches)
+	_, err = cachedProjects(context.Background(), path, append(configs, o.ProjectConfig{Key: "payments"}), baseUri, time.Hour, fetch, now.Add(2*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 4, fetches)
+	_, err = cachedProjects(context.Background(), path, configs, "https://app.eu.launchdarkly.com", time.Hour, nil, now.Add(2*time.Hour))
+	require.Error(t, err)
+}
@@ -0,0 +1,93 @@
+package coderefs
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/filetype"
+	"github.com/launchdarkly/ld-find-code-refs/internal/ignore"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	o "github.com/launchdarkly/ld-find-code-refs/internal/options"
+	"github.com/launchdarkly/ld-find-code-refs/internal/validation"
+)
+
+func ignoreOptions() ignore.Options {
+	return ignore.Options{GitIgnore: o.GitIgnore.Value(), GitAttributes: o.GitAttributes.Value()}
+}
+
+func fileTypeOptions() filetype.Options {
+	return filetype.Options{
+		Binary:    o.SkipBinary.Value(),
+		Minified:  o.SkipMinified.Value(),
+		Generated: o.SkipGenerated.Value(),
+		MaxSize:   o.MaxFileSize.Value(),
+	}
+}
+
+// logSkippedFiles summarizes the files containing matches which were skipped because of their type
+func logSkippedFiles(counts map[filetype.Category]int) {
+	total := 0
+	summary := []string{}
+	for _, category := range filetype.Categories {
+		if counts[category] > 0 {
+			total += counts[category]
+			summary = append(summary, fmt.Sprintf("%d %s", counts[category], category))
+		}
+	}
+	if total > 0 {
+		log.Info.Printf("skipped %d files: %s", total, strings.Join(summary, ", "))
+	}
+}
+
+// ExplainIgnore prints whether each path given as a command line argument is excluded from scans of the checkout
+// provided by the dir option, and which rule or file type excluded it.
+func ExplainIgnore() {
+	root, err := validation.NormalizeAndValidatePath(o.Dir.Value())
+	if err != nil {
+		log.Error.Fatalf("could not validate directory option: %s", err)
+	}
+	exclude := regexp.MustCompile(o.Exclude.Value())
+	err = explainIgnore(os.Stdout, root, ignore.NewMatcher(root, ignoreOptions()), fileTypeOptions(), exclude, flag.Args())
+	if err != nil {
+		log.Error.Fatalf("%s", err)
+	}
+}
+
+func explainIgnore(w io.Writer, root string, ignores *ignore.Matcher, skip filetype.Options, exclude *regexp.Regexp, paths []string) error {
+	for _, p := range paths {
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(root, p)
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("%s is not inside %s", p, root)
+		}
+		rel = filepath.ToSlash(rel)
+
+		info, err := os.Stat(p)
+		isDir := err == nil && info.IsDir()
+		match := ignores.Match(rel, isDir)
+		var category filetype.Category
+		if err == nil && !isDir {
+			category, _ = skip.Skip(p)
+		}
+		switch {
+		case match.Ignored:
+			fmt.Fprintf(w, "%s: ignored by %s\n", rel, match.Rule)
+		case exclude.String() != "" && exclude.MatchString(rel):
+			fmt.Fprintf(w, "%s: excluded by the exclude option %q\n", rel, exclude.String())
+		case category != "":
+			fmt.Fprintf(w, "%s: skipped as a %s file\n", rel, category)
+		case match.Rule != nil:
+			fmt.Fprintf(w, "%s: not ignored, re-included by %s\n", rel, match.Rule)
+		default:
+			fmt.Fprintf(w, "%s: not ignored\n", rel)
+		}
+	}
+	return nil
+}
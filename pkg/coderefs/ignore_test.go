@@ -0,0 +1,37 @@
+package coderefs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/filetype"
+	"github.com/launchdarkly/ld-find-code-refs/internal/ignore"
+)
+
+func Test_explainIgnore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ld-explain-ignore")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, ".ldignore"), []byte("*.min.js\n!app.min.js\n"), 0600))
+
+	var out bytes.Buffer
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "app.min.js"), []byte("var a=1;"), 0600))
+	paths := []string{"lib.min.js", filepath.Join(dir, "app.min.js"), "vendor/lib.js", "main.go"}
+	skip := filetype.Options{Minified: true}
+	err = explainIgnore(&out, dir, ignore.NewMatcher(dir, ignore.Options{}), skip, regexp.MustCompile("vendor/"), paths)
+	require.NoError(t, err)
+	require.Equal(t, `lib.min.js: ignored by .ldignore:1: *.min.js
+app.min.js: skipped as a minified file
+vendor/lib.js: excluded by the exclude option "vendor/"
+main.go: not ignored
+`, out.String())
+
+	err = explainIgnore(&out, dir, ignore.NewMatcher(dir, ignore.Options{}), skip, regexp.MustCompile(""), []string{"../outside.go"})
+	require.Error(t, err)
+}
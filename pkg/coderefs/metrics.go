@@ -0,0 +1,84 @@
+package coderefs
+
+import (
+	"strconv"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/metrics"
+)
+
+// writeMetrics writes the metrics of the run to path in the OpenMetrics text format
+func (s *runSummary) writeMetrics(path string) error {
+	s.mu.Lock()
+	families := s.metrics()
+	s.mu.Unlock()
+	return metrics.WriteFile(path, families)
+}
+
+// metrics converts the summary to metric families. The lock must be held.
+func (s *runSummary) metrics() []metrics.Family {
+	gauge := func(name, help string, samples ...metrics.Sample) metrics.Family {
+		return metrics.Family{Name: name, Help: help, Type: metrics.Gauge, Samples: samples}
+	}
+	value := func(v float64) metrics.Sample {
+		return metrics.Sample{Value: v}
+	}
+	boolValue := func(b bool) float64 {
+		if b {
+			return 1
+		}
+		return 0
+	}
+
+	references := gauge("references", "The number of code references to a flag in a repository.")
+	repoReferences := gauge("repository_references", "The number of code references in a repository.")
+	repoFiles := gauge("repository_files", "The number of files with code references in a repository.")
+	repoSuccess := gauge("repository_scan_success", "Whether the batch command scanned a repository successfully.")
+	repoDuration := gauge("repository_scan_duration_seconds", "The duration of the batch command's scan of a repository.")
+	pruned := gauge("stale_branches_pruned", "The number of stale branches marked for code reference pruning in a repository.")
+	for _, r := range s.Repositories {
+		repo := metrics.Labels{"repository": r.Name}
+		for projKey, counts := range r.referencesByFlag {
+			for flagKey, count := range counts {
+				labels := metrics.Labels{"repository": r.Name, "project": projKey, "flag": flagKey}
+				references.Samples = append(references.Samples, metrics.Sample{Labels: labels, Value: float64(count)})
+			}
+		}
+		repoReferences.Samples = append(repoReferences.Samples, metrics.Sample{Labels: repo, Value: float64(r.Hunks)})
+		repoFiles.Samples = append(repoFiles.Samples, metrics.Sample{Labels: repo, Value: float64(r.Files)})
+		pruned.Samples = append(pruned.Samples, metrics.Sample{Labels: repo, Value: float64(r.StaleBranchesPruned)})
+		if r.Success != nil {
+			repoSuccess.Samples = append(repoSuccess.Samples, metrics.Sample{Labels: repo, Value: boolValue(*r.Success)})
+			repoDuration.Samples = append(repoDuration.Samples, metrics.Sample{Labels: repo, Value: r.Duration})
+		}
+	}
+
+	apiErrors := gauge("api_errors", "The number of failed requests to LaunchDarkly, by status code. Requests which received no response have the status error.")
+	errorsByStatus := map[string]int{}
+	for _, r := range s.ApiResponses {
+		switch {
+		case r.Error != "":
+			errorsByStatus["error"]++
+		case r.StatusCode >= 400:
+			errorsByStatus[strconv.Itoa(r.StatusCode)]++
+		}
+	}
+	for status, count := range errorsByStatus {
+		apiErrors.Samples = append(apiErrors.Samples, metrics.Sample{Labels: metrics.Labels{"status": status}, Value: float64(count)})
+	}
+
+	return []metrics.Family{
+		gauge("scan_success", "Whether the run succeeded.", value(boolValue(s.Success))),
+		gauge("scan_duration_seconds", "The duration of the run.", value(s.Duration)),
+		gauge("scan_timestamp_seconds", "The time the run finished, in seconds since the Unix epoch.", value(float64(s.FinishedAt.UnixNano())/1e9)),
+		gauge("flags_searched", "The number of flags searched for.", value(float64(s.Flags.Searched))),
+		gauge("flags_omitted", "The number of flags omitted from the search because their keys are too short.", value(float64(s.Flags.Omitted))),
+		references,
+		repoReferences,
+		repoFiles,
+		repoSuccess,
+		repoDuration,
+		pruned,
+		gauge("api_requests", "The number of requests made to LaunchDarkly, including retries.", value(float64(len(s.ApiResponses)))),
+		apiErrors,
+	}
+}
@@ -0,0 +1,54 @@
+package coderefs
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/metrics"
+)
+
+func Test_runSummaryMetrics(t *testing.T) {
+	run := newRunSummary()
+	run.setFlags(3, 1)
+	projs := projects{newProject("default", nil, []string{testFlagKey, testFlagKey2}), newProject("mobile", nil, []string{testFlagKey})}
+	run.addReferences("web", ld.BranchRep{References: []ld.ReferenceHunksRep{
+		{Path: "a.js", Hunks: []ld.HunkRep{{ProjKey: "default", FlagKey: testFlagKey}, {ProjKey: "mobile", FlagKey: testFlagKey}}},
+		{Path: "b.js", Hunks: []ld.HunkRep{{ProjKey: "default", FlagKey: testFlagKey}, {ProjKey: "default", FlagKey: testFlagKey2}}},
+	}}, projs)
+	run.addPrunedBranches("web", 2)
+	run.setRepositoryResult("api", false, 1500*time.Millisecond)
+	run.addApiResponse(ld.Response{StatusCode: http.StatusOK})
+	run.addApiResponse(ld.Response{StatusCode: http.StatusTooManyRequests})
+	run.addApiResponse(ld.Response{StatusCode: http.StatusTooManyRequests})
+	run.addApiResponse(ld.Response{Error: "connection refused"})
+	run.finish(errors.New("failed to scan 1 of 2 repositories"))
+
+	var b bytes.Buffer
+	require.NoError(t, metrics.Write(&b, run.metrics()))
+	out := b.String()
+	for _, line := range []string{
+		"ld_find_code_refs_scan_success 0\n",
+		"ld_find_code_refs_flags_searched 3\n",
+		"ld_find_code_refs_flags_omitted 1\n",
+		`ld_find_code_refs_references{flag="someFlag",project="default",repository="web"} 2` + "\n",
+		`ld_find_code_refs_references{flag="someFlag",project="mobile",repository="web"} 1` + "\n",
+		`ld_find_code_refs_references{flag="anotherFlag",project="default",repository="web"} 1` + "\n",
+		`ld_find_code_refs_repository_references{repository="web"} 4` + "\n",
+		`ld_find_code_refs_repository_files{repository="web"} 2` + "\n",
+		`ld_find_code_refs_repository_scan_success{repository="api"} 0` + "\n",
+		`ld_find_code_refs_repository_scan_duration_seconds{repository="api"} 1.5` + "\n",
+		`ld_find_code_refs_stale_branches_pruned{repository="web"} 2` + "\n",
+		"ld_find_code_refs_api_requests 4\n",
+		`ld_find_code_refs_api_errors{status="429"} 2` + "\n",
+		`ld_find_code_refs_api_errors{status="error"} 1` + "\n",
+	} {
+		require.Contains(t, out, line)
+	}
+	require.NotContains(t, out, `repository_scan_success{repository="web"}`)
+}
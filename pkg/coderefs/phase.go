@@ -0,0 +1,154 @@
+package coderefs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	o "github.com/launchdarkly/ld-find-code-refs/internal/options"
+)
+
+// phase is a named stage of a scan with its own optional timeout. Errors returned from a phase
+// are reported in terms of the phase, so that users know which step timed out or was interrupted.
+type phase struct {
+	name       string
+	timeout    time.Duration
+	optionName string
+}
+
+func searchPhase() phase {
+	return phase{name: "search", timeout: o.SearchTimeout.Value(), optionName: "searchTimeout"}
+}
+
+func gitPhase(name string) phase {
+	return phase{name: name, timeout: o.GitTimeout.Value(), optionName: "gitTimeout"}
+}
+
+func apiPhase(name string) phase {
+	return phase{name: name, timeout: o.ApiTimeout.Value(), optionName: "apiTimeout"}
+}
+
+// phaseError is an error ending a phase, such as a timeout or interruption, with a code classifying it
+type phaseError struct {
+	code string
+	err  error
+}
+
+func (e phaseError) Error() string {
+	return e.err.Error()
+}
+
+// wrapError prefixes the message of err, keeping the code classifying it
+func wrapError(err error, message string) error {
+	return phaseError{errorCode(err), fmt.Errorf("%s: %s", message, err)}
+}
+
+// errorCode classifies the error ending a run, so that failures can be aggregated by log pipelines. The phase
+// which failed is recorded separately.
+func errorCode(err error) string {
+	if pe, ok := err.(phaseError); ok {
+		return pe.code
+	}
+	switch err {
+	case ld.UnauthorizedErr:
+		return "unauthorized"
+	case ld.RateLimitExceededErr:
+		return "rate_limited"
+	case ld.RepositoryDisabledErr:
+		return "repository_disabled"
+	}
+	return "scan_error"
+}
+
+type logFieldsKey struct{}
+
+// withLogFields enables setting log fields describing the scan, such as the current phase. Fields are global, so
+// they are only set when a single checkout is scanned at a time.
+func withLogFields(ctx context.Context) context.Context {
+	return context.WithValue(ctx, logFieldsKey{}, true)
+}
+
+func setLogField(ctx context.Context, key string, value interface{}) {
+	if ctx.Value(logFieldsKey{}) != nil {
+		log.SetField(key, value)
+	}
+}
+
+func clearLogField(ctx context.Context, key string) {
+	if ctx.Value(logFieldsKey{}) != nil {
+		log.DeleteField(key)
+	}
+}
+
+func (p phase) context(parent context.Context) (context.Context, context.CancelFunc) {
+	setLogField(parent, "phase", p.name)
+	log.Debug.Printf("starting %s phase", p.name)
+	if p.timeout > 0 {
+		return context.WithTimeout(parent, p.timeout)
+	}
+	return context.WithCancel(parent)
+}
+
+// run executes fn with a context bound to the phase timeout, and translates context errors into a
+// message naming the phase.
+func (p phase) run(parent context.Context, fn func(ctx context.Context) error) error {
+	ctx, cancel := p.context(parent)
+	defer cancel()
+	start := time.Now()
+	err := fn(ctx)
+	duration := time.Since(start)
+	log.With(log.Fields{"duration": duration.Seconds()}).Debugf("finished %s phase in %s", p.name, duration)
+	if err == nil {
+		clearLogField(parent, "phase")
+		currentRun.addPhase(p.name, duration, nil)
+		return nil
+	}
+	err = p.contextError(parent, ctx, err)
+	currentRun.addPhase(p.name, duration, err)
+	return err
+}
+
+func (p phase) contextError(parent, ctx context.Context, err error) error {
+	switch {
+	case parent.Err() == context.DeadlineExceeded:
+		return phaseError{"timeout", fmt.Errorf("timed out during %s phase: overall timeout exceeded (see the timeout option)", p.name)}
+	case parent.Err() == context.Canceled:
+		return phaseError{"interrupted", fmt.Errorf("interrupted during %s phase", p.name)}
+	case ctx.Err() == context.DeadlineExceeded:
+		return phaseError{"timeout", fmt.Errorf("timed out during %s phase: %s phase timeout of %s exceeded (see the %s option)", p.name, p.name, p.timeout, p.optionName)}
+	}
+	return err
+}
+
+// scanContext returns a context that is cancelled when the overall timeout elapses, or when the
+// process receives SIGINT or SIGTERM. Cancelling the context kills any running child processes.
+func scanContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-signals:
+			log.Warning.Printf("received %s, stopping scan", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
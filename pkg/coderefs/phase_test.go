@@ -0,0 +1,61 @@
+package coderefs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+)
+
+func Test_phaseRun(t *testing.T) {
+	otherErr := errors.New("some other error")
+	waitForDone := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	t.Run("succeeds", func(t *testing.T) {
+		err := phase{name: "search", timeout: time.Second}.run(context.Background(), func(ctx context.Context) error {
+			return nil
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("returns unrelated errors as is", func(t *testing.T) {
+		err := phase{name: "search"}.run(context.Background(), func(ctx context.Context) error {
+			return otherErr
+		})
+		require.Equal(t, otherErr, err)
+	})
+
+	t.Run("reports phase timeout", func(t *testing.T) {
+		err := phase{name: "search", timeout: time.Millisecond, optionName: "searchTimeout"}.run(context.Background(), waitForDone)
+		require.EqualError(t, err, "timed out during search phase: search phase timeout of 1ms exceeded (see the searchTimeout option)")
+	})
+
+	t.Run("reports overall timeout", func(t *testing.T) {
+		parent, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+		err := phase{name: "upload", timeout: time.Minute, optionName: "apiTimeout"}.run(parent, waitForDone)
+		require.EqualError(t, err, "timed out during upload phase: overall timeout exceeded (see the timeout option)")
+	})
+
+	t.Run("reports interruption", func(t *testing.T) {
+		parent, cancel := context.WithCancel(context.Background())
+		cancel()
+		err := phase{name: "git"}.run(parent, waitForDone)
+		require.EqualError(t, err, "interrupted during git phase")
+		require.Equal(t, "interrupted", errorCode(wrapError(err, "error searching for flag key references")))
+	})
+}
+
+func Test_errorCode(t *testing.T) {
+	require.Equal(t, "timeout", errorCode(phaseError{"timeout", errors.New("timed out")}))
+	require.Equal(t, "unauthorized", errorCode(wrapError(ld.UnauthorizedErr, "could not retrieve flag keys from LaunchDarkly")))
+	require.Equal(t, "rate_limited", errorCode(ld.RateLimitExceededErr))
+	require.Equal(t, "scan_error", errorCode(errors.New("exclude must be a valid regular expression")))
+}
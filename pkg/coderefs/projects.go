@@ -0,0 +1,174 @@
+package coderefs
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/glob"
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	o "github.com/launchdarkly/ld-find-code-refs/internal/options"
+)
+
+// project is a LaunchDarkly project whose flags are searched for. A reference is attributed to a project when
+// the project's flag list contains the referenced key, and the referencing file matches one of the project's
+// path patterns. Projects without path patterns apply to the whole repository.
+type project struct {
+	key   string
+	paths []string
+	flags map[string]bool
+	// details describes each flag, including archived flags. They are only fetched for reports which need them, such
+	// as the pull request summary.
+	details map[string]ld.Flag
+}
+
+type projects []project
+
+func newProject(key string, paths []string, flags []string) project {
+	p := project{key: key, paths: paths, flags: make(map[string]bool, len(flags))}
+	for _, flag := range flags {
+		p.flags[flag] = true
+	}
+	return p
+}
+
+// newProjectWithDetails returns a project searching for all of the given flags, including archived flags
+func newProjectWithDetails(key string, paths []string, flags []ld.Flag) project {
+	keys := make([]string, 0, len(flags))
+	for _, flag := range flags {
+		keys = append(keys, flag.Key)
+	}
+	p := newProject(key, paths, keys)
+	p.details = make(map[string]ld.Flag, len(flags))
+	for _, flag := range flags {
+		p.details[flag.Key] = flag
+	}
+	return p
+}
+
+// flag returns the details of a flag, or only its key if details weren't fetched
+func (p project) flag(key string) ld.Flag {
+	if flag, ok := p.details[key]; ok {
+		return flag
+	}
+	return ld.Flag{Key: key}
+}
+
+func (p project) contains(path, flag string) bool {
+	if !p.flags[flag] {
+		return false
+	}
+	return len(p.paths) == 0 || glob.MatchAny(p.paths, path)
+}
+
+// keysFor returns the keys of all projects a reference to flag in path should be attributed to
+func (p projects) keysFor(path, flag string) []string {
+	keys := []string{}
+	for _, proj := range p {
+		if proj.contains(path, flag) {
+			keys = append(keys, proj.key)
+		}
+	}
+	return keys
+}
+
+// isAttributed reports whether any flag referenced in the file belongs to a project covering the file
+func (fsr fileSearchResults) isAttributed(projs projects) bool {
+	for flagKey := range fsr.flagReferenceMap {
+		if len(projs.keysFor(fsr.path, flagKey)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// flagKeys returns the union of flag keys across all projects, so that the repository only needs to be searched once
+func (p projects) flagKeys() []string {
+	keys := []string{}
+	seen := map[string]bool{}
+	for _, proj := range p {
+		for flag := range proj.flags {
+			if !seen[flag] {
+				seen[flag] = true
+				keys = append(keys, flag)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// flagDetailsRequired reports whether the details of each flag are fetched, for reports on references to archived,
+// deprecated and temporary flags
+func flagDetailsRequired() bool {
+	return (o.BaseBranch.Value() != "" && prSummaryEnabled()) || o.Annotations.Value()
+}
+
+// flag returns the details of a flag in the project with the given key
+func (p projects) flag(projKey, key string) ld.Flag {
+	for _, proj := range p {
+		if proj.key == projKey {
+			return proj.flag(key)
+		}
+	}
+	return ld.Flag{Key: key}
+}
+
+// withoutArchivedFlags returns the references without hunks for archived flags, and without files left with no
+// hunks. Archived flags are only searched for to report on references to them, and their references aren't sent to
+// LaunchDarkly.
+func (p projects) withoutArchivedFlags(refs []ld.ReferenceHunksRep) []ld.ReferenceHunksRep {
+	ret := make([]ld.ReferenceHunksRep, 0, len(refs))
+	for _, ref := range refs {
+		hunks := make([]ld.HunkRep, 0, len(ref.Hunks))
+		for _, hunk := range ref.Hunks {
+			if !p.flag(hunk.ProjKey, hunk.FlagKey).Archived {
+				hunks = append(hunks, hunk)
+			}
+		}
+		if len(hunks) > 0 {
+			ref.Hunks = hunks
+			ret = append(ret, ref)
+		}
+	}
+	return ret
+}
+
+// getProjects fetches the flag list for each configured project. If withDetails is set, the details of each flag are
+// fetched as well, and archived flags are also searched for.
+func getProjects(ctx context.Context, ldApi ld.ApiClient, configs []o.ProjectConfig, withDetails bool) (projects, error) {
+	ret := make(projects, 0, len(configs))
+	for _, c := range configs {
+		var proj project
+		if withDetails {
+			flags, err := ldApi.GetFlags(ctx, c.Key)
+			if err != nil {
+				return nil, err
+			}
+			proj = newProjectWithDetails(c.Key, c.Paths, flags)
+		} else {
+			flags, err := getFlags(ctx, ldApi, c.Key)
+			if err != nil {
+				return nil, err
+			}
+			proj = newProject(c.Key, c.Paths, flags)
+		}
+		if len(proj.flags) == 0 {
+			log.Info.Printf("no flag keys found for project: %s", c.Key)
+		}
+		if len(c.Paths) > 0 {
+			log.Info.Printf("attributing references to project %s only in paths: %s", c.Key, strings.Join(c.Paths, ", "))
+		}
+		ret = append(ret, proj)
+	}
+	return ret, nil
+}
+
+func (p projects) String() string {
+	keys := make([]string, 0, len(p))
+	for _, proj := range p {
+		keys = append(keys, proj.key)
+	}
+	return strings.Join(keys, ", ")
+}
@@ -0,0 +1,100 @@
+package coderefs
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+)
+
+func Test_projectsKeysFor(t *testing.T) {
+	projs := projects{
+		newProject("web", []string{"frontend/**"}, []string{"shared-flag", "web-flag"}),
+		newProject("payments", []string{"services/payments/**"}, []string{"shared-flag", "payments-flag"}),
+		newProject("platform", nil, []string{"shared-flag"}),
+	}
+
+	specs := []struct {
+		name     string
+		path     string
+		flag     string
+		expected []string
+	}{
+		{"attributes to project in scope", "frontend/app.js", "web-flag", []string{"web"}},
+		{"does not attribute outside of project paths", "services/payments/main.go", "web-flag", []string{}},
+		{"attributes shared keys to every project in scope", "services/payments/main.go", "shared-flag", []string{"payments", "platform"}},
+		{"unscoped projects apply everywhere", "README.md", "shared-flag", []string{"platform"}},
+		{"unknown flags are not attributed", "frontend/app.js", "unknown-flag", []string{}},
+	}
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, projs.keysFor(tt.path, tt.flag))
+		})
+	}
+
+	require.Equal(t, []string{"payments-flag", "shared-flag", "web-flag"}, projs.flagKeys())
+}
+
+func Test_makeHunkRepsWithMultipleProjects(t *testing.T) {
+	projs := projects{
+		newProject("proj-a", nil, []string{"flag-1", "flag-2"}),
+		newProject("proj-b", nil, []string{"flag-2"}),
+		newProject("proj-c", []string{"other/**"}, []string{"flag-1"}),
+	}
+	refs := searchResultLines{
+		{Path: "a/b", LineNum: 1, LineText: "flag-1", FlagKeys: []string{"flag-1"}},
+		{Path: "a/b", LineNum: 2, LineText: "flag-2", FlagKeys: []string{"flag-2"}},
+	}
+
+	got := refs.aggregateByPath()[0].makeHunkReps(projs, uniformContext(0))
+	sort.Slice(got, func(i, j int) bool {
+		if got[i].ProjKey != got[j].ProjKey {
+			return got[i].ProjKey < got[j].ProjKey
+		}
+		return got[i].StartingLineNumber < got[j].StartingLineNumber
+	})
+
+	require.Equal(t, []ld.HunkRep{
+		{StartingLineNumber: 1, Lines: "flag-1\n", ProjKey: "proj-a", FlagKey: "flag-1"},
+		{StartingLineNumber: 2, Lines: "flag-2\n", ProjKey: "proj-a", FlagKey: "flag-2"},
+		{StartingLineNumber: 2, Lines: "flag-2\n", ProjKey: "proj-b", FlagKey: "flag-2"},
+	}, got)
+}
+
+func Test_makeReferenceHunksRepsSkipsUnattributedFiles(t *testing.T) {
+	projs := projects{newProject("proj-a", []string{"services/**"}, []string{"flag-1"})}
+	refs := searchResultLines{
+		{Path: "docs/flags.md", LineNum: 1, LineText: "flag-1", FlagKeys: []string{"flag-1"}},
+		{Path: "services/a.go", LineNum: 1, LineText: "flag-1", FlagKeys: []string{"flag-1"}},
+	}
+
+	got := refs.makeReferenceHunksReps(projs, uniformContext(0))
+	require.Equal(t, []ld.ReferenceHunksRep{
+		{Path: "services/a.go", Hunks: []ld.HunkRep{{StartingLineNumber: 1, Lines: "flag-1\n", ProjKey: "proj-a", FlagKey: "flag-1", Language: "go"}}},
+	}, got)
+}
+
+func Test_projectsWithoutArchivedFlags(t *testing.T) {
+	projs := projects{
+		newProjectWithDetails("web", nil, []ld.Flag{{Key: "active-flag"}, {Key: "old-flag", Archived: true}}),
+		newProjectWithDetails("payments", nil, []ld.Flag{{Key: "old-flag"}}),
+	}
+	refs := []ld.ReferenceHunksRep{
+		{Path: "app.js", Hunks: []ld.HunkRep{
+			{StartingLineNumber: 1, ProjKey: "web", FlagKey: "active-flag"},
+			{StartingLineNumber: 5, ProjKey: "web", FlagKey: "old-flag"},
+			{StartingLineNumber: 5, ProjKey: "payments", FlagKey: "old-flag"},
+		}},
+		{Path: "legacy.js", Hunks: []ld.HunkRep{{StartingLineNumber: 1, ProjKey: "web", FlagKey: "old-flag"}}},
+	}
+
+	require.Equal(t, []ld.ReferenceHunksRep{
+		{Path: "app.js", Hunks: []ld.HunkRep{
+			{StartingLineNumber: 1, ProjKey: "web", FlagKey: "active-flag"},
+			{StartingLineNumber: 5, ProjKey: "payments", FlagKey: "old-flag"},
+		}},
+	}, projs.withoutArchivedFlags(refs))
+	require.Len(t, refs[0].Hunks, 3, "references are not modified")
+}
@@ -0,0 +1,213 @@
+package coderefs
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	o "github.com/launchdarkly/ld-find-code-refs/internal/options"
+	"github.com/launchdarkly/ld-find-code-refs/internal/prcomment"
+)
+
+// prSummaryEnabled reports whether a summary of changes in flag references is written or posted for pull request
+// builds
+func prSummaryEnabled() bool {
+	return o.PrSummaryFile.Value() != "" || (o.PrCommentUrl.Value() != "" && o.PrCommentToken.Value() != "")
+}
+
+// flagChange compares the references to a flag on the branch being scanned with those recorded for the base branch
+type flagChange struct {
+	projKey string
+	flag    ld.Flag
+	base    int
+	head    int
+	// location is the first reference on the branch being scanned, as path:line
+	location string
+}
+
+// repositoryChanges lists the flags referenced by a repository on either branch
+type repositoryChanges struct {
+	name string
+	// baseRecorded is false if references haven't been recorded for the base branch, in which case flags that were
+	// added or removed can't be listed
+	baseRecorded bool
+	changes      []flagChange
+}
+
+// prSummary describes changes in flag references in a pull request, compared with the references recorded in
+// LaunchDarkly for the branch it will be merged into
+type prSummary struct {
+	baseBranch   string
+	repositories []repositoryChanges
+}
+
+// addRepository compares the references found in a repository with those recorded for the base branch
+func (s *prSummary) addRepository(ctx context.Context, ldApi ld.ApiClient, repoName string, head ld.BranchRep, projs projects) error {
+	var base *ld.BranchRep
+	err := apiPhase("base branch fetch").run(ctx, func(ctx context.Context) (err error) {
+		base, err = ldApi.GetCodeReferenceBranch(ctx, repoName, s.baseBranch)
+		return err
+	})
+	repo := repositoryChanges{name: repoName, baseRecorded: true}
+	if err == ld.NotFoundErr {
+		log.Warning.Printf("code references have not been recorded for base branch %s of repository %s", s.baseBranch, repoName)
+		repo.baseRecorded = false
+		base = &ld.BranchRep{}
+	} else if err != nil {
+		return wrapError(err, fmt.Sprintf("could not retrieve code references for base branch %s", s.baseBranch))
+	}
+	repo.changes = compareReferences(*base, head, projs)
+	s.repositories = append(s.repositories, repo)
+	return nil
+}
+
+// compareReferences counts the references to each flag on the base and head branches
+func compareReferences(base, head ld.BranchRep, projs projects) []flagChange {
+	ret := []flagChange{}
+	for _, p := range projs {
+		baseCounts := base.ForProject(p.key).ReferenceCountByFlag()
+		headRep := head.ForProject(p.key)
+		headCounts := headRep.ReferenceCountByFlag()
+		locations := firstReferences(headRep)
+
+		keys := []string{}
+		for key := range headCounts {
+			keys = append(keys, key)
+		}
+		for key := range baseCounts {
+			// flags that are no longer in the project weren't searched for
+			if headCounts[key] == 0 && p.flags[key] {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			ret = append(ret, flagChange{
+				projKey:  p.key,
+				flag:     p.flag(key),
+				base:     baseCounts[key],
+				head:     headCounts[key],
+				location: locations[key],
+			})
+		}
+	}
+	return ret
+}
+
+// firstReferences returns the location of the first reference to each flag in a branch
+func firstReferences(b ld.BranchRep) map[string]string {
+	ret := map[string]string{}
+	for _, ref := range b.References {
+		for _, hunk := range ref.Hunks {
+			if _, ok := ret[hunk.FlagKey]; !ok {
+				ret[hunk.FlagKey] = fmt.Sprintf("%s:%d", ref.Path, referenceLine(hunk))
+			}
+		}
+	}
+	return ret
+}
+
+// markdown formats the summary for a pull request comment
+func (s prSummary) markdown() string {
+	var b strings.Builder
+	b.WriteString(prcomment.Marker + "\n")
+	b.WriteString("## LaunchDarkly flag references\n\n")
+	for _, repo := range s.repositories {
+		if len(s.repositories) > 1 {
+			fmt.Fprintf(&b, "### %s\n\n", repo.name)
+		}
+		repo.writeMarkdown(&b, s.baseBranch)
+	}
+	return b.String()
+}
+
+func (r repositoryChanges) writeMarkdown(b *strings.Builder, baseBranch string) {
+	var added, removed, archived, temporary []flagChange
+	for _, c := range r.changes {
+		switch {
+		// references to archived flags aren't recorded for branches scanned without the pull request summary, so
+		// they are only compared with other flags
+		case c.flag.Archived:
+			if c.head > 0 {
+				archived = append(archived, c)
+			}
+		case c.base == 0 && c.head > 0 && r.baseRecorded:
+			added = append(added, c)
+		case c.base > 0 && c.head == 0:
+			removed = append(removed, c)
+		}
+		if c.flag.Temporary && !c.flag.Archived && c.head > c.base {
+			temporary = append(temporary, c)
+		}
+	}
+
+	if r.baseRecorded {
+		fmt.Fprintf(b, "Compared with the references recorded for `%s`.\n\n", baseBranch)
+	} else {
+		fmt.Fprintf(b, "References have not been recorded for `%s`, so flags that were added or removed can't be listed.\n\n", baseBranch)
+	}
+	if len(added)+len(removed)+len(archived)+len(temporary) == 0 {
+		b.WriteString("No changes to flag references.\n\n")
+		return
+	}
+	writeChangeTable(b, "New flags referenced", "References", added, func(c flagChange) int { return c.head })
+	writeChangeTable(b, "Flags no longer referenced", "References removed", removed, func(c flagChange) int { return c.base })
+	writeChangeTable(b, "Archived flags referenced", "References", archived, func(c flagChange) int { return c.head })
+	writeChangeTable(b, "Temporary flags with new references", "References added", temporary, func(c flagChange) int { return c.head - c.base })
+}
+
+func writeChangeTable(b *strings.Builder, title, countHeader string, changes []flagChange, count func(flagChange) int) {
+	if len(changes) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "#### %s\n\n", title)
+	fmt.Fprintf(b, "| Flag | Project | %s | First reference |\n", countHeader)
+	b.WriteString("| --- | --- | --: | --- |\n")
+	for _, c := range changes {
+		location := "-"
+		if c.location != "" {
+			location = "`" + strings.Replace(c.location, "|", `\|`, -1) + "`"
+		}
+		fmt.Fprintf(b, "| `%s` | `%s` | %d | %s |\n", c.flag.Key, c.projKey, count(c), location)
+	}
+	b.WriteString("\n")
+}
+
+// report writes the summary to the path provided by the prSummaryFile option, and posts it to the pull request if the
+// prCommentUrl and prCommentToken options are provided. Failing to post the comment doesn't fail the scan.
+func (s prSummary) report(ctx context.Context) error {
+	body := s.markdown()
+	if path := o.PrSummaryFile.Value(); path != "" {
+		err := ioutil.WriteFile(path, []byte(body), 0644)
+		if err != nil {
+			return fmt.Errorf("could not write pull request summary: %s", err)
+		}
+		log.Info.Printf("wrote pull request summary to %s", path)
+	}
+
+	commentUrl := o.PrCommentUrl.Value()
+	if commentUrl == "" || o.PrCommentToken.Value() == "" {
+		return nil
+	}
+	httpClient, err := ld.NewHTTPClient(transportOptions())
+	if err != nil {
+		return fmt.Errorf("could not configure pull request comment client: %s", err)
+	}
+	client, err := prcomment.NewClient(commentUrl, o.PrCommentToken.Value(), httpClient)
+	if err != nil {
+		return err
+	}
+	err = apiPhase("pull request comment").run(ctx, func(ctx context.Context) error {
+		return client.Post(ctx, body)
+	})
+	if err != nil {
+		log.Warning.Printf("could not post pull request summary to %s: %s", commentUrl, err)
+		return nil
+	}
+	log.Info.Printf("posted pull request summary to %s", commentUrl)
+	return nil
+}
@@ -0,0 +1,93 @@
+package coderefs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+)
+
+func branchWithHunks(hunks ...ld.HunkRep) ld.BranchRep {
+	refs := []ld.ReferenceHunksRep{}
+	for _, hunk := range hunks {
+		refs = append(refs, ld.ReferenceHunksRep{Path: "app.js", Hunks: []ld.HunkRep{hunk}})
+	}
+	return ld.BranchRep{References: refs}
+}
+
+func Test_compareReferences(t *testing.T) {
+	projs := projects{newProjectWithDetails("default", nil, []ld.Flag{
+		{Key: "kept-flag"},
+		{Key: "new-flag", Temporary: true},
+		{Key: "removed-flag"},
+		{Key: "old-flag", Archived: true},
+	})}
+	base := branchWithHunks(
+		ld.HunkRep{ProjKey: "default", FlagKey: "kept-flag", StartingLineNumber: 1},
+		ld.HunkRep{ProjKey: "default", FlagKey: "removed-flag", StartingLineNumber: 3},
+		ld.HunkRep{ProjKey: "default", FlagKey: "deleted-flag", StartingLineNumber: 5},
+	)
+	head := branchWithHunks(
+		ld.HunkRep{ProjKey: "default", FlagKey: "kept-flag", StartingLineNumber: 1},
+		ld.HunkRep{ProjKey: "default", FlagKey: "new-flag", StartingLineNumber: 10, Lines: "// context\nif (variation('new-flag')) {"},
+		ld.HunkRep{ProjKey: "default", FlagKey: "old-flag", StartingLineNumber: 20},
+	)
+
+	changes := compareReferences(base, head, projs)
+	require.Equal(t, []flagChange{
+		{projKey: "default", flag: ld.Flag{Key: "kept-flag"}, base: 1, head: 1, location: "app.js:1"},
+		{projKey: "default", flag: ld.Flag{Key: "new-flag", Temporary: true}, head: 1, location: "app.js:11"},
+		{projKey: "default", flag: ld.Flag{Key: "old-flag", Archived: true}, head: 1, location: "app.js:20"},
+		{projKey: "default", flag: ld.Flag{Key: "removed-flag"}, base: 1},
+	}, changes)
+
+	summary := prSummary{baseBranch: "main", repositories: []repositoryChanges{{name: "repo", baseRecorded: true, changes: changes}}}
+	require.Equal(t, `<!-- ld-find-code-refs -->
+## LaunchDarkly flag references
+
+Compared with the references recorded for `+"`main`"+`.
+
+#### New flags referenced
+
+| Flag | Project | References | First reference |
+| --- | --- | --: | --- |
+| `+"`new-flag` | `default` | 1 | `app.js:11`"+` |
+
+#### Flags no longer referenced
+
+| Flag | Project | References removed | First reference |
+| --- | --- | --: | --- |
+| `+"`removed-flag` | `default` | 1 | -"+` |
+
+#### Archived flags referenced
+
+| Flag | Project | References | First reference |
+| --- | --- | --: | --- |
+| `+"`old-flag` | `default` | 1 | `app.js:20`"+` |
+
+#### Temporary flags with new references
+
+| Flag | Project | References added | First reference |
+| --- | --- | --: | --- |
+| `+"`new-flag` | `default` | 1 | `app.js:11`"+` |
+
+`, summary.markdown())
+}
+
+func Test_prSummaryWithoutBaseReferences(t *testing.T) {
+	projs := projects{newProject("default", nil, []string{"flag"})}
+	head := branchWithHunks(ld.HunkRep{ProjKey: "default", FlagKey: "flag", StartingLineNumber: 1})
+
+	summary := prSummary{baseBranch: "main", repositories: []repositoryChanges{
+		{name: "repo", changes: compareReferences(ld.BranchRep{}, head, projs)},
+	}}
+	require.Equal(t, `<!-- ld-find-code-refs -->
+## LaunchDarkly flag references
+
+References have not been recorded for `+"`main`"+`, so flags that were added or removed can't be listed.
+
+No changes to flag references.
+
+`, summary.markdown())
+}
@@ -0,0 +1,270 @@
+package coderefs
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/branchlist"
+	"github.com/launchdarkly/ld-find-code-refs/internal/command"
+	"github.com/launchdarkly/ld-find-code-refs/internal/glob"
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	o "github.com/launchdarkly/ld-find-code-refs/internal/options"
+)
+
+// prunePolicy decides which branches missing from the git remote have their code references pruned from LaunchDarkly.
+// Branches matching a protected pattern, and branches synced within minAge, are kept. Tags are pruned when they're
+// older than the keepTags most recent tags. If more than maxBranches branches are stale, no branches are pruned, and
+// likewise for tags.
+type prunePolicy struct {
+	protected   []string
+	minAge      time.Duration
+	maxBranches int
+	keepTags    int
+	dryRun      bool
+}
+
+// prunePolicyFromFlags returns the policy configured by the prune options. The default branch is always protected.
+func prunePolicyFromFlags(defaultBranch string) prunePolicy {
+	protected := o.PruneProtectedBranches()
+	if defaultBranch != "" {
+		protected = append(protected, defaultBranch)
+	}
+	return prunePolicy{
+		protected:   protected,
+		minAge:      o.PruneMinAge.Value(),
+		maxBranches: o.PruneMaxBranches.Value(),
+		keepTags:    o.PruneKeepTags.Value(),
+		dryRun:      o.PruneDryRun.Value(),
+	}
+}
+
+// listBranches lists the branches which exist, from the source selected by the branchSource option. The current
+// branch is always included.
+func listBranches(ctx context.Context, gitClient command.GitClient) (map[string]bool, error) {
+	var branches map[string]bool
+	var err error
+	switch o.BranchSource.Value() {
+	case o.BranchSourceLocal:
+		err = gitPhase("git branches").run(ctx, func(ctx context.Context) (err error) {
+			branches, err = gitClient.TrackingBranches(ctx)
+			return err
+		})
+	case o.BranchSourceFile:
+		branches, err = branchlist.ReadFile(o.BranchFile.Value())
+	case o.BranchSourceApi:
+		var httpClient *http.Client
+		httpClient, err = ld.NewHTTPClient(transportOptions())
+		if err != nil {
+			return nil, fmt.Errorf("could not configure branch API client: %s", err)
+		}
+		var client *branchlist.ApiClient
+		client, err = branchlist.NewApiClient(o.BranchApiUrl.Value(), o.BranchApiToken.Value(), httpClient)
+		if err != nil {
+			return nil, err
+		}
+		err = apiPhase("branch list").run(ctx, func(ctx context.Context) (err error) {
+			branches, err = client.Branches(ctx)
+			return err
+		})
+	default:
+		err = gitPhase("git remote").run(ctx, func(ctx context.Context) (err error) {
+			branches, err = gitClient.RemoteBranches(ctx)
+			return err
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	branches[gitClient.GitBranch] = true
+	return branches, nil
+}
+
+// branchDecision records whether a branch is pruned, and why
+type branchDecision struct {
+	name   string
+	prune  bool
+	reason string
+}
+
+func deleteStaleBranches(ctx context.Context, ldApi ld.ApiClient, repoName string, remoteBranches map[string]bool, policy prunePolicy) error {
+	branches, err := ldApi.GetCodeReferenceRepositoryBranches(ctx, repoName)
+	if err != nil {
+		return err
+	}
+
+	decisions := calculateStaleBranches(branches, remoteBranches, policy, time.Now())
+	staleBranches := prunedBranchNames(decisions)
+	for _, d := range decisions {
+		switch {
+		case policy.dryRun:
+			verb := "keep"
+			if d.prune {
+				verb = "prune"
+			}
+			log.Info.Printf("prune dry run: would %s branch %s: %s", verb, d.name, d.reason)
+		case d.prune:
+			log.Debug.Printf("marking branch %s for code reference pruning: %s", d.name, d.reason)
+		default:
+			log.Debug.Printf("keeping branch %s: %s", d.name, d.reason)
+		}
+	}
+
+	if len(staleBranches) == 0 || policy.dryRun {
+		return nil
+	}
+
+	err = ldApi.PostDeleteBranchesTask(ctx, repoName, staleBranches)
+	if err != nil {
+		return err
+	}
+	currentRun.addPrunedBranches(repoName, len(staleBranches))
+	return nil
+}
+
+// calculateStaleBranches decides whether each branch with code references in LaunchDarkly is pruned. Only branches
+// missing from the remote, and tags older than the most recent tags kept, are pruned, unless the policy protects them.
+// The maxBranches limit applies to branches and tags separately.
+func calculateStaleBranches(branches []ld.BranchRep, remoteBranches map[string]bool, policy prunePolicy, now time.Time) []branchDecision {
+	decisions := make([]branchDecision, 0, len(branches))
+	recentTags := policy.recentTags(branches)
+	var staleBranches, staleTags []int
+	for _, branch := range branches {
+		d := branchDecision{name: branch.Name}
+		syncedAgo := now.Sub(time.Unix(0, branch.SyncTime*int64(time.Millisecond)))
+		tag := strings.TrimPrefix(branch.Name, command.TagRefPrefix)
+		isTag := tag != branch.Name
+		pattern := policy.protectedBy(tag)
+		switch {
+		case isTag && remoteBranches[branch.Name]:
+			d.reason = "is the tag being scanned"
+		case remoteBranches[branch.Name]:
+			d.reason = "exists on the remote"
+		case isTag && policy.keepTags == 0:
+			d.reason = "tags are only pruned when pruneKeepTags is set"
+		case isTag && recentTags[branch.Name]:
+			d.reason = fmt.Sprintf("one of the %d most recent tags", policy.keepTags)
+		case pattern != "":
+			d.reason = fmt.Sprintf("protected by the pattern %s", pattern)
+		case policy.minAge > 0 && syncedAgo < policy.minAge:
+			d.reason = fmt.Sprintf("synced %s ago, more recently than the minimum age of %s", syncedAgo.Round(time.Second), policy.minAge)
+		case isTag:
+			d.prune = true
+			d.reason = fmt.Sprintf("older than the %d most recent tags", policy.keepTags)
+			staleTags = append(staleTags, len(decisions))
+		default:
+			d.prune = true
+			d.reason = "not found on the remote"
+			staleBranches = append(staleBranches, len(decisions))
+		}
+		decisions = append(decisions, d)
+	}
+
+	stale := 0
+	for _, group := range []struct {
+		kind    string
+		indexes []int
+	}{{"branches", staleBranches}, {"tags", staleTags}} {
+		if policy.maxBranches > 0 && len(group.indexes) > policy.maxBranches {
+			log.Warning.Printf("found %d stale %s, which exceeds the pruneMaxBranches limit of %d, skipping code reference pruning of %s. "+
+				"Check that the git remote lists all branches, or raise the limit", len(group.indexes), group.kind, policy.maxBranches, group.kind)
+			for _, i := range group.indexes {
+				decisions[i].prune = false
+				decisions[i].reason = fmt.Sprintf("one of %d stale %s, more than the pruneMaxBranches limit of %d", len(group.indexes), group.kind, policy.maxBranches)
+			}
+			continue
+		}
+		stale += len(group.indexes)
+	}
+	log.Info.Printf("found %d stale branches to be marked for code reference pruning", stale)
+	return decisions
+}
+
+// recentTags returns the refs of the keepTags most recent tags, ordered by version
+func (p prunePolicy) recentTags(branches []ld.BranchRep) map[string]bool {
+	tags := []ld.BranchRep{}
+	for _, b := range branches {
+		if strings.HasPrefix(b.Name, command.TagRefPrefix) {
+			tags = append(tags, b)
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		c := compareVersions(strings.TrimPrefix(tags[i].Name, command.TagRefPrefix), strings.TrimPrefix(tags[j].Name, command.TagRefPrefix))
+		if c == 0 {
+			return tags[i].SyncTime > tags[j].SyncTime
+		}
+		return c > 0
+	})
+	recent := map[string]bool{}
+	for i := 0; i < len(tags) && i < p.keepTags; i++ {
+		recent[tags[i].Name] = true
+	}
+	return recent
+}
+
+var versionRegex = regexp.MustCompile(`^\D*((?:\d+\.)*\d+)(?:-(.*))?`)
+
+// compareVersions orders tags named like `v2.3.0` or `2.3.0-rc.1` by their numeric components. A release is more
+// recent than its pre-releases. Tags which aren't versions are ordered before all versions, by name.
+func compareVersions(a, b string) int {
+	ma, mb := versionRegex.FindStringSubmatch(a), versionRegex.FindStringSubmatch(b)
+	switch {
+	case ma == nil && mb == nil:
+		return strings.Compare(a, b)
+	case ma == nil:
+		return -1
+	case mb == nil:
+		return 1
+	}
+	na, nb := strings.Split(ma[1], "."), strings.Split(mb[1], ".")
+	for i := 0; i < len(na) || i < len(nb); i++ {
+		var x, y int
+		if i < len(na) {
+			x, _ = strconv.Atoi(na[i])
+		}
+		if i < len(nb) {
+			y, _ = strconv.Atoi(nb[i])
+		}
+		if x != y {
+			if x > y {
+				return 1
+			}
+			return -1
+		}
+	}
+	switch {
+	case ma[2] == mb[2]:
+		return 0
+	case ma[2] == "":
+		return 1
+	case mb[2] == "":
+		return -1
+	}
+	return strings.Compare(ma[2], mb[2])
+}
+
+// protectedBy returns the first protected pattern matching the branch, or an empty string if it isn't protected
+func (p prunePolicy) protectedBy(branch string) string {
+	for _, pattern := range p.protected {
+		if glob.Match(pattern, branch) {
+			return pattern
+		}
+	}
+	return ""
+}
+
+func prunedBranchNames(decisions []branchDecision) []string {
+	names := []string{}
+	for _, d := range decisions {
+		if d.prune {
+			names = append(names, d.name)
+		}
+	}
+	return names
+}
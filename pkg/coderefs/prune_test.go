@@ -0,0 +1,92 @@
+package coderefs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+)
+
+func Test_calculateStaleBranchesWithPolicy(t *testing.T) {
+	now := time.Date(2021, 3, 4, 12, 0, 0, 0, time.UTC)
+	syncedAgo := func(d time.Duration) int64 {
+		return now.Add(-d).UnixNano() / int64(time.Millisecond)
+	}
+	branches := []ld.BranchRep{
+		{Name: "main", SyncTime: syncedAgo(time.Hour)},
+		{Name: "release/1.0", SyncTime: syncedAgo(30 * 24 * time.Hour)},
+		{Name: "feature/recent", SyncTime: syncedAgo(time.Hour)},
+		{Name: "feature/old", SyncTime: syncedAgo(30 * 24 * time.Hour)},
+		{Name: "develop", SyncTime: syncedAgo(time.Hour)},
+	}
+	policy := prunePolicy{protected: []string{"release/*", "main"}, minAge: 7 * 24 * time.Hour}
+
+	decisions := calculateStaleBranches(branches, map[string]bool{"develop": true}, policy, now)
+	require.Equal(t, []branchDecision{
+		{name: "main", reason: "protected by the pattern main"},
+		{name: "release/1.0", reason: "protected by the pattern release/*"},
+		{name: "feature/recent", reason: "synced 1h0m0s ago, more recently than the minimum age of 168h0m0s"},
+		{name: "feature/old", prune: true, reason: "not found on the remote"},
+		{name: "develop", reason: "exists on the remote"},
+	}, decisions)
+	require.Equal(t, []string{"feature/old"}, prunedBranchNames(decisions))
+}
+
+func Test_calculateStaleBranchesWithTags(t *testing.T) {
+	now := time.Now()
+	branches := []ld.BranchRep{
+		{Name: "refs/tags/v2.9.1"},
+		{Name: "refs/tags/v2.10.0"},
+		{Name: "refs/tags/v2.10.0-rc.1"},
+		{Name: "refs/tags/v1.0.0"},
+		{Name: "refs/tags/lts-1"},
+		{Name: "main"},
+	}
+	remote := map[string]bool{"main": true, "refs/tags/v1.0.0": true}
+
+	t.Run("keeps tags by default", func(t *testing.T) {
+		require.Empty(t, prunedBranchNames(calculateStaleBranches(branches, remote, prunePolicy{}, now)))
+	})
+
+	t.Run("keeps the most recent tags", func(t *testing.T) {
+		decisions := calculateStaleBranches(branches, remote, prunePolicy{keepTags: 2, protected: []string{"lts-*"}}, now)
+		require.Equal(t, []string{"refs/tags/v2.9.1"}, prunedBranchNames(decisions))
+		require.Equal(t, "is the tag being scanned", decisions[3].reason)
+		require.Equal(t, "protected by the pattern lts-*", decisions[4].reason)
+	})
+}
+
+func Test_calculateStaleBranchesWithLimit(t *testing.T) {
+	now := time.Now()
+	branches := []ld.BranchRep{
+		{Name: "feature/a"},
+		{Name: "feature/b"},
+		{Name: "refs/tags/v1.0.0"},
+		{Name: "refs/tags/v1.1.0"},
+		{Name: "refs/tags/v1.2.0"},
+		{Name: "refs/tags/v2.0.0"},
+		{Name: "main"},
+	}
+	remote := map[string]bool{"main": true}
+
+	t.Run("counts branches and tags separately", func(t *testing.T) {
+		decisions := calculateStaleBranches(branches, remote, prunePolicy{keepTags: 1, maxBranches: 3}, now)
+		require.Equal(t, []string{"feature/a", "feature/b", "refs/tags/v1.0.0", "refs/tags/v1.1.0", "refs/tags/v1.2.0"}, prunedBranchNames(decisions))
+	})
+
+	t.Run("only skips the group over the limit", func(t *testing.T) {
+		decisions := calculateStaleBranches(branches, remote, prunePolicy{keepTags: 1, maxBranches: 2}, now)
+		require.Equal(t, []string{"feature/a", "feature/b"}, prunedBranchNames(decisions))
+		require.Equal(t, "one of 3 stale tags, more than the pruneMaxBranches limit of 2", decisions[2].reason)
+	})
+}
+
+func Test_compareVersions(t *testing.T) {
+	require.Equal(t, 1, compareVersions("v2.10.0", "v2.9.1"))
+	require.Equal(t, 1, compareVersions("2.3.0", "v2.3.0-rc.1"))
+	require.Equal(t, -1, compareVersions("v2.3.0-beta", "v2.3.0-rc.1"))
+	require.Equal(t, 0, compareVersions("v2.3", "2.3.0"))
+	require.Equal(t, -1, compareVersions("latest", "v0.0.1"))
+}
@@ -0,0 +1,222 @@
+package coderefs
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+)
+
+const (
+	redactedPlaceholder = "<redacted>"
+
+	// String literals and assigned values at least this long, containing letters and digits, are redacted when their
+	// shannon entropy (in bits per character) is at least minSecretEntropy. Random base64 and hex strings of this
+	// length typically score above 3.5, while prose scores well below it.
+	minSecretLength  = 20
+	minSecretEntropy = 3.5
+	// Identifiers and paths can score as high as random strings, but are made of words, e.g. `handleCheckoutV2Request`
+	// or `launchdarkly/api-client-go/v2`. Tokens whose words average at least this many characters aren't redacted.
+	minWordLength = 4
+)
+
+// detector finds potential secrets in a line of source code. If the pattern contains a capture group, only the text
+// matched by the first group is redacted, so that the surrounding code (e.g. the name of an assignment) stays readable.
+type detector struct {
+	pattern *regexp.Regexp
+	// accept optionally filters candidate matches
+	accept func(string) bool
+}
+
+var (
+	secretKeywords = `(?:password|passwd|pwd|secret|api[_-]?key|access[_-]?token|auth[_-]?token|client[_-]?secret)`
+	secretToken    = `[A-Za-z0-9+/_.=-]{` + fmt.Sprint(minSecretLength) + `,}`
+
+	defaultDetectors = []detector{
+		// AWS access key ids, GitHub and Slack tokens
+		{pattern: regexp.MustCompile(`\b((?:AKIA|ASIA|AGPA|AIDA|AROA|AIPA|ANPA|ANVA)[0-9A-Z]{16})\b`)},
+		{pattern: regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{36,})\b`)},
+		{pattern: regexp.MustCompile(`\b(xox[abposr]-[A-Za-z0-9-]{10,})`)},
+		// quoted values assigned to a secret-sounding name, e.g. `dbPassword = "hunter2"` or `"api_key": "abc"`
+		{pattern: regexp.MustCompile(`(?i)` + secretKeywords + `\w*["']?[ \t]*(?::=|=>|[:=])[ \t]*["']([^"'\s]+)["']`)},
+		// unquoted values in configuration files, e.g. `DB_PASSWORD=hunter2`
+		{pattern: regexp.MustCompile(`(?i)^[ \t]*(?:export[ \t]+)?\w*` + secretKeywords + `\w*[ \t]*[:=][ \t]*([^\s"'#]+)[ \t]*$`)},
+		// random looking string literals and assigned values, e.g. base64 or hex encoded keys
+		{pattern: regexp.MustCompile("[\"'`](" + secretToken + ")[\"'`]"), accept: isHighEntropy},
+		{pattern: regexp.MustCompile(`(?:^|[^=!<>:])(?::=|=>|[:=])[ \t]*(` + secretToken + `)[ \t]*[,;]?[ \t]*$`), accept: isHighEntropy},
+	}
+
+	constantName = regexp.MustCompile(`^[A-Z][A-Z0-9]*(?:_[A-Z0-9]+)+$`)
+
+	privateKeyBegin = regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----`)
+	privateKeyEnd   = regexp.MustCompile(`-----END [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----`)
+)
+
+// redactor replaces potential secrets in hunks with a placeholder before they are written to disk or sent to
+// LaunchDarkly. Flag keys are never redacted.
+type redactor struct {
+	detectors []detector
+	flags     map[string]bool
+}
+
+func newRedactor(patterns []string, flags []string) (*redactor, error) {
+	r := &redactor{detectors: append([]detector{}, defaultDetectors...), flags: make(map[string]bool, len(flags))}
+	for _, p := range patterns {
+		pattern, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %s", p, err)
+		}
+		r.detectors = append(r.detectors, detector{pattern: pattern})
+	}
+	for _, flag := range flags {
+		r.flags[flag] = true
+	}
+	return r, nil
+}
+
+// redactReferences redacts potential secrets from every hunk in place, and returns the number of redactions per path
+func (r *redactor) redactReferences(refs []ld.ReferenceHunksRep) map[string]int {
+	counts := map[string]int{}
+	for i := range refs {
+		for j := range refs[i].Hunks {
+			if n := r.redactHunk(&refs[i].Hunks[j]); n > 0 {
+				counts[refs[i].Path] += n
+			}
+		}
+	}
+	return counts
+}
+
+func (r *redactor) redactHunk(hunk *ld.HunkRep) int {
+	if hunk.Lines == "" {
+		return 0
+	}
+
+	count := 0
+	inPrivateKey := false
+	lines := strings.Split(hunk.Lines, "\n")
+	for i, line := range lines {
+		switch {
+		case inPrivateKey:
+			if privateKeyEnd.MatchString(line) {
+				inPrivateKey = false
+			} else if line != "" {
+				// the whole body of a private key is redacted, rather than relying on entropy to catch each line
+				lines[i] = redactedPlaceholder
+			}
+		case privateKeyBegin.MatchString(line) && !privateKeyEnd.MatchString(line):
+			inPrivateKey = true
+			count++
+		default:
+			var n int
+			lines[i], n = r.redactLine(line, hunk.FlagKey)
+			count += n
+		}
+	}
+	hunk.Lines = strings.Join(lines, "\n")
+	return count
+}
+
+// redactLine runs each detector over the line in turn, and returns the redacted line and the number of redactions
+func (r *redactor) redactLine(line, flagKey string) (string, int) {
+	count := 0
+	for _, d := range r.detectors {
+		matches := d.pattern.FindAllStringSubmatchIndex(line, -1)
+		if len(matches) == 0 {
+			continue
+		}
+
+		var b strings.Builder
+		last := 0
+		for _, m := range matches {
+			start, end := m[0], m[1]
+			if len(m) > 2 && m[2] >= 0 {
+				start, end = m[2], m[3]
+			}
+			secret := line[start:end]
+			if secret == redactedPlaceholder || r.isFlagKey(secret, flagKey) || (d.accept != nil && !d.accept(secret)) {
+				continue
+			}
+			b.WriteString(line[last:start])
+			b.WriteString(redactedPlaceholder)
+			last = end
+			count++
+		}
+		b.WriteString(line[last:])
+		line = b.String()
+	}
+	return line, count
+}
+
+func (r *redactor) isFlagKey(s, flagKey string) bool {
+	return r.flags[s] || (flagKey != "" && strings.Contains(s, flagKey))
+}
+
+// isHighEntropy reports whether s looks like a randomly generated token
+func isHighEntropy(s string) bool {
+	hasLetter, hasDigit := false, false
+	for _, c := range s {
+		hasLetter = hasLetter || unicode.IsLetter(c)
+		hasDigit = hasDigit || unicode.IsDigit(c)
+	}
+	return hasLetter && hasDigit && !isMadeOfWords(s) && shannonEntropy(s) >= minSecretEntropy
+}
+
+// isMadeOfWords reports whether s looks like an identifier or path, by splitting it into words at punctuation and case
+// changes, e.g. `handle`, `Checkout`, `V2` and `Request`. Random strings split into many short words, since their case
+// changes every few characters. Constant names such as `MAX_RETRIES_V2` are also made of words.
+func isMadeOfWords(s string) bool {
+	if constantName.MatchString(s) {
+		return true
+	}
+	class := func(c rune) int {
+		switch {
+		case unicode.IsLower(c):
+			return 1
+		case unicode.IsUpper(c):
+			return 2
+		case unicode.IsDigit(c):
+			return 3
+		}
+		return 0
+	}
+	runes := []rune(s)
+	words, letters := 0, 0
+	for i, c := range runes {
+		cur := class(c)
+		if cur == 0 {
+			continue
+		}
+		prev := 0
+		if i > 0 {
+			prev = class(runes[i-1])
+		}
+		// digits continue a word, and a new word starts after punctuation or digits, at a capital following a lowercase
+		// letter, and at the last capital of an acronym followed by a lowercase letter, e.g. `HTTPServer`
+		acronymEnd := cur == 2 && prev == 2 && i+1 < len(runes) && class(runes[i+1]) == 1
+		if prev == 0 || (prev == 3 && cur != 3) || (prev == 1 && cur == 2) || acronymEnd {
+			words++
+		}
+		if cur != 3 {
+			letters++
+		}
+	}
+	return words > 0 && letters >= minWordLength*words
+}
+
+func shannonEntropy(s string) float64 {
+	freq := map[rune]float64{}
+	for _, c := range s {
+		freq[c]++
+	}
+	entropy := 0.0
+	length := float64(len([]rune(s)))
+	for _, n := range freq {
+		p := n / length
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
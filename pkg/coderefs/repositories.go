@@ -0,0 +1,84 @@
+package coderefs
+
+import (
+	"path"
+	"strings"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/glob"
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	o "github.com/launchdarkly/ld-find-code-refs/internal/options"
+)
+
+// repository is a LaunchDarkly code reference repository. A single checkout may report references to several
+// repositories, in which case each repository claims the files matching its path patterns, and reports their
+// paths relative to its root. A repository without path patterns claims every file not claimed by another.
+type repository struct {
+	params ld.RepoParams
+	root   string
+	paths  []string
+}
+
+func newRepositories(configs []o.RepositoryConfig) []repository {
+	repos := make([]repository, 0, len(configs))
+	for _, c := range configs {
+		repos = append(repos, repository{
+			params: ld.RepoParams{
+				Type:              c.Type,
+				Name:              c.Name,
+				Url:               c.Url,
+				CommitUrlTemplate: c.CommitUrlTemplate,
+				HunkUrlTemplate:   c.HunkUrlTemplate,
+				DefaultBranch:     c.DefaultBranch,
+			},
+			root:  strings.Trim(c.Root, "/"),
+			paths: c.Paths,
+		})
+	}
+	return repos
+}
+
+func (r repository) claims(path string) bool {
+	return len(r.paths) == 0 || glob.MatchAny(r.paths, path)
+}
+
+// relativePath returns path relative to the repository root
+func (r repository) relativePath(p string) string {
+	if r.root == "" {
+		return p
+	}
+	rel := strings.TrimPrefix(p, r.root+"/")
+	if rel == p {
+		// files outside of the root are claimed explicitly by a pattern, so report them as is
+		return p
+	}
+	return path.Clean(rel)
+}
+
+// partitionByRepository splits search results between repositories. Each file is claimed by the first repository
+// whose patterns match it, and files not claimed by any repository are dropped. The returned slice is indexed
+// in the same order as repos.
+func partitionByRepository(lines searchResultLines, repos []repository) []searchResultLines {
+	ret := make([]searchResultLines, len(repos))
+	for i := range ret {
+		ret[i] = searchResultLines{}
+	}
+
+	for _, line := range lines {
+		for i, repo := range repos {
+			if repo.claims(line.Path) {
+				ret[i] = append(ret[i], line)
+				break
+			}
+		}
+	}
+	return ret
+}
+
+// relativizeReferences rewrites reference paths relative to the repository root. This happens after hunks are
+// built, so that project path scoping is always applied to paths relative to the checkout.
+func (r repository) relativizeReferences(refs []ld.ReferenceHunksRep) []ld.ReferenceHunksRep {
+	for i := range refs {
+		refs[i].Path = r.relativePath(refs[i].Path)
+	}
+	return refs
+}
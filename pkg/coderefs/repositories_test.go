@@ -0,0 +1,41 @@
+package coderefs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+)
+
+func Test_partitionByRepository(t *testing.T) {
+	repos := []repository{
+		{params: ld.RepoParams{Name: "payments"}, root: "services/payments", paths: []string{"services/payments/**"}},
+		{params: ld.RepoParams{Name: "search"}, root: "services/search", paths: []string{"services/search/**"}},
+		{params: ld.RepoParams{Name: "monorepo"}},
+	}
+	payments := searchResultLine{Path: "services/payments/api/handler.go", LineNum: 1}
+	search := searchResultLine{Path: "services/search/index.go", LineNum: 2}
+	other := searchResultLine{Path: "tools/main.go", LineNum: 3}
+
+	got := partitionByRepository(searchResultLines{payments, search, other}, repos)
+	require.Equal(t, []searchResultLines{{payments}, {search}, {other}}, got)
+
+	t.Run("drops unclaimed files without a default repository", func(t *testing.T) {
+		got := partitionByRepository(searchResultLines{payments, other}, repos[:1])
+		require.Equal(t, []searchResultLines{{payments}}, got)
+	})
+}
+
+func Test_repositoryRelativePath(t *testing.T) {
+	repo := repository{root: "services/payments", paths: []string{"services/payments/**", "shared/payments.go"}}
+	require.Equal(t, "api/handler.go", repo.relativePath("services/payments/api/handler.go"))
+	require.Equal(t, "shared/payments.go", repo.relativePath("shared/payments.go"))
+	require.Equal(t, "services/payments-v2/main.go", repo.relativePath("services/payments-v2/main.go"))
+
+	unrooted := repository{}
+	require.Equal(t, "services/payments/main.go", unrooted.relativePath("services/payments/main.go"))
+
+	refs := repo.relativizeReferences([]ld.ReferenceHunksRep{{Path: "services/payments/main.go"}})
+	require.Equal(t, []ld.ReferenceHunksRep{{Path: "main.go"}}, refs)
+}
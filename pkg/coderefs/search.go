@@ -1,10 +1,13 @@
 package coderefs
 
 import (
+	"context"
 	"errors"
 	"regexp"
+	"time"
 
 	"github.com/launchdarkly/ld-find-code-refs/internal/command"
+	"github.com/launchdarkly/ld-find-code-refs/internal/lang"
 	"github.com/launchdarkly/ld-find-code-refs/internal/log"
 	o "github.com/launchdarkly/ld-find-code-refs/internal/options"
 )
@@ -16,6 +19,11 @@ type searchResultLine struct {
 	LineNum  int
 	LineText string
 	FlagKeys []string
+	// Kinds and Usages classify the reference to each flag key in the line, for files in supported languages
+	Kinds  map[string]lang.Kind
+	Usages map[string]lang.Usage
+	// Confidence scores how likely the reference to each flag key in the line is to be genuine, from 0 to 100
+	Confidence map[string]int
 }
 
 type searchResultLines []searchResultLine
@@ -38,8 +46,71 @@ func (lines searchResultLines) Swap(i, j int) {
 	lines[i], lines[j] = lines[j], lines[i]
 }
 
+// withKinds drops references to flags whose kind is not one of kinds. References in files of unsupported languages
+// are always kept. If kinds is empty, all references are kept.
+func (lines searchResultLines) withKinds(kinds []lang.Kind) searchResultLines {
+	if len(kinds) == 0 {
+		return lines
+	}
+	allowed := map[lang.Kind]bool{}
+	for _, k := range kinds {
+		allowed[k] = true
+	}
+
+	dropped := lines.filterFlagReferences(func(line searchResultLine, flagKey string) bool {
+		return line.Kinds == nil || allowed[line.Kinds[flagKey]]
+	})
+	if dropped > 0 {
+		log.Debug.Printf("ignored %d flag references not in any of: %s", dropped, kinds)
+	}
+	return lines
+}
+
+// withUsages drops references to flags whose usage is not one of usages. References in files of unsupported
+// languages are always kept. If usages is empty, all references are kept.
+func (lines searchResultLines) withUsages(usages []lang.Usage) searchResultLines {
+	if len(usages) == 0 {
+		return lines
+	}
+	allowed := map[lang.Usage]bool{}
+	for _, u := range usages {
+		allowed[u] = true
+	}
+
+	dropped := lines.filterFlagReferences(func(line searchResultLine, flagKey string) bool {
+		return line.Usages == nil || allowed[line.Usages[flagKey]]
+	})
+	if dropped > 0 {
+		log.Debug.Printf("ignored %d flag references without any of the usages: %s", dropped, usages)
+	}
+	return lines
+}
+
+// filterFlagReferences removes flag references for which keep returns false, and returns the number of references removed
+func (lines searchResultLines) filterFlagReferences(keep func(line searchResultLine, flagKey string) bool) int {
+	dropped := 0
+	for i, line := range lines {
+		if len(line.FlagKeys) == 0 {
+			continue
+		}
+		flagKeys := []string{}
+		for _, flagKey := range line.FlagKeys {
+			if keep(line, flagKey) {
+				flagKeys = append(flagKeys, flagKey)
+			} else {
+				delete(line.Kinds, flagKey)
+				delete(line.Usages, flagKey)
+				delete(line.Confidence, flagKey)
+				dropped++
+			}
+		}
+		lines[i].FlagKeys = flagKeys
+	}
+	return dropped
+}
+
 // paginatedSearch uses approximations to decide the number of flags to scan for at once using maxSumFlagKeyLength as an upper bound
-func paginatedSearch(cmd command.Searcher, flags []string, maxSumFlagKeyLength, ctxLines int, delims []rune) ([][]string, error) {
+func paginatedSearch(ctx context.Context, cmd command.Searcher, flags []string, maxSumFlagKeyLength, ctxLines int, delims []rune) ([][]string, error) {
 	if maxSumFlagKeyLength == 0 {
 		return nil, NoSearchPatternErr
 	}
@@ -56,13 +127,17 @@ func paginatedSearch(cmd command.Searcher, flags []string, maxSumFlagKeyLength,
 		// if we've reached the end of the loop, or the current page has reached maximum length
 		if to == len(flags)-1 || totalKeyLength+command.FlagKeyCost(flags[to+1]) > maxSumFlagKeyLength {
 			log.Debug.Printf("searching for flags in group: [%d, %d]", from, to)
-			result, err := cmd.SearchForFlags(nextSearchKeys, ctxLines, delims)
+			start := time.Now()
+			result, err := cmd.SearchForFlags(ctx, nextSearchKeys, ctxLines, delims)
+			page := searchPage{Flags: len(nextSearchKeys), MaxKeyLength: maxSumFlagKeyLength, Duration: time.Since(start).Seconds(), Results: len(result)}
 			if err != nil {
 				if err == command.SearchTooLargeErr {
+					page.TooLarge = true
+					currentRun.addSearchPage(page)
 					// we expect all search implementations to complete successfully
 					// if pagination fails unexpectedly, repeat the search with a smaller page size
 					log.Debug.Printf("encountered an error paginating group [%d, %d], trying again with a lower page size", from, to)
-					remainder, err := paginatedSearch(cmd, flags[from:], maxSumFlagKeyLength/2, ctxLines, delims)
+					remainder, err := paginatedSearch(ctx, cmd, flags[from:], maxSumFlagKeyLength/2, ctxLines, delims)
 					if err != nil {
 						return nil, err
 					}
@@ -71,6 +146,7 @@ func paginatedSearch(cmd command.Searcher, flags []string, maxSumFlagKeyLength,
 				return nil, err
 			}
 
+			currentRun.addSearchPage(page)
 			results = append(results, result...)
 
 			// loop bookkeeping
@@ -82,13 +158,23 @@ func paginatedSearch(cmd command.Searcher, flags []string, maxSumFlagKeyLength,
 	return results, nil
 }
 
-func findReferences(cmd command.Searcher, flags []string, ctxLines int, exclude *regexp.Regexp) (searchResultLines, error) {
+func findReferences(ctx context.Context, cmd command.Searcher, flags []string, ctxLines int, exclude *regexp.Regexp, usages *lang.UsageClassifier) (searchResultLines, error) {
 	delims := o.Delimiters.Value()
 	log.Info.Printf("finding code references with delimiters: %s", delims.String())
-	results, err := paginatedSearch(cmd, flags, command.SafePaginationCharCount(), ctxLines, delims)
+	results, err := paginatedSearch(ctx, cmd, flags, command.SafePaginationCharCount(), ctxLines, delims)
 	if err != nil {
 		return searchResultLines{}, err
 	}
 
-	return generateReferences(flags, results, ctxLines, string(delims), exclude), nil
+	refs := searchResultLines(generateReferences(flags, results, ctxLines, string(delims), exclude, usages))
+
+	markers, err := cmd.SearchForSuppressions(ctx)
+	if err != nil {
+		return searchResultLines{}, err
+	}
+	suppressed := refs.suppressReferences(parseSuppressions(markers, exclude))
+	if suppressed > 0 {
+		log.Info.Printf("suppressed %d flag references with %s comments", suppressed, command.SuppressionMarker)
+	}
+	return refs, nil
 }
@@ -1,6 +1,7 @@
 package coderefs
 
 import (
+	"context"
 	"sort"
 	"testing"
 
@@ -10,16 +11,21 @@ import (
 )
 
 type MockClient struct {
-	results [][]string
-	err     error
-	pages   [][]string
+	results      [][]string
+	suppressions [][]string
+	err          error
+	pages        [][]string
 }
 
-func (c *MockClient) SearchForFlags(flags []string, ctxLines int, delimiters []rune) ([][]string, error) {
+func (c *MockClient) SearchForFlags(ctx context.Context, flags []string, ctxLines int, delimiters []rune) ([][]string, error) {
 	c.pages = append(c.pages, flags)
 	return c.results, c.err
 }
 
+func (c *MockClient) SearchForSuppressions(ctx context.Context) ([][]string, error) {
+	return c.suppressions, nil
+}
+
 func Test_paginatedSearch(t *testing.T) {
 	specs := []struct {
 		name                string
@@ -69,6 +75,7 @@ func Test_paginatedSearch(t *testing.T) {
 			}
 
 			res, err := paginatedSearch(
+				context.Background(),
 				&client,
 				[]string{"flag1", "flag2"},
 				tt.maxSumFlagKeyLength,
@@ -0,0 +1,249 @@
+package coderefs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	o "github.com/launchdarkly/ld-find-code-refs/internal/options"
+	"github.com/launchdarkly/ld-find-code-refs/internal/version"
+)
+
+// runSummary is a machine-readable record of a run, written to the path provided by the summaryFile option. The
+// metrics written to the path provided by the metricsFile option are derived from it.
+type runSummary struct {
+	mu sync.Mutex
+
+	Version    string    `json:"version"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	Duration   float64   `json:"durationSeconds"`
+	Success    bool      `json:"success"`
+	Error      string    `json:"error,omitempty"`
+	ErrorCode  string    `json:"errorCode,omitempty"`
+
+	Phases []phaseTiming `json:"phases"`
+	Flags  flagCounts    `json:"flags"`
+	// SearchPages lists each search run by paginatedSearch, including pages retried with fewer flags
+	SearchPages []searchPage `json:"searchPages"`
+	References  hunkCounts   `json:"references"`
+	// Repositories lists the references found for each repository, in the order they were scanned
+	Repositories []*repositorySummary `json:"repositories"`
+	// Limits lists each time a defensive limit was exceeded, and references were dropped as a result
+	Limits       []limitExceeded `json:"limitsExceeded"`
+	ApiResponses []ld.Response   `json:"apiResponses"`
+}
+
+type phaseTiming struct {
+	Name     string  `json:"name"`
+	Duration float64 `json:"durationSeconds"`
+	Error    string  `json:"error,omitempty"`
+}
+
+type flagCounts struct {
+	Searched int `json:"searched"`
+	Omitted  int `json:"omitted"`
+}
+
+type searchPage struct {
+	Flags int `json:"flags"`
+	// MaxKeyLength is the upper bound of the sum of flag key lengths in the page, which is halved on each retry
+	MaxKeyLength int     `json:"maxKeyLength"`
+	Duration     float64 `json:"durationSeconds"`
+	Results      int     `json:"results"`
+	// TooLarge is set if the search pattern was too large, in which case the remaining flags are searched again with
+	// smaller pages
+	TooLarge bool `json:"tooLarge,omitempty"`
+}
+
+type hunkCounts struct {
+	Files        int `json:"files"`
+	Hunks        int `json:"hunks"`
+	DroppedFiles int `json:"droppedFiles"`
+	DroppedHunks int `json:"droppedHunks"`
+}
+
+type repositorySummary struct {
+	Name                string `json:"name"`
+	Files               int    `json:"files"`
+	Hunks               int    `json:"hunks"`
+	StaleBranchesPruned int    `json:"staleBranchesPruned"`
+	// Success and Duration are only recorded by the batch command, which scans each repository separately
+	Success  *bool   `json:"success,omitempty"`
+	Duration float64 `json:"durationSeconds,omitempty"`
+	// referencesByFlag counts the hunks referencing each flag, by project key
+	referencesByFlag map[string]map[string]int
+}
+
+type limitExceeded struct {
+	Limit   string `json:"limit"`
+	Max     int    `json:"max"`
+	Found   int    `json:"found"`
+	Path    string `json:"path,omitempty"`
+	FlagKey string `json:"flagKey,omitempty"`
+}
+
+// currentRun records the current run if the summaryFile or metricsFile option is provided. Its methods do nothing
+// if it is nil, and are safe to call from concurrent scans.
+var currentRun *runSummary
+
+// startRunSummary starts recording the run if the summaryFile or metricsFile option is provided
+func startRunSummary() {
+	if o.SummaryFile.Value() != "" || o.MetricsFile.Value() != "" {
+		currentRun = newRunSummary()
+	}
+}
+
+// writeRunReports records the outcome of the run, and writes the summary and metrics to the paths provided by the
+// summaryFile and metricsFile options. They are written even if the run failed.
+func writeRunReports(runErr error) error {
+	if currentRun == nil {
+		return nil
+	}
+	currentRun.finish(runErr)
+	if path := o.SummaryFile.Value(); path != "" {
+		err := currentRun.write(path)
+		if err != nil {
+			return fmt.Errorf("could not write run summary: %s", err)
+		}
+		log.Info.Printf("wrote run summary to %s", path)
+	}
+	if path := o.MetricsFile.Value(); path != "" {
+		err := currentRun.writeMetrics(path)
+		if err != nil {
+			return fmt.Errorf("could not write metrics: %s", err)
+		}
+		log.Info.Printf("wrote metrics to %s", path)
+	}
+	return nil
+}
+
+func newRunSummary() *runSummary {
+	return &runSummary{
+		Version:      version.Version,
+		StartedAt:    time.Now().UTC(),
+		Phases:       []phaseTiming{},
+		SearchPages:  []searchPage{},
+		Repositories: []*repositorySummary{},
+		Limits:       []limitExceeded{},
+		ApiResponses: []ld.Response{},
+	}
+}
+
+func (s *runSummary) record(fn func()) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn()
+}
+
+func (s *runSummary) addPhase(name string, duration time.Duration, err error) {
+	s.record(func() {
+		p := phaseTiming{Name: name, Duration: duration.Seconds()}
+		if err != nil {
+			p.Error = err.Error()
+		}
+		s.Phases = append(s.Phases, p)
+	})
+}
+
+func (s *runSummary) setFlags(searched, omitted int) {
+	s.record(func() {
+		s.Flags = flagCounts{Searched: searched, Omitted: omitted}
+	})
+}
+
+func (s *runSummary) addSearchPage(p searchPage) {
+	s.record(func() {
+		s.SearchPages = append(s.SearchPages, p)
+	})
+}
+
+// repository returns the summary of the named repository, adding it if it wasn't recorded yet. The lock must be held.
+func (s *runSummary) repository(name string) *repositorySummary {
+	for _, r := range s.Repositories {
+		if r.Name == name {
+			return r
+		}
+	}
+	r := &repositorySummary{Name: name, referencesByFlag: map[string]map[string]int{}}
+	s.Repositories = append(s.Repositories, r)
+	return r
+}
+
+// addReferences records the references sent for a repository, counted for each project's flags
+func (s *runSummary) addReferences(repoName string, branchRep ld.BranchRep, projs projects) {
+	s.record(func() {
+		files, hunks := len(branchRep.References), branchRep.TotalHunkCount()
+		s.References.Files += files
+		s.References.Hunks += hunks
+		r := s.repository(repoName)
+		r.Files += files
+		r.Hunks += hunks
+		for _, p := range projs {
+			counts := branchRep.ForProject(p.key).ReferenceCountByFlag()
+			if len(counts) > 0 {
+				r.referencesByFlag[p.key] = counts
+			}
+		}
+	})
+}
+
+func (s *runSummary) addPrunedBranches(repoName string, count int) {
+	s.record(func() {
+		s.repository(repoName).StaleBranchesPruned += count
+	})
+}
+
+// setRepositoryResult records the outcome of scanning a single repository in a batch
+func (s *runSummary) setRepositoryResult(repoName string, success bool, duration time.Duration) {
+	s.record(func() {
+		r := s.repository(repoName)
+		r.Success = &success
+		r.Duration = duration.Seconds()
+	})
+}
+
+// addLimit records an exceeded limit, which caused droppedFiles files and droppedHunks hunks to be left out
+func (s *runSummary) addLimit(l limitExceeded, droppedFiles, droppedHunks int) {
+	s.record(func() {
+		s.Limits = append(s.Limits, l)
+		s.References.DroppedFiles += droppedFiles
+		s.References.DroppedHunks += droppedHunks
+	})
+}
+
+func (s *runSummary) addApiResponse(r ld.Response) {
+	s.record(func() {
+		s.ApiResponses = append(s.ApiResponses, r)
+	})
+}
+
+// finish records the outcome of the run
+func (s *runSummary) finish(err error) {
+	s.record(func() {
+		s.FinishedAt = time.Now().UTC()
+		s.Duration = s.FinishedAt.Sub(s.StartedAt).Seconds()
+		s.Success = err == nil
+		if err != nil {
+			s.Error = err.Error()
+			s.ErrorCode = errorCode(err)
+		}
+	})
+}
+
+func (s *runSummary) write(path string) error {
+	s.mu.Lock()
+	data, err := json.MarshalIndent(s, "", "  ")
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,95 @@
+package coderefs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/command"
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+)
+
+// recordRun records a run summary until the returned function is called
+func recordRun() (*runSummary, func()) {
+	currentRun = newRunSummary()
+	return currentRun, func() { currentRun = nil }
+}
+
+func Test_runSummaryRecordsSearchPages(t *testing.T) {
+	run, stop := recordRun()
+	defer stop()
+	client := MockClient{err: command.SearchTooLargeErr}
+	_, err := paginatedSearch(context.Background(), &client, []string{"flag1", "flag2"}, 7, 0, []rune{'"'})
+	require.Equal(t, NoSearchPatternErr, err)
+
+	require.Len(t, run.SearchPages, 3)
+	for i, maxKeyLength := range []int{7, 3, 1} {
+		require.Equal(t, 1, run.SearchPages[i].Flags)
+		require.Equal(t, maxKeyLength, run.SearchPages[i].MaxKeyLength)
+		require.True(t, run.SearchPages[i].TooLarge)
+	}
+}
+
+func Test_runSummaryRecordsPhases(t *testing.T) {
+	run, stop := recordRun()
+	defer stop()
+	otherErr := errors.New("some other error")
+	require.NoError(t, phase{name: "git"}.run(context.Background(), func(ctx context.Context) error { return nil }))
+	require.Equal(t, otherErr, phase{name: "upload"}.run(context.Background(), func(ctx context.Context) error { return otherErr }))
+
+	require.Len(t, run.Phases, 2)
+	require.Equal(t, "git", run.Phases[0].Name)
+	require.Empty(t, run.Phases[0].Error)
+	require.Equal(t, "upload", run.Phases[1].Name)
+	require.Equal(t, otherErr.Error(), run.Phases[1].Error)
+}
+
+func Test_runSummaryRecordsLimits(t *testing.T) {
+	run, stop := recordRun()
+	defer stop()
+	lines := searchResultLines{}
+	for i := 0; i < maxFileCount+2; i++ {
+		lines = append(lines, searchResultLine{Path: fmt.Sprintf("file%05d", i), LineNum: 1, FlagKeys: []string{testFlagKey}})
+	}
+	lines.makeReferenceHunksReps(projects{newProject("default", nil, []string{testFlagKey})}, contextPolicy{})
+
+	require.Equal(t, []limitExceeded{{Limit: "maxFileCount", Max: maxFileCount, Found: maxFileCount + 2}}, run.Limits)
+	require.Equal(t, 2, run.References.DroppedFiles)
+}
+
+func Test_writeRunSummary(t *testing.T) {
+	dir, err := ioutil.TempDir("", "summary")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	run := newRunSummary()
+	run.setFlags(10, 2)
+	run.addApiResponse(ld.Response{Method: "GET", Path: "/api/v2/flags/default", StatusCode: 401})
+	run.finish(wrapError(ld.UnauthorizedErr, "could not retrieve flag keys from LaunchDarkly"))
+	path := filepath.Join(dir, "summary.json")
+	require.NoError(t, run.write(path))
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	var written map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &written))
+	require.Equal(t, false, written["success"])
+	require.Equal(t, "unauthorized", written["errorCode"])
+	require.Equal(t, map[string]interface{}{"searched": 10.0, "omitted": 2.0}, written["flags"])
+	require.Len(t, written["apiResponses"], 1)
+}
+
+func Test_runSummaryIsOptional(t *testing.T) {
+	var run *runSummary
+	require.NotPanics(t, func() {
+		run.addPhase("git", 0, nil)
+		run.addLimit(limitExceeded{Limit: "maxHunkCount"}, 1, 0)
+	})
+}
@@ -0,0 +1,151 @@
+package coderefs
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/command"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+)
+
+// suppressionRegex matches a suppression marker, followed by `=` and a comma separated list of the flag keys it applies
+// to, if any. Any other text following the marker, such as an explanation, is not part of the match.
+var suppressionRegex = regexp.MustCompile(regexp.QuoteMeta(command.SuppressionMarker) + `(-start|-end)?\b(?:=(\w[\w.-]*(?:,\w[\w.-]*)*))?`)
+
+// suppression excludes references from lines first to last of a file. If flagKeys is empty, references to every
+// flag are excluded.
+type suppression struct {
+	path     string
+	line     int
+	marker   string
+	flagKeys []string
+	first    int
+	last     int
+	used     bool
+}
+
+// parseSuppressions reads the suppression markers found by a search. An `ignore` marker suppresses references on
+// its own line, or on the following line if its own line has no references, and an `ignore-start` marker suppresses
+// references up to the next `ignore-end` marker in the file.
+func parseSuppressions(searchResult [][]string, exclude *regexp.Regexp) map[string][]*suppression {
+	suppressions := map[string][]*suppression{}
+	open := map[string]*suppression{}
+
+	for _, r := range searchResult {
+		path := r[1]
+		if exclude != nil && exclude.String() != "" && exclude.MatchString(path) {
+			continue
+		}
+		lineNum, err := strconv.Atoi(r[3])
+		if err != nil {
+			log.Fatal.Fatalf("encountered an unexpected error reading suppression comments: %s", err)
+		}
+
+		for _, m := range suppressionRegex.FindAllStringSubmatch(r[4], -1) {
+			s := &suppression{path: path, line: lineNum, marker: command.SuppressionMarker + m[1], flagKeys: splitFlagKeys(m[2]), first: lineNum, last: lineNum}
+			switch m[1] {
+			case "-start":
+				if open[path] != nil {
+					log.Warning.Printf("%s:%d: %s inside the block started on line %d is ignored", path, lineNum, s.marker, open[path].line)
+					continue
+				}
+				s.last = -1
+				open[path] = s
+			case "-end":
+				if open[path] == nil {
+					log.Warning.Printf("%s:%d: %s without a preceding %s-start is ignored", path, lineNum, s.marker, command.SuppressionMarker)
+					continue
+				}
+				open[path].last = lineNum
+				open[path] = nil
+				continue
+			}
+			suppressions[path] = append(suppressions[path], s)
+		}
+	}
+
+	unterminated := []*suppression{}
+	for _, s := range open {
+		if s != nil {
+			unterminated = append(unterminated, s)
+		}
+	}
+	sort.Slice(unterminated, func(i, j int) bool { return unterminated[i].path < unterminated[j].path })
+	for _, s := range unterminated {
+		log.Warning.Printf("%s:%d: %s has no matching %s-end, suppressing references to the end of the file", s.path, s.line, s.marker, command.SuppressionMarker)
+	}
+	return suppressions
+}
+
+// splitFlagKeys splits a comma separated list of flag keys, returning an empty slice for an empty list
+func splitFlagKeys(keys string) []string {
+	return strings.FieldsFunc(keys, func(r rune) bool { return r == ',' })
+}
+
+func (s *suppression) covers(line searchResultLine, flagKey string) bool {
+	if line.LineNum < s.first || (s.last >= 0 && line.LineNum > s.last) {
+		return false
+	}
+	if len(s.flagKeys) == 0 {
+		return true
+	}
+	for _, k := range s.flagKeys {
+		if k == flagKey {
+			return true
+		}
+	}
+	return false
+}
+
+// suppressReferences removes references excluded by suppression comments, and returns the number of references
+// removed. Suppressions which didn't exclude any references are logged, as they are likely stale.
+func (lines searchResultLines) suppressReferences(suppressions map[string][]*suppression) int {
+	if len(suppressions) == 0 {
+		return 0
+	}
+
+	// an `ignore` marker on a line without references applies to the following line
+	referenced := map[string]map[int]bool{}
+	for _, line := range lines {
+		if len(line.FlagKeys) > 0 {
+			if referenced[line.Path] == nil {
+				referenced[line.Path] = map[int]bool{}
+			}
+			referenced[line.Path][line.LineNum] = true
+		}
+	}
+	for path, sups := range suppressions {
+		for _, s := range sups {
+			if s.marker == command.SuppressionMarker && !referenced[path][s.line] {
+				s.first, s.last = s.line+1, s.line+1
+			}
+		}
+	}
+
+	suppressed := lines.filterFlagReferences(func(line searchResultLine, flagKey string) bool {
+		keep := true
+		for _, s := range suppressions[line.Path] {
+			if s.covers(line, flagKey) {
+				s.used = true
+				keep = false
+			}
+		}
+		return keep
+	})
+
+	paths := make([]string, 0, len(suppressions))
+	for path := range suppressions {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		for _, s := range suppressions[path] {
+			if !s.used {
+				log.Warning.Printf("%s:%d: %s comment does not suppress any flag references and may be removed", s.path, s.line, s.marker)
+			}
+		}
+	}
+	return suppressed
+}
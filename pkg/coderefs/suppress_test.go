@@ -0,0 +1,73 @@
+package coderefs
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseSuppressions(t *testing.T) {
+	markers := [][]string{
+		{"", "a.go", ":", "3", "// ld-find-code-refs:ignore=flag-1,flag.2 migration notes for flag-3"},
+		{"", "a.go", ":", "5", "/* ld-find-code-refs:ignore-start */"},
+		{"", "a.go", ":", "9", "/* ld-find-code-refs:ignore-end */"},
+		{"", "b.md", ":", "1", "<!-- ld-find-code-refs:ignore-start=flag-1 -->"},
+		{"", "c.go", ":", "1", "// ld-find-code-refs:ignore-end"},
+		{"", "vendor/d.go", ":", "1", "// ld-find-code-refs:ignore"},
+		{"", "e.go", ":", "2", "// ld-find-code-refs:ignore removed in v2"},
+	}
+
+	got := parseSuppressions(markers, regexp.MustCompile("vendor/"))
+	require.Equal(t, map[string][]*suppression{
+		"a.go": {
+			{path: "a.go", line: 3, marker: "ld-find-code-refs:ignore", flagKeys: []string{"flag-1", "flag.2"}, first: 3, last: 3},
+			{path: "a.go", line: 5, marker: "ld-find-code-refs:ignore-start", flagKeys: []string{}, first: 5, last: 9},
+		},
+		"b.md": {
+			{path: "b.md", line: 1, marker: "ld-find-code-refs:ignore-start", flagKeys: []string{"flag-1"}, first: 1, last: -1},
+		},
+		"e.go": {
+			{path: "e.go", line: 2, marker: "ld-find-code-refs:ignore", flagKeys: []string{}, first: 2, last: 2},
+		},
+	}, got)
+}
+
+func Test_suppressReferences(t *testing.T) {
+	lines := searchResultLines{
+		{Path: "a.go", LineNum: 1, FlagKeys: []string{"flag-1", "flag-2"}},
+		{Path: "a.go", LineNum: 2, FlagKeys: []string{"flag-1"}},
+		{Path: "a.go", LineNum: 3},
+		{Path: "a.go", LineNum: 4, FlagKeys: []string{"flag-2"}},
+		{Path: "a.go", LineNum: 6, FlagKeys: []string{"flag-1"}},
+		{Path: "a.go", LineNum: 20, FlagKeys: []string{"flag-1"}},
+		{Path: "b.md", LineNum: 40, FlagKeys: []string{"flag-1", "flag-2"}},
+	}
+	suppressions := map[string][]*suppression{
+		"a.go": {
+			// trailing comment on a referencing line
+			{path: "a.go", line: 1, marker: "ld-find-code-refs:ignore", flagKeys: []string{"flag-2"}, first: 1, last: 1},
+			// comment on its own line applies to the next line
+			{path: "a.go", line: 3, marker: "ld-find-code-refs:ignore", first: 3, last: 3},
+			{path: "a.go", line: 5, marker: "ld-find-code-refs:ignore-start", first: 5, last: 10},
+			// stale
+			{path: "a.go", line: 15, marker: "ld-find-code-refs:ignore", first: 15, last: 15},
+		},
+		"b.md": {
+			{path: "b.md", line: 1, marker: "ld-find-code-refs:ignore-start", flagKeys: []string{"flag-1"}, first: 1, last: -1},
+		},
+	}
+
+	require.Equal(t, 4, lines.suppressReferences(suppressions))
+	require.Equal(t, searchResultLines{
+		{Path: "a.go", LineNum: 1, FlagKeys: []string{"flag-1"}},
+		{Path: "a.go", LineNum: 2, FlagKeys: []string{"flag-1"}},
+		{Path: "a.go", LineNum: 3},
+		{Path: "a.go", LineNum: 4, FlagKeys: []string{}},
+		{Path: "a.go", LineNum: 6, FlagKeys: []string{}},
+		{Path: "a.go", LineNum: 20, FlagKeys: []string{"flag-1"}},
+		{Path: "b.md", LineNum: 40, FlagKeys: []string{"flag-2"}},
+	}, lines)
+	require.False(t, suppressions["a.go"][3].used)
+	require.True(t, suppressions["a.go"][0].used)
+}
@@ -0,0 +1,44 @@
+package coderefs
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/lang"
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+)
+
+// annotateSymbols records the function, method or type enclosing the first flag reference of each hunk. Files are
+// read from the checkout at root, so this must run before paths are made relative to a repository root.
+func annotateSymbols(root string, refs []ld.ReferenceHunksRep) {
+	for i, ref := range refs {
+		language := lang.Detect(ref.Path)
+		if language == nil {
+			continue
+		}
+		/* #nosec */
+		src, err := ioutil.ReadFile(filepath.Join(root, ref.Path))
+		if err != nil {
+			log.Debug.Printf("could not read '%s' to find enclosing symbols: %s", ref.Path, err)
+			continue
+		}
+		symbols := language.Symbols(src)
+		for j := range ref.Hunks {
+			hunk := &refs[i].Hunks[j]
+			hunk.Symbol = symbols.At(referenceLine(*hunk))
+		}
+	}
+}
+
+// referenceLine returns the line number of the first reference to the hunk's flag. Hunks sent without source code
+// start at the reference itself.
+func referenceLine(hunk ld.HunkRep) int {
+	for i, line := range strings.Split(hunk.Lines, "\n") {
+		if strings.Contains(line, hunk.FlagKey) {
+			return hunk.StartingLineNumber + i
+		}
+	}
+	return hunk.StartingLineNumber
+}
@@ -0,0 +1,36 @@
+package coderefs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+)
+
+func Test_annotateSymbols(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ld-symbols")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	src := "package main\n\nfunc main() {\n\tclient.BoolVariation(\"flag-1\", user, false)\n}\n"
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte(src), 0600))
+
+	refs := []ld.ReferenceHunksRep{
+		{Path: "main.go", Hunks: []ld.HunkRep{
+			{StartingLineNumber: 3, Lines: "func main() {\n\tclient.BoolVariation(\"flag-1\", user, false)\n}\n", FlagKey: "flag-1"},
+			{StartingLineNumber: 4, FlagKey: "flag-1"},
+		}},
+		{Path: "missing.go", Hunks: []ld.HunkRep{{StartingLineNumber: 1, FlagKey: "flag-1"}}},
+		{Path: "README.md", Hunks: []ld.HunkRep{{StartingLineNumber: 1, FlagKey: "flag-1"}}},
+	}
+	annotateSymbols(dir, refs)
+
+	require.Equal(t, "main", refs[0].Hunks[0].Symbol)
+	require.Equal(t, "main", refs[0].Hunks[1].Symbol)
+	require.Equal(t, "", refs[1].Hunks[0].Symbol)
+	require.Equal(t, "", refs[2].Hunks[0].Symbol)
+}
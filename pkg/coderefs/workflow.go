@@ -0,0 +1,122 @@
+package coderefs
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+)
+
+// workflowOutput receives GitHub Actions workflow commands, which are read from the standard output of each step
+var workflowOutput io.Writer = os.Stdout
+
+// writeAnnotations reports references to archived flags as warnings, and references to deprecated flags as notices,
+// at the first line referencing the flag in each hunk. Paths must be relative to the root of the checkout.
+func writeAnnotations(w io.Writer, refs []ld.ReferenceHunksRep, projs projects) {
+	for _, ref := range refs {
+		for _, hunk := range ref.Hunks {
+			flag := projs.flag(hunk.ProjKey, hunk.FlagKey)
+			var command, title, status string
+			switch {
+			case flag.Archived:
+				command, title, status = "warning", "Archived flag", "archived"
+			case flag.Deprecated:
+				command, title, status = "notice", "Deprecated flag", "deprecated"
+			default:
+				continue
+			}
+			fmt.Fprintf(w, "::%s file=%s,line=%d,title=%s::%s\n", command,
+				escapeWorkflowProperty(ref.Path), referenceLine(hunk), escapeWorkflowProperty(title),
+				escapeWorkflowData(fmt.Sprintf("Flag %s in project %s is %s", flag.Key, hunk.ProjKey, status)))
+		}
+	}
+}
+
+var workflowDataEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+var workflowPropertyEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+
+func escapeWorkflowData(s string) string {
+	return workflowDataEscaper.Replace(s)
+}
+
+func escapeWorkflowProperty(s string) string {
+	return workflowPropertyEscaper.Replace(s)
+}
+
+// stepSummary formats a Markdown table of the number of references to each flag in a repository, and the number of
+// files referencing it
+func stepSummary(repoName string, b ld.BranchRep, projs projects) string {
+	type row struct {
+		projKey, flagKey string
+		refs             int
+		files            map[string]bool
+	}
+	rows := map[string]*row{}
+	for _, ref := range b.References {
+		for _, hunk := range ref.Hunks {
+			id := hunk.ProjKey + "/" + hunk.FlagKey
+			r, ok := rows[id]
+			if !ok {
+				r = &row{projKey: hunk.ProjKey, flagKey: hunk.FlagKey, files: map[string]bool{}}
+				rows[id] = r
+			}
+			r.refs++
+			r.files[ref.Path] = true
+		}
+	}
+	sorted := make([]*row, 0, len(rows))
+	for _, r := range rows {
+		sorted = append(sorted, r)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].refs != sorted[j].refs {
+			return sorted[i].refs > sorted[j].refs
+		}
+		if sorted[i].flagKey != sorted[j].flagKey {
+			return sorted[i].flagKey < sorted[j].flagKey
+		}
+		return sorted[i].projKey < sorted[j].projKey
+	})
+
+	var s strings.Builder
+	fmt.Fprintf(&s, "### Flag references in %s\n\n", repoName)
+	if len(sorted) == 0 {
+		s.WriteString("No flag references found.\n\n")
+		return s.String()
+	}
+	s.WriteString("| Flag | Project | References | Files |\n")
+	s.WriteString("| --- | --- | --: | --: |\n")
+	for _, r := range sorted {
+		flag := fmt.Sprintf("`%s`", r.flagKey)
+		details := projs.flag(r.projKey, r.flagKey)
+		if details.Archived {
+			flag += " (archived)"
+		} else if details.Deprecated {
+			flag += " (deprecated)"
+		}
+		fmt.Fprintf(&s, "| %s | `%s` | %d | %d |\n", flag, r.projKey, r.refs, len(r.files))
+	}
+	s.WriteString("\n")
+	return s.String()
+}
+
+// appendStepSummary appends the reference counts of a repository to the GitHub Actions step summary at path
+func appendStepSummary(path, repoName string, b ld.BranchRep, projs projects) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open step summary: %s", err)
+	}
+	_, err = f.WriteString(stepSummary(repoName, b, projs))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("could not write step summary: %s", err)
+	}
+	log.Debug.Printf("appended flag reference counts for %s to step summary %s", repoName, path)
+	return nil
+}
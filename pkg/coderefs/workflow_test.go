@@ -0,0 +1,71 @@
+package coderefs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+)
+
+func workflowProjects() projects {
+	return projects{newProjectWithDetails("default", nil, []ld.Flag{
+		{Key: "active-flag"},
+		{Key: "old-flag", Archived: true},
+		{Key: "legacy-flag", Deprecated: true},
+	})}
+}
+
+func Test_writeAnnotations(t *testing.T) {
+	refs := []ld.ReferenceHunksRep{
+		{Path: "src/app.js", Hunks: []ld.HunkRep{
+			{ProjKey: "default", FlagKey: "active-flag", StartingLineNumber: 1},
+			{ProjKey: "default", FlagKey: "old-flag", StartingLineNumber: 10, Lines: "// context\nvariation('old-flag')"},
+		}},
+		{Path: "src/a,b:c.js", Hunks: []ld.HunkRep{
+			{ProjKey: "default", FlagKey: "legacy-flag", StartingLineNumber: 3},
+		}},
+	}
+
+	var out bytes.Buffer
+	writeAnnotations(&out, refs, workflowProjects())
+	require.Equal(t, `::warning file=src/app.js,line=11,title=Archived flag::Flag old-flag in project default is archived
+::notice file=src/a%2Cb%3Ac.js,line=3,title=Deprecated flag::Flag legacy-flag in project default is deprecated
+`, out.String())
+}
+
+func Test_appendStepSummary(t *testing.T) {
+	dir, err := ioutil.TempDir("", "step-summary")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "summary.md")
+	require.NoError(t, ioutil.WriteFile(path, []byte("## Previous step\n\n"), 0644))
+
+	b := ld.BranchRep{References: []ld.ReferenceHunksRep{
+		{Path: "a.js", Hunks: []ld.HunkRep{
+			{ProjKey: "default", FlagKey: "active-flag"},
+			{ProjKey: "default", FlagKey: "old-flag"},
+		}},
+		{Path: "b.js", Hunks: []ld.HunkRep{
+			{ProjKey: "default", FlagKey: "old-flag"},
+			{ProjKey: "default", FlagKey: "old-flag"},
+		}},
+	}}
+	require.NoError(t, appendStepSummary(path, "repo", b, workflowProjects()))
+	require.NoError(t, appendStepSummary(path, "empty-repo", ld.BranchRep{}, workflowProjects()))
+
+	summary, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "## Previous step\n\n"+
+		"### Flag references in repo\n\n"+
+		"| Flag | Project | References | Files |\n"+
+		"| --- | --- | --: | --: |\n"+
+		"| `old-flag` (archived) | `default` | 3 | 2 |\n"+
+		"| `active-flag` | `default` | 1 | 1 |\n\n"+
+		"### Flag references in empty-repo\n\n"+
+		"No flag references found.\n\n", string(summary))
+}